@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+const usage = `Inspect and recover dead-lettered transfers.
+
+Usage:
+  go run ./cmd/dlq list                     list every dead-lettered transfer
+  go run ./cmd/dlq inspect <transfer_id>    show one dead-lettered transfer
+  go run ./cmd/dlq replay <transfer_id|--all>
+                                            reopen the transfer and queue it again
+  go run ./cmd/dlq purge <transfer_id|--all>
+                                            drop messages from the dead-letter queue`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	target := ""
+	if len(os.Args) > 2 {
+		target = os.Args[2]
+	}
+	if command != "list" && target == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := config.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize configuration: %v", err)
+	}
+
+	rmq, err := pkg.NewRabbitMQ()
+	if err != nil {
+		log.Fatal("RabbitMQ connection failed:", err)
+	}
+	defer rmq.Close()
+
+	matches := func(letter pkg.DeadLetter) bool {
+		return target == "--all" || letter.TransferID() == target
+	}
+
+	switch command {
+	case "list":
+		letters, err := rmq.ListDeadLetters()
+		if err != nil {
+			log.Fatalf("Failed to list dead letters: %v", err)
+		}
+		printJSON(letters)
+
+	case "inspect":
+		letters, err := rmq.ListDeadLetters()
+		if err != nil {
+			log.Fatalf("Failed to list dead letters: %v", err)
+		}
+		for _, letter := range letters {
+			if letter.TransferID() == target {
+				printJSON(letter)
+				return
+			}
+		}
+		log.Fatalf("Transfer %s is not in the dead-letter queue", target)
+
+	case "replay":
+		pg, err := pkg.Posql()
+		if err != nil {
+			log.Fatal("DB connection failed:", err)
+		}
+		defer pg.Close()
+
+		repo := repositories.NewTransactionRepo(pg)
+		ctx := context.Background()
+		replayed := 0
+
+		err = rmq.DrainDeadLetters(func(letter pkg.DeadLetter) (pkg.DeadLetterAction, error) {
+			if !matches(letter) {
+				return pkg.DeadLetterKeep, nil
+			}
+			if letter.Transfer == nil {
+				log.Printf("Skipping malformed message %s, purge it instead", letter.MessageID)
+				return pkg.DeadLetterKeep, nil
+			}
+
+			// Reopening writes a fresh outbox message, the relay sends it to the transfer queue
+			previous, err := repo.ReopenTransfer(ctx, letter.Transfer.TransferID)
+			if err != nil {
+				return pkg.DeadLetterKeep, fmt.Errorf("reopen transfer %s: %w", letter.Transfer.TransferID, err)
+			}
+			log.Printf("Transfer %s was %s, replayed", letter.Transfer.TransferID, previous)
+			replayed++
+			return pkg.DeadLetterRemove, nil
+		})
+		if err != nil {
+			log.Fatalf("Replay stopped: %v", err)
+		}
+		log.Printf("Replayed %d dead-lettered transfers", replayed)
+
+	case "purge":
+		purged := 0
+		err := rmq.DrainDeadLetters(func(letter pkg.DeadLetter) (pkg.DeadLetterAction, error) {
+			if !matches(letter) {
+				return pkg.DeadLetterKeep, nil
+			}
+			purged++
+			return pkg.DeadLetterRemove, nil
+		})
+		if err != nil {
+			log.Fatalf("Purge stopped: %v", err)
+		}
+		log.Printf("Purged %d dead-lettered transfers", purged)
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("Failed to encode output: %v", err)
+	}
+}
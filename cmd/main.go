@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -13,10 +15,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/redha28/foomlet/internal/apperrors"
 	"github.com/redha28/foomlet/internal/config"
 	"github.com/redha28/foomlet/internal/models"
 	"github.com/redha28/foomlet/internal/repositories"
 	"github.com/redha28/foomlet/internal/routes"
+	"github.com/redha28/foomlet/internal/workers"
 	"github.com/redha28/foomlet/pkg"
 )
 
@@ -27,6 +31,9 @@ func main() {
 	if err := config.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize configuration: %v", err)
 	}
+	if err := config.GetConfig().Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Set up channel to listen for OS signals for graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -43,29 +50,73 @@ func main() {
 	defer pg.Close()
 	log.Println("DB connected successfully")
 
-	// Initialize RabbitMQ
-	if err := pkg.InitRabbitMQ(); err != nil {
-		log.Println("WARNING: RabbitMQ initialization failed:", err)
-		log.Println("Transfers will be processed synchronously")
-	} else {
-		log.Println("RabbitMQ connected successfully")
-		defer pkg.GlobalRabbitMQ.Close()
-
-		// Start transfer worker in a goroutine if RabbitMQ is connected
-		if pkg.GlobalRabbitMQ.IsReady() {
-			// Create transaction repository for worker
-			transactionRepo := repositories.NewTransactionRepo(pg)
-			go runTransferWorker(ctx, transactionRepo)
+	// Initialize the transfer queue selected by QUEUE_DRIVER
+	queue, err := newTransferQueue(config.GetConfig().Queue)
+	if err != nil {
+		log.Fatal("Transfer queue initialization failed:", err)
+	}
+	defer queue.Close()
+
+	// Start transfer worker, its consumer is registered again after every reconnect
+	go workers.NewTransferWorker(repositories.NewTransactionRepo(pg), queue).Run(ctx)
+
+	// The in-memory queue starts empty, publish the transfers it lost on the last shutdown again
+	outboxRepo := repositories.NewOutboxRepo(pg)
+	if config.GetConfig().Queue.Driver == pkg.QueueDriverMemory {
+		requeued, err := outboxRepo.RequeuePendingTransfers(ctx)
+		if err != nil {
+			log.Fatal("Requeueing pending transfers failed:", err)
 		}
+		log.Printf("Requeued %d pending transfers", requeued)
+	}
+
+	// Publish transfers written to the outbox
+	outboxCfg := config.GetConfig().Outbox
+	go workers.NewOutboxRelay(outboxRepo, queue, outboxCfg.PollInterval, outboxCfg.BatchSize).Run(ctx)
+
+	// Periodically drop expired Idempotency-Key records
+	go workers.RunIdempotencyJanitor(ctx, repositories.NewIdempotencyRepo(pg))
+
+	// Periodically drop expired sessions, their refresh tokens and spent step-up tokens
+	go workers.RunSessionJanitor(ctx, repositories.NewSessionRepo(pg), repositories.NewStepUpTokenRepo(pg))
+
+	// Periodically drop stale failed-login counters and expired one-time codes
+	go workers.RunLoginThrottleJanitor(ctx, repositories.NewLoginThrottleRepo(pg), repositories.NewOneTimeCodeRepo(pg),
+		config.GetConfig().Login.FailureWindow)
+
+	// Periodically compare wallet balances with their history, RECONCILE_INTERVAL=0 disables it
+	if reconcileCfg := config.GetConfig().Reconcile; reconcileCfg.Interval > 0 {
+		go workers.RunReconciliation(ctx, repositories.NewReconcileRepo(pg), reconcileCfg.Interval, reconcileCfg.StuckAfter)
+	}
+
+	// Periodically fail transfers the queue lost, RECONCILE_FAIL_STUCK_AFTER=0 disables it
+	if failAfter := config.GetConfig().Reconcile.FailStuckAfter; failAfter > 0 {
+		go workers.RunStuckTransferJanitor(ctx, repositories.NewTransactionRepo(pg), failAfter)
+	}
+
+	// Initialize the notifier selected by NOTIFIER_DRIVER
+	notifier, err := newNotifier(config.GetConfig().Notifier)
+	if err != nil {
+		log.Fatal("Notifier initialization failed:", err)
+	}
+
+	hasher, err := newHasher(config.GetConfig().Hash)
+	if err != nil {
+		log.Fatal("Hasher initialization failed:", err)
+	}
+
+	tokens, err := newJwtUtil(config.GetConfig().JWT)
+	if err != nil {
+		log.Fatal("Token signing initialization failed:", err)
 	}
 
-	router := routes.InitRouter(pg)
+	router := routes.InitRouter(pg, notifier, hasher, tokens)
 
 	router.GET("/ping", func(c *gin.Context) {
 		responder := models.NewResponse(c)
 		reqCtx := c.Request.Context()
 		if err := pg.Ping(reqCtx); err != nil {
-			responder.InternalServerError("Database not responding", err.Error())
+			responder.Error(apperrors.ErrServiceUnavailable.Wrap(err))
 			return
 		}
 		responder.Success("pong", nil)
@@ -101,80 +152,94 @@ func main() {
 	log.Println("Server exited properly")
 }
 
-// runTransferWorker processes transfers from RabbitMQ queue
-func runTransferWorker(ctx context.Context, repo repositories.TransactionRepoInterface) {
-	log.Println("Starting transfer worker...")
+// newTransferQueue builds the TransferQueue for the configured driver
+func newTransferQueue(cfg config.QueueConfig) (pkg.TransferQueue, error) {
+	switch cfg.Driver {
+	case pkg.QueueDriverMemory:
+		log.Println("Using in-memory transfer queue, pending transfers are requeued from the outbox on restart")
+		return pkg.NewMemoryQueue(cfg.MemoryBuffer), nil
+	case pkg.QueueDriverRabbitMQ, "":
+		// RabbitMQ keeps reconnecting in the background while the broker is down
+		rmq, err := pkg.StartRabbitMQ()
+		if err != nil {
+			log.Println("WARNING: RabbitMQ connection failed:", err)
+			log.Println("Transfers stay in the outbox until it reconnects")
+		} else {
+			log.Println("RabbitMQ connected successfully")
+		}
+		return rmq, nil
+	default:
+		return nil, fmt.Errorf("unknown queue driver %q", cfg.Driver)
+	}
+}
 
-	// Get messages from RabbitMQ
-	msgs, err := pkg.GlobalRabbitMQ.ConsumeTransfers()
-	if err != nil {
-		log.Printf("Failed to consume transfers: %v", err)
-		return
+// newJwtUtil builds the token signer, asymmetric algorithms load their keys from JWT_KEYS_DIR
+func newJwtUtil(cfg config.JWTConfig) (*pkg.JwtUtil, error) {
+	tokens := pkg.NewJwtUtil(cfg.AccessSecret, cfg.RefreshSecret, cfg.AccessExpiry, cfg.RefreshExpiry)
+	switch cfg.Algorithm {
+	case pkg.JwtAlgorithmHS256, "":
+		return tokens, nil
+	case pkg.JwtAlgorithmRS256, pkg.JwtAlgorithmEdDSA:
+		keys, err := pkg.LoadKeySet(cfg.KeysDir, cfg.SigningKeyID, cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Signing access tokens with %s key %s", cfg.Algorithm, cfg.SigningKeyID)
+		tokens.UseKeys(keys)
+		// Access tokens issued with HS256 before the switch stay valid until they expire
+		if cfg.HasAccessSecret() {
+			until := time.Now().Add(cfg.AccessExpiry)
+			log.Printf("Accepting HS256 access tokens until %s", until.Format(time.RFC3339))
+			tokens.AcceptHS256Until(until)
+		}
+		return tokens, nil
+	default:
+		return nil, fmt.Errorf("unknown JWT algorithm %q", cfg.Algorithm)
 	}
+}
 
-	log.Println("Transfer worker started, processing messages from queue")
+// newHasher builds the PIN hasher from the configured argon2 parameters
+func newHasher(cfg config.HashConfig) (*pkg.Hasher, error) {
+	if cfg.Time < 1 || cfg.Memory < 8*cfg.Threads || cfg.Threads < 1 || cfg.Threads > 255 || cfg.KeyLen < 16 || cfg.SaltLen < 16 {
+		return nil, fmt.Errorf("invalid argon2 parameters: time=%d memory=%d threads=%d key_len=%d salt_len=%d",
+			cfg.Time, cfg.Memory, cfg.Threads, cfg.KeyLen, cfg.SaltLen)
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Transfer worker stopping due to context cancellation")
-			return
-		case msg, ok := <-msgs:
-			if !ok {
-				log.Println("Transfer worker stopping - channel closed")
-				return
-			}
-
-			log.Printf("Received transfer message: %s", msg.Body)
-
-			var transferMsg pkg.TransferMessage
-			if err := json.Unmarshal(msg.Body, &transferMsg); err != nil {
-				log.Printf("Error unmarshalling message: %v", err)
-				msg.Reject(false) // Don't requeue malformed messages
-				continue
-			}
-
-			log.Printf("Processing transfer: %s from %s to %s for %.2f",
-				transferMsg.TransferID,
-				transferMsg.SenderID,
-				transferMsg.RecipientID,
-				transferMsg.Amount)
-
-			// Process the transfer
-			processCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-			err := repo.ProcessTransfer(
-				processCtx,
-				transferMsg.TransferID,
-				transferMsg.SenderID,
-				transferMsg.RecipientID,
-				transferMsg.Amount,
-				transferMsg.Remarks,
-			)
-			cancel()
-
-			if err != nil {
-				log.Printf("Error processing transfer %s: %v", transferMsg.TransferID, err)
-
-				// Determine if the error is retryable
-				if isRetryableError(err) {
-					log.Printf("Retrying transfer %s", transferMsg.TransferID)
-					msg.Reject(true) // Requeue for retry
-				} else {
-					log.Printf("Permanent failure for transfer %s", transferMsg.TransferID)
-					msg.Reject(false) // Don't requeue
-				}
-				continue
-			}
-
-			// Acknowledge successful processing
-			msg.Ack(false)
-			log.Printf("Successfully processed transfer %s", transferMsg.TransferID)
+	hash := pkg.InitHashConfig()
+	hash.UseConfig(uint32(cfg.Time), uint32(cfg.Memory), uint32(cfg.KeyLen), uint32(cfg.SaltLen), uint8(cfg.Threads))
+	if cfg.PepperID < 1 || int64(cfg.PepperID) > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid PIN_PEPPER_ID %d", cfg.PepperID)
+	}
+	hash.UsePepper(uint32(cfg.PepperID), cfg.Pepper)
+
+	// Retired peppers keep old hashes verifying until the next login replaces them
+	for _, previous := range cfg.PreviousPeppers {
+		rawID, pepper, ok := strings.Cut(previous, ":")
+		id, err := strconv.ParseUint(rawID, 10, 32)
+		if !ok || err != nil || id == 0 || pepper == "" {
+			return nil, fmt.Errorf("PIN_PEPPER_PREVIOUS entries must look like id:secret")
 		}
+		if cfg.Pepper != "" && uint32(id) == hash.PepperID {
+			return nil, fmt.Errorf("PIN_PEPPER_PREVIOUS reuses the current PIN_PEPPER_ID %d", id)
+		}
+		hash.AddPreviousPepper(uint32(id), pepper)
 	}
+	return pkg.NewHasher(hash, cfg.Workers), nil
 }
 
-// Helper function to determine if an error is temporary and should be retried
-func isRetryableError(err error) bool {
-	return strings.Contains(err.Error(), "connection reset") ||
-		strings.Contains(err.Error(), "temporarily unavailable")
+// newNotifier builds the Notifier for the configured driver
+func newNotifier(cfg config.NotifierConfig) (pkg.Notifier, error) {
+	switch cfg.Driver {
+	case pkg.NotifierDriverLog, "":
+		log.Println("Using log notifier, codes are written to the log instead of being sent")
+		return pkg.NewLogNotifier(), nil
+	case pkg.NotifierDriverFile:
+		log.Printf("Using file notifier, codes are written to %s instead of being sent", cfg.FilePath)
+		return pkg.NewFileNotifier(cfg.FilePath), nil
+	case pkg.NotifierDriverHTTP:
+		log.Printf("Using http notifier, codes are sent through %s", cfg.HTTPURL)
+		return pkg.NewHTTPNotifier(cfg.HTTPURL, cfg.HTTPToken, cfg.HTTPTimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier driver %q", cfg.Driver)
+	}
 }
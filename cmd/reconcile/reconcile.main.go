@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// Reconcile wallet balances once and print the report as JSON.
+// Exits with status 1 when discrepancies were found so it can gate scripts and cron jobs.
+func main() {
+	if err := config.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize configuration: %v", err)
+	}
+
+	stuckAfter := flag.Duration("stuck-after", config.GetConfig().Reconcile.StuckAfter,
+		"report transfers PENDING for longer than this")
+	flag.Parse()
+
+	pg, err := pkg.Posql()
+	if err != nil {
+		log.Fatal("DB connection failed:", err)
+	}
+	defer pg.Close()
+
+	report, err := repositories.NewReconcileRepo(pg).Reconcile(context.Background(), *stuckAfter)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("Failed to encode report: %v", err)
+	}
+
+	if !report.Clean() {
+		pg.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,121 @@
+// Package apperrors defines the errors returned to API clients. Every error carries a
+// machine-readable code and the HTTP status it maps to; the cause is only ever logged.
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Code identifies an error for clients, it never changes once published
+type Code string
+
+const (
+	CodeInvalidInput        Code = "INVALID_INPUT"
+	CodeInvalidCursor       Code = "INVALID_CURSOR"
+	CodeInvalidDate         Code = "INVALID_DATE"
+	CodeInvalidDateRange    Code = "INVALID_DATE_RANGE"
+	CodeInvalidAmountRange  Code = "INVALID_AMOUNT_RANGE"
+	CodeInvalidIdempotency  Code = "INVALID_IDEMPOTENCY_KEY"
+	CodeUnauthorized        Code = "UNAUTHORIZED"
+	CodeInvalidCredentials  Code = "INVALID_CREDENTIALS"
+	CodeInvalidToken        Code = "INVALID_TOKEN"
+	CodeSessionRevoked      Code = "SESSION_REVOKED"
+	CodeRefreshTokenReused  Code = "REFRESH_TOKEN_REUSED"
+	CodeAccountLocked       Code = "ACCOUNT_LOCKED"
+	CodeTooManyAttempts     Code = "TOO_MANY_ATTEMPTS"
+	CodeInvalidCode         Code = "INVALID_CODE"
+	CodeInvalidPin          Code = "INVALID_PIN"
+	CodeStepUpRequired      Code = "STEP_UP_REQUIRED"
+	CodeInvalidStepUpToken  Code = "INVALID_STEP_UP_TOKEN"
+	CodeForbidden           Code = "FORBIDDEN"
+	CodeRouteNotFound       Code = "ROUTE_NOT_FOUND"
+	CodeUserNotFound        Code = "USER_NOT_FOUND"
+	CodeRecipientNotFound   Code = "RECIPIENT_NOT_FOUND"
+	CodeWalletNotFound      Code = "WALLET_NOT_FOUND"
+	CodeTransferNotFound    Code = "TRANSFER_NOT_FOUND"
+	CodeTransactionNotFound Code = "TRANSACTION_NOT_FOUND"
+	CodeSessionNotFound     Code = "SESSION_NOT_FOUND"
+	CodeUserAlreadyExists   Code = "USER_ALREADY_EXISTS"
+	CodeIdempotencyReused   Code = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyPending  Code = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	CodeInsufficientBalance Code = "INSUFFICIENT_BALANCE"
+	CodeLimitExceeded       Code = "LIMIT_EXCEEDED"
+	CodeSelfTransfer        Code = "SELF_TRANSFER"
+	CodeServiceUnavailable  Code = "SERVICE_UNAVAILABLE"
+	CodeInternal            Code = "INTERNAL_ERROR"
+)
+
+// Generic errors shared by every endpoint, domain errors live next to the code that returns them
+var (
+	ErrInvalidInput       = New(http.StatusBadRequest, CodeInvalidInput, "Invalid input")
+	ErrUnauthorized       = New(http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+	ErrInvalidCredentials = New(http.StatusUnauthorized, CodeInvalidCredentials, "Phone number and PIN do not match")
+	ErrInvalidToken       = New(http.StatusUnauthorized, CodeInvalidToken, "Invalid or expired token")
+	ErrForbidden          = New(http.StatusForbidden, CodeForbidden, "Forbidden")
+	ErrRouteNotFound      = New(http.StatusNotFound, CodeRouteNotFound, "Route not found")
+	ErrServiceUnavailable = New(http.StatusServiceUnavailable, CodeServiceUnavailable, "Service unavailable")
+	ErrInternal           = New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+)
+
+// Error is an error that can be shown to a client. Message is the English text used in logs,
+// clients get the message of Code in their language from the i18n catalog.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details any
+	cause   error
+}
+
+// New creates an error, usually stored in a package level variable and returned as is or
+// through WithDetails and Wrap
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches any error with the same code, so copies made by WithDetails and Wrap still
+// compare equal to the original variable with errors.Is
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails returns a copy carrying details for the client
+func (e *Error) WithDetails(details any) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Wrap returns a copy that keeps err as its cause, only client errors explain it in their details
+func (e *Error) Wrap(err error) *Error {
+	copied := *e
+	copied.cause = err
+	return &copied
+}
+
+// Internal wraps an unexpected error, the client only sees a generic message
+func Internal(err error) *Error {
+	return ErrInternal.Wrap(err)
+}
+
+// From returns the Error inside err, anything else becomes an internal error
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
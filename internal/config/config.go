@@ -1,23 +1,49 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/redha28/foomlet/pkg"
 )
 
 // Global config instance
 var AppConfig *Config
 
+// EnvDevelopment is the only environment allowed to run with the default secrets
+const EnvDevelopment = "development"
+
+// Secrets used when the env vars are missing, fine for local development only
+const (
+	defaultAccessSecret  = "yourAccessTokenSecret123"
+	defaultRefreshSecret = "yourRefreshTokenSecret456"
+	defaultOTPSecret     = "yourOneTimeCodeSecret789"
+)
+
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	JWT         JWTConfig
+	Idempotency IdempotencyConfig
+	Outbox      OutboxConfig
+	Queue       QueueConfig
+	Reconcile   ReconcileConfig
+	Login       LoginConfig
+	OTP         OTPConfig
+	Notifier    NotifierConfig
+	StepUp      StepUpConfig
+	Hash        HashConfig
 }
 
 type ServerConfig struct {
-	Port string
+	Env            string
+	Port           string
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -33,6 +59,85 @@ type JWTConfig struct {
 	RefreshSecret string
 	AccessExpiry  time.Duration
 	RefreshExpiry time.Duration
+	// SessionLifetime is how long a session lasts after its login, however often it is refreshed
+	SessionLifetime time.Duration
+	Algorithm       string
+	KeysDir         string
+	SigningKeyID    string
+}
+
+// HasAccessSecret reports whether JWT_ACCESS_SECRET holds a secret of its own
+func (j JWTConfig) HasAccessSecret() bool {
+	return j.AccessSecret != "" && j.AccessSecret != defaultAccessSecret
+}
+
+type IdempotencyConfig struct {
+	TTL            time.Duration
+	PendingTimeout time.Duration
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+type QueueConfig struct {
+	Driver       string
+	MemoryBuffer int
+}
+
+type ReconcileConfig struct {
+	Interval   time.Duration
+	StuckAfter time.Duration
+	// FailStuckAfter is how long a transfer may stay PENDING before it is failed, 0 never fails them
+	FailStuckAfter time.Duration
+}
+
+type LoginConfig struct {
+	MaxFailures     int
+	FreeAttempts    int
+	IPMaxFailures   int
+	IPFreeAttempts  int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+}
+
+type OTPConfig struct {
+	TTL            time.Duration
+	MaxAttempts    int
+	ResendInterval time.Duration
+	// Secret keys the HMAC one-time codes are stored with
+	Secret string
+}
+
+type NotifierConfig struct {
+	Driver   string
+	FilePath string
+	// HTTPURL is the SMS gateway the http driver posts to, HTTPToken authenticates it
+	HTTPURL     string
+	HTTPToken   string
+	HTTPTimeout time.Duration
+}
+
+type StepUpConfig struct {
+	Threshold   pkg.Money
+	TokenExpiry time.Duration
+}
+
+// HashConfig holds the argon2 parameters of new PIN hashes, Memory is in KiB
+type HashConfig struct {
+	Time    int
+	Memory  int
+	Threads int
+	KeyLen  int
+	SaltLen int
+	Pepper  string
+	// PepperID is recorded in new hashes, PreviousPeppers lists retired peppers as "id:secret"
+	PepperID        int
+	PreviousPeppers []string
+	Workers         int
 }
 
 // Initialize loads config values from .env and sets up the global config
@@ -43,7 +148,9 @@ func Initialize() error {
 
 	AppConfig = &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
+			Env:            getEnv("APP_ENV", "production"),
+			Port:           getEnv("PORT", "8080"),
+			TrustedProxies: getList("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -53,13 +160,128 @@ func Initialize() error {
 			DBName:   getEnv("DB_NAME", "ewallet"),
 		},
 		JWT: JWTConfig{
-			AccessSecret:  getEnv("JWT_ACCESS_SECRET", "yourAccessTokenSecret123"),
-			RefreshSecret: getEnv("JWT_REFRESH_SECRET", "yourRefreshTokenSecret456"),
-			AccessExpiry:  getDuration("JWT_ACCESS_EXPIRY", 15*time.Minute),
-			RefreshExpiry: getDuration("JWT_REFRESH_EXPIRY", 7*24*time.Hour),
+			AccessSecret:    getEnv("JWT_ACCESS_SECRET", defaultAccessSecret),
+			RefreshSecret:   getEnv("JWT_REFRESH_SECRET", defaultRefreshSecret),
+			AccessExpiry:    getDuration("JWT_ACCESS_EXPIRY", 15*time.Minute),
+			RefreshExpiry:   getDuration("JWT_REFRESH_EXPIRY", 7*24*time.Hour),
+			SessionLifetime: getDuration("JWT_SESSION_LIFETIME", 30*24*time.Hour),
+			Algorithm:       getEnv("JWT_ALGORITHM", pkg.JwtAlgorithmHS256),
+			KeysDir:         getEnv("JWT_KEYS_DIR", "keys"),
+			SigningKeyID:    getEnv("JWT_SIGNING_KEY_ID", ""),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:            getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+			PendingTimeout: getDuration("IDEMPOTENCY_PENDING_TIMEOUT", 5*time.Minute),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getInt("OUTBOX_BATCH_SIZE", 100),
+		},
+		Queue: QueueConfig{
+			Driver:       getEnv("QUEUE_DRIVER", "rabbitmq"),
+			MemoryBuffer: getInt("QUEUE_MEMORY_BUFFER", 1000),
 		},
+		Reconcile: ReconcileConfig{
+			Interval:       getDuration("RECONCILE_INTERVAL", 24*time.Hour),
+			StuckAfter:     getDuration("RECONCILE_STUCK_AFTER", time.Hour),
+			FailStuckAfter: getDuration("RECONCILE_FAIL_STUCK_AFTER", 6*time.Hour),
+		},
+		Login: LoginConfig{
+			MaxFailures:     getInt("LOGIN_MAX_FAILURES", 5),
+			FreeAttempts:    getInt("LOGIN_FREE_ATTEMPTS", 3),
+			IPMaxFailures:   getInt("LOGIN_IP_MAX_FAILURES", 50),
+			IPFreeAttempts:  getInt("LOGIN_IP_FREE_ATTEMPTS", 20),
+			BaseDelay:       getDuration("LOGIN_BASE_DELAY", time.Second),
+			MaxDelay:        getDuration("LOGIN_MAX_DELAY", 30*time.Second),
+			FailureWindow:   getDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			LockoutDuration: getDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute),
+		},
+		OTP: OTPConfig{
+			TTL:            getDuration("OTP_TTL", 10*time.Minute),
+			MaxAttempts:    getInt("OTP_MAX_ATTEMPTS", 5),
+			ResendInterval: getDuration("OTP_RESEND_INTERVAL", time.Minute),
+			Secret:         getEnv("OTP_SECRET", defaultOTPSecret),
+		},
+		Notifier: NotifierConfig{
+			Driver:      getEnv("NOTIFIER_DRIVER", "log"),
+			FilePath:    getEnv("NOTIFIER_FILE", "notifications.log"),
+			HTTPURL:     getEnv("NOTIFIER_HTTP_URL", ""),
+			HTTPToken:   getEnv("NOTIFIER_HTTP_TOKEN", ""),
+			HTTPTimeout: getDuration("NOTIFIER_HTTP_TIMEOUT", 10*time.Second),
+		},
+		StepUp: StepUpConfig{
+			Threshold:   getMoney("STEP_UP_THRESHOLD", pkg.NewMoney(1000000, 0)),
+			TokenExpiry: getDuration("STEP_UP_TOKEN_EXPIRY", 5*time.Minute),
+		},
+		Hash: HashConfig{
+			Time:            getInt("ARGON2_TIME", 3),
+			Memory:          getInt("ARGON2_MEMORY", 64*1024),
+			Threads:         getInt("ARGON2_THREADS", 2),
+			KeyLen:          getInt("ARGON2_KEY_LEN", 32),
+			SaltLen:         getInt("ARGON2_SALT_LEN", 16),
+			Pepper:          getEnv("PIN_PEPPER", ""),
+			PepperID:        getInt("PIN_PEPPER_ID", 1),
+			PreviousPeppers: getList("PIN_PEPPER_PREVIOUS"),
+			Workers:         getInt("HASH_WORKERS", 4),
+		},
+	}
+
+	return nil
+}
+
+// IsDevelopment reports whether the app runs in development mode
+func (c *Config) IsDevelopment() bool {
+	return c.Server.Env == EnvDevelopment
+}
+
+// Validate refuses the settings of the API server that are unsafe: empty or shared secrets in any
+// mode, and the default secrets outside development mode. The CLIs sign nothing and skip it.
+func (c *Config) Validate() error {
+	// The access secret only signs tokens while no asymmetric algorithm is configured
+	asymmetric := c.JWT.Algorithm == pkg.JwtAlgorithmRS256 || c.JWT.Algorithm == pkg.JwtAlgorithmEdDSA
+
+	// An empty key lets anyone sign tokens or codes
+	if c.JWT.RefreshSecret == "" {
+		return errors.New("JWT_REFRESH_SECRET must not be empty")
+	}
+	if !asymmetric && c.JWT.AccessSecret == "" {
+		return errors.New("JWT_ACCESS_SECRET must not be empty")
+	}
+	if c.OTP.Secret == "" {
+		return errors.New("OTP_SECRET must not be empty")
+	}
+	if c.JWT.SessionLifetime <= 0 {
+		return errors.New("JWT_SESSION_LIFETIME must be positive")
+	}
+	if c.Notifier.Driver == pkg.NotifierDriverHTTP && c.Notifier.HTTPURL == "" {
+		return errors.New("NOTIFIER_HTTP_URL must be set for the http notifier")
+	}
+
+	// Access, refresh and step-up tokens and one-time codes only stay apart with keys of their own
+	if c.JWT.AccessSecret != "" && c.JWT.AccessSecret == c.JWT.RefreshSecret {
+		return errors.New("JWT_ACCESS_SECRET and JWT_REFRESH_SECRET must differ")
+	}
+	if c.OTP.Secret == c.JWT.AccessSecret || c.OTP.Secret == c.JWT.RefreshSecret {
+		return errors.New("OTP_SECRET must differ from the JWT secrets")
 	}
 
+	if c.IsDevelopment() {
+		return nil
+	}
+	if c.JWT.RefreshSecret == defaultRefreshSecret {
+		return errors.New("JWT_REFRESH_SECRET must be set outside development")
+	}
+	if !asymmetric && !c.JWT.HasAccessSecret() {
+		return errors.New("JWT_ACCESS_SECRET must be set outside development")
+	}
+	if c.OTP.Secret == defaultOTPSecret {
+		return errors.New("OTP_SECRET must be set outside development")
+	}
+	// The log and file notifiers never reach the user's phone, they only serve local testing
+	switch c.Notifier.Driver {
+	case pkg.NotifierDriverLog, pkg.NotifierDriverFile, "":
+		return fmt.Errorf("NOTIFIER_DRIVER %q does not send messages, use %q outside development", c.Notifier.Driver, pkg.NotifierDriverHTTP)
+	}
 	return nil
 }
 
@@ -81,6 +303,35 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getList splits a comma separated value, an unset or empty value gives an empty list
+func getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getInt(key string, fallback int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if number, err := strconv.Atoi(value); err == nil {
+			return number
+		}
+	}
+	return fallback
+}
+
+func getMoney(key string, fallback pkg.Money) pkg.Money {
+	if value, exists := os.LookupEnv(key); exists {
+		if amount, err := pkg.ParseMoney(value); err == nil {
+			return amount
+		}
+	}
+	return fallback
+}
+
 func getDuration(key string, fallback time.Duration) time.Duration {
 	if value, exists := os.LookupEnv(key); exists {
 		if duration, err := time.ParseDuration(value); err == nil {
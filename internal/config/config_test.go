@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redha28/foomlet/pkg"
+)
+
+// productionConfig returns a production config with secrets of its own and the http notifier
+func productionConfig() *Config {
+	return &Config{
+		Server: ServerConfig{Env: "production"},
+		JWT: JWTConfig{
+			AccessSecret:    "production-access-secret",
+			RefreshSecret:   "production-refresh-secret",
+			SessionLifetime: 30 * 24 * time.Hour,
+			Algorithm:       pkg.JwtAlgorithmHS256,
+		},
+		OTP: OTPConfig{Secret: "production-otp-secret"},
+		Notifier: NotifierConfig{
+			Driver:      pkg.NotifierDriverHTTP,
+			HTTPURL:     "https://sms.example.com/send",
+			HTTPTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		valid  bool
+	}{
+		{name: "production with the http notifier", modify: func(c *Config) {}, valid: true},
+		{name: "production with the log notifier", modify: func(c *Config) { c.Notifier.Driver = pkg.NotifierDriverLog }},
+		{name: "production with the file notifier", modify: func(c *Config) { c.Notifier.Driver = pkg.NotifierDriverFile }},
+		{name: "production without a notifier", modify: func(c *Config) { c.Notifier.Driver = "" }},
+		{name: "http notifier without a URL", modify: func(c *Config) { c.Notifier.HTTPURL = "" }},
+		{name: "production with the default refresh secret", modify: func(c *Config) { c.JWT.RefreshSecret = defaultRefreshSecret }},
+		{name: "production with the default OTP secret", modify: func(c *Config) { c.OTP.Secret = defaultOTPSecret }},
+		{name: "shared JWT secrets", modify: func(c *Config) { c.JWT.RefreshSecret = c.JWT.AccessSecret }},
+		{
+			name: "development with the log notifier and default secrets",
+			modify: func(c *Config) {
+				c.Server.Env = EnvDevelopment
+				c.Notifier.Driver = pkg.NotifierDriverLog
+				c.JWT.AccessSecret, c.JWT.RefreshSecret, c.OTP.Secret = defaultAccessSecret, defaultRefreshSecret, defaultOTPSecret
+			},
+			valid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := productionConfig()
+			tt.modify(cfg)
+			if err := cfg.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
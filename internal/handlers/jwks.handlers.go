@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// jwksMaxAge lets verifiers cache the keys, a new key is published before it signs anything
+const jwksMaxAge = "public, max-age=300"
+
+type JwksHandler struct {
+	tokens *pkg.JwtUtil
+}
+
+func NewJwksHandler(tokens *pkg.JwtUtil) *JwksHandler {
+	return &JwksHandler{tokens: tokens}
+}
+
+// GetJwks serves the public keys of access tokens as a JWK Set. It is not wrapped in the
+// response envelope since verifiers expect the standard format; with HS256 the set is empty.
+func (h *JwksHandler) GetJwks(c *gin.Context) {
+	c.Header("Cache-Control", jwksMaxAge)
+	c.JSON(http.StatusOK, h.tokens.Keys.JWKS())
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// ErrInvalidPin is returned when a logged in user confirms an action with the wrong PIN
+var ErrInvalidPin = apperrors.New(http.StatusUnprocessableEntity, apperrors.CodeInvalidPin, "PIN is incorrect")
+
+// pinChecker verifies the PIN of a known user. Every check counts as a login attempt of the
+// user's phone number, so guessing the PIN anywhere leads to the same delays and lockout.
+type pinChecker struct {
+	throttle    repositories.LoginThrottleRepoInterface
+	hasher      *pkg.Hasher
+	phonePolicy models.ThrottlePolicy
+	ipPolicy    models.ThrottlePolicy
+}
+
+func newPinChecker(throttle repositories.LoginThrottleRepoInterface, hasher *pkg.Hasher) pinChecker {
+	cfg := config.GetConfig()
+	return pinChecker{
+		throttle: throttle,
+		hasher:   hasher,
+		phonePolicy: models.ThrottlePolicy{
+			MaxFailures:  cfg.Login.MaxFailures,
+			FreeAttempts: cfg.Login.FreeAttempts,
+			BaseDelay:    cfg.Login.BaseDelay,
+			MaxDelay:     cfg.Login.MaxDelay,
+			Window:       cfg.Login.FailureWindow,
+			Lockout:      cfg.Login.LockoutDuration,
+		},
+		ipPolicy: models.ThrottlePolicy{
+			MaxFailures:  cfg.Login.IPMaxFailures,
+			FreeAttempts: cfg.Login.IPFreeAttempts,
+			BaseDelay:    cfg.Login.BaseDelay,
+			MaxDelay:     cfg.Login.MaxDelay,
+			Window:       cfg.Login.FailureWindow,
+			Lockout:      cfg.Login.LockoutDuration,
+		},
+	}
+}
+
+// check returns ErrInvalidPin for a wrong PIN, or the lockout error once there were too many
+func (p pinChecker) check(c *gin.Context, user *models.User, pin string) error {
+	attempt := models.LoginAttempt{Phone: user.Phone, UserID: &user.ID, Device: deviceInfo(c)}
+	if err := p.throttle.BeginAttempt(c, attempt, p.phonePolicy, p.ipPolicy); err != nil {
+		return err
+	}
+
+	isValid, err := p.hasher.Compare(c.Request.Context(), user.Pin, pin)
+	if err != nil {
+		return apperrors.Internal(err)
+	}
+	if !isValid {
+		if err := p.throttle.RecordFailure(c, attempt, p.phonePolicy, p.ipPolicy); err != nil {
+			return err
+		}
+		return ErrInvalidPin
+	}
+
+	return p.throttle.RecordSuccess(c, attempt)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/i18n"
+	"github.com/redha28/foomlet/internal/middlewares"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+// maxUserAgentLength matches the sessions.user_agent column
+const maxUserAgentLength = 512
+
+type SessionHandler struct {
+	sessions repositories.SessionRepoInterface
+}
+
+func NewSessionHandler(sessions repositories.SessionRepoInterface) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+// GetSessions lists the devices the user is logged in on
+func (h *SessionHandler) GetSessions(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user and session ID from context
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+	currentID, _ := middlewares.GetSessionID(c)
+
+	sessions, err := h.sessions.GetActiveSessions(c, userID)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	result := make([]models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		result[i] = models.SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentID,
+		}
+	}
+
+	// Return success response
+	response.Success("", result)
+}
+
+// DeleteSession logs one of the user's devices out, the current one included
+func (h *SessionHandler) DeleteSession(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user ID from context
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var param models.IDParam
+	if err := c.ShouldBindUri(&param); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	if err := h.sessions.Revoke(c, userID, param.ID, models.SessionRevokedByUser); err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgSessionRevoked), nil)
+}
+
+// deviceInfo describes the client of the request for its session
+func deviceInfo(c *gin.Context) models.DeviceInfo {
+	userAgent := []rune(c.Request.UserAgent())
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return models.DeviceInfo{
+		UserAgent: string(userAgent),
+		IPAddress: c.ClientIP(),
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/middlewares"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+// memorySessionRepo keeps the sessions of every user in memory
+type memorySessionRepo struct {
+	repositories.SessionRepoInterface
+	sessions []models.Session
+}
+
+func (m *memorySessionRepo) GetActiveSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	sessions := []models.Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memorySessionRepo) Revoke(ctx context.Context, userID, sessionID string, reason models.SessionRevokedReason) error {
+	for i, session := range m.sessions {
+		if session.ID == sessionID && session.UserID == userID && session.RevokedAt == nil {
+			now := time.Now()
+			m.sessions[i].RevokedAt, m.sessions[i].RevokedReason = &now, &reason
+			return nil
+		}
+	}
+	return repositories.ErrSessionNotFound
+}
+
+// sessionRouter serves the session endpoints to the user logged in with sessionID
+func sessionRouter(repo *memorySessionRepo, userID, sessionID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middlewares.ErrorMiddleware(), func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Set("sessionID", sessionID)
+	})
+	handler := NewSessionHandler(repo)
+	router.GET("/sessions", handler.GetSessions)
+	router.DELETE("/sessions/:id", handler.DeleteSession)
+	return router
+}
+
+func serve(router http.Handler, method, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestSessionsFromAnotherDevice(t *testing.T) {
+	phoneID, laptopID, otherID := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	repo := &memorySessionRepo{sessions: []models.Session{
+		{ID: phoneID, UserID: "user", UserAgent: "phone", IPAddress: "192.0.2.10"},
+		{ID: laptopID, UserID: "user", UserAgent: "laptop", IPAddress: "192.0.2.20"},
+		{ID: otherID, UserID: "other", UserAgent: "other", IPAddress: "192.0.2.30"},
+	}}
+	router := sessionRouter(repo, "user", phoneID)
+
+	// The list shows the user's devices and which one is asking
+	recorder := serve(router, http.MethodGet, "/sessions")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("list answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var listed struct {
+		Result []models.SessionResponse `json:"result"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode sessions %q: %v", recorder.Body, err)
+	}
+	if len(listed.Result) != 2 {
+		t.Fatalf("%d sessions listed, want 2", len(listed.Result))
+	}
+	for _, session := range listed.Result {
+		if want := session.ID == phoneID; session.Current != want {
+			t.Errorf("session %s (%s) current = %v, want %v", session.ID, session.UserAgent, session.Current, want)
+		}
+	}
+
+	// The phone logs the laptop out
+	if recorder := serve(router, http.MethodDelete, "/sessions/"+laptopID); recorder.Code != http.StatusOK {
+		t.Fatalf("revoke answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if reason := repo.sessions[1].RevokedReason; reason == nil || *reason != models.SessionRevokedByUser {
+		t.Errorf("laptop revoked for %v, want %s", reason, models.SessionRevokedByUser)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+		wantCode   apperrors.Code
+	}{
+		{name: "already revoked", id: laptopID, wantStatus: http.StatusNotFound, wantCode: apperrors.CodeSessionNotFound},
+		{name: "another user's session", id: otherID, wantStatus: http.StatusNotFound, wantCode: apperrors.CodeSessionNotFound},
+		{name: "not an ID", id: "laptop", wantStatus: http.StatusBadRequest, wantCode: apperrors.CodeInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serve(router, http.MethodDelete, "/sessions/"+tt.id)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("answered %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			var response models.Response
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Error == nil {
+				t.Fatalf("response %s has no error", recorder.Body)
+			}
+			if response.Error.Code != tt.wantCode {
+				t.Errorf("error code %s, want %s", response.Error.Code, tt.wantCode)
+			}
+		})
+	}
+	if repo.sessions[2].RevokedAt != nil {
+		t.Error("another user's session was revoked")
+	}
+}
+
+func TestDeviceInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	c.Request.RemoteAddr = "192.0.2.1:1234"
+	c.Request.Header.Set("User-Agent", strings.Repeat("é", maxUserAgentLength+10))
+
+	device := deviceInfo(c)
+	if device.IPAddress != "192.0.2.1" {
+		t.Errorf("IP address %q, want %q", device.IPAddress, "192.0.2.1")
+	}
+	// Long user agents are cut on a character boundary to fit the column
+	if got := []rune(device.UserAgent); len(got) != maxUserAgentLength || string(got) != strings.Repeat("é", maxUserAgentLength) {
+		t.Errorf("user agent of %d characters, want %d", len(got), maxUserAgentLength)
+	}
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/middlewares"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// statementWriteTimeout replaces the server write timeout for statement downloads
+const statementWriteTimeout = 10 * time.Minute
+
+// statementFlushEvery is the number of rows written between flushes to the client
+const statementFlushEvery = 200
+
+// statementWriter renders a statement as it is streamed
+type statementWriter interface {
+	Header(header *models.StatementHeader) error
+	Row(row models.StatementRow) error
+	Footer(summary *models.StatementSummary) error
+}
+
+func (h *TransactionHandler) GetStatement(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user ID from context
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	// Parse the period and format
+	var req models.StatementRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+	if req.Format == "" {
+		req.Format = models.StatementFormatCSV
+	}
+
+	filter, err := req.Filter()
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	var writer statementWriter
+	var closeWriter func() error
+	var statement *models.Statement
+	rows := 0
+
+	// Profile and opening balance go first, errors until then can still be reported as JSON
+	startStatement := func(header *models.StatementHeader) error {
+		header.To = filter.To.AddDate(0, 0, -1)
+
+		// Large statements take longer than the server write timeout
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(statementWriteTimeout)); err != nil {
+			log.Printf("Failed to extend statement write deadline: %v", err)
+		}
+
+		filename := fmt.Sprintf("statement_%s_%s.%s", req.From, req.To, req.Format)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		if req.Format == models.StatementFormatPDF {
+			c.Header("Content-Type", "application/pdf")
+			pdf := &pdfStatement{pdf: pkg.NewPDFWriter(c.Writer)}
+			writer, closeWriter = pdf, pdf.pdf.Close
+		} else {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			csvWriter := &csvStatement{w: csv.NewWriter(c.Writer)}
+			writer, closeWriter = csvWriter, csvWriter.Close
+		}
+		c.Status(http.StatusOK)
+
+		statement = models.NewStatement(header.OpeningBalance)
+		return writer.Header(header)
+	}
+
+	writeRow := func(tx models.TransactionResponse) error {
+		if err := writer.Row(statement.Add(tx)); err != nil {
+			return err
+		}
+		if rows++; rows%statementFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	}
+
+	err = h.repo.StreamStatement(c, userID, filter, startStatement, writeRow)
+	if writer == nil {
+		response.Error(err)
+		return
+	}
+
+	// From here on the status is sent, a failure can only cut the download short
+	if err == nil {
+		err = writer.Footer(statement.Summary())
+	}
+	if err == nil {
+		err = closeWriter()
+	}
+	if err != nil {
+		log.Printf("Failed to stream statement for user %s: %v", userID, err)
+		c.Abort()
+	}
+}
+
+// csvStatement writes the profile, the rows and the totals as separate blocks of one CSV file
+type csvStatement struct {
+	w *csv.Writer
+}
+
+func (s *csvStatement) Header(header *models.StatementHeader) error {
+	records := [][]string{
+		{"Statement", header.From.Format(time.DateOnly), header.To.Format(time.DateOnly)},
+		{"Name", header.Name},
+		{"Phone", header.Phone},
+		{"Address", header.Address},
+		{"User ID", header.UserID},
+		{"Wallet ID", header.WalletID},
+		{"Opening balance", header.OpeningBalance.String()},
+		{},
+		{"Date", "Transaction ID", "Type", "Direction", "Status", "Remarks", "Amount", "Running balance"},
+	}
+	return s.write(records)
+}
+
+func (s *csvStatement) Row(row models.StatementRow) error {
+	return s.writeRecord([]string{
+		row.CreatedAt.Format(time.DateTime),
+		row.ID,
+		row.TransactionType,
+		string(row.Direction),
+		string(row.Status),
+		row.Remarks,
+		row.Amount.String(),
+		runningBalance(row),
+	})
+}
+
+func (s *csvStatement) Footer(summary *models.StatementSummary) error {
+	records := [][]string{
+		{},
+		{"Type", "Direction", "Count", "Amount"},
+	}
+	for _, total := range summary.Totals {
+		records = append(records, []string{total.TransactionType, string(total.Direction), fmt.Sprint(total.Count), total.Amount.String()})
+	}
+	records = append(records,
+		[]string{},
+		[]string{"Total in", summary.TotalIn.String()},
+		[]string{"Total out", summary.TotalOut.String()},
+		[]string{"Opening balance", summary.OpeningBalance.String()},
+		[]string{"Closing balance", summary.ClosingBalance.String()},
+	)
+	return s.write(records)
+}
+
+func (s *csvStatement) write(records [][]string) error {
+	for _, record := range records {
+		if err := s.writeRecord(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRecord writes one line with every cell escaped by csvCell
+func (s *csvStatement) writeRecord(record []string) error {
+	escaped := make([]string, len(record))
+	for i, cell := range record {
+		escaped[i] = csvCell(cell)
+	}
+	return s.w.Write(escaped)
+}
+
+// csvCell keeps spreadsheets from evaluating a cell as a formula: names, addresses and remarks
+// come from users, so a leading =, +, -, @, tab or carriage return is escaped with a quote
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func (s *csvStatement) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// pdfStatement lays the statement out as fixed-width text lines
+type pdfStatement struct {
+	pdf *pkg.PDFWriter
+}
+
+const pdfStatementRow = "%-19s  %-8s  %-3s  %-7s  %-24s  %17s  %17s"
+
+func (s *pdfStatement) lines(lines ...string) error {
+	for _, line := range lines {
+		if err := s.pdf.WriteLine(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *pdfStatement) Header(header *models.StatementHeader) error {
+	return s.lines(
+		"WALLET STATEMENT",
+		fmt.Sprintf("Period     : %s - %s", header.From.Format(time.DateOnly), header.To.Format(time.DateOnly)),
+		fmt.Sprintf("Name       : %s", header.Name),
+		fmt.Sprintf("Phone      : %s", header.Phone),
+		fmt.Sprintf("Address    : %s", header.Address),
+		fmt.Sprintf("User ID    : %s", header.UserID),
+		fmt.Sprintf("Wallet ID  : %s", header.WalletID),
+		"",
+		fmt.Sprintf("Opening balance: %s", header.OpeningBalance),
+		"",
+		fmt.Sprintf(pdfStatementRow, "Date", "Type", "Dir", "Status", "Remarks", "Amount", "Balance"),
+		strings.Repeat("-", pkg.PDFLineWidth),
+	)
+}
+
+func (s *pdfStatement) Row(row models.StatementRow) error {
+	return s.lines(
+		fmt.Sprintf(pdfStatementRow,
+			row.CreatedAt.Format(time.DateTime),
+			truncate(row.TransactionType, 8),
+			string(row.Direction),
+			string(row.Status),
+			truncate(row.Remarks, 24),
+			row.Amount,
+			runningBalance(row)),
+		"  "+row.ID,
+	)
+}
+
+func (s *pdfStatement) Footer(summary *models.StatementSummary) error {
+	lines := []string{strings.Repeat("-", pkg.PDFLineWidth), "", "Totals by type"}
+	for _, total := range summary.Totals {
+		lines = append(lines, fmt.Sprintf("  %-10s %-3s %6d transactions %20s", total.TransactionType, total.Direction, total.Count, total.Amount))
+	}
+	lines = append(lines,
+		"",
+		fmt.Sprintf("Total in        : %s", summary.TotalIn),
+		fmt.Sprintf("Total out       : %s", summary.TotalOut),
+		fmt.Sprintf("Opening balance : %s", summary.OpeningBalance),
+		fmt.Sprintf("Closing balance : %s", summary.ClosingBalance),
+	)
+	return s.lines(lines...)
+}
+
+// runningBalance formats the balance after a row, blank for rows that did not move it
+func runningBalance(row models.StatementRow) string {
+	if row.RunningBalance == nil {
+		return ""
+	}
+	return row.RunningBalance.String()
+}
+
+// truncate shortens s to n characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "~"
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/pkg"
+)
+
+func TestCSVCellEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		want string
+	}{
+		{name: "plain text", cell: "Bayar listrik", want: "Bayar listrik"},
+		{name: "empty", cell: "", want: ""},
+		{name: "formula", cell: "=HYPERLINK(\"http://example.com\")", want: "'=HYPERLINK(\"http://example.com\")"},
+		{name: "plus", cell: "+1+1", want: "'+1+1"},
+		{name: "minus", cell: "-1+1", want: "'-1+1"},
+		{name: "at", cell: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "tab", cell: "\t=1", want: "'\t=1"},
+		{name: "carriage return", cell: "\r=1", want: "'\r=1"},
+		{name: "formula later in the cell", cell: "a=1", want: "a=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvCell(tt.cell); got != tt.want {
+				t.Errorf("csvCell(%q) = %q, want %q", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+// statementRows adds the transactions to a statement opened with opening and returns its rows
+func statementRows(opening pkg.Money, txs ...models.TransactionResponse) []models.StatementRow {
+	statement := models.NewStatement(opening)
+	rows := make([]models.StatementRow, len(txs))
+	for i, tx := range txs {
+		rows[i] = statement.Add(tx)
+	}
+	return rows
+}
+
+func statementTransaction(id string, status models.TransactionStatus, direction models.TransactionDirection, amount pkg.Money, remarks string) models.TransactionResponse {
+	return models.TransactionResponse{
+		ID:              id,
+		Status:          status,
+		TransactionType: "Transfer",
+		Direction:       direction,
+		Amount:          amount,
+		Remarks:         remarks,
+		CreatedAt:       time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestCSVStatementRows(t *testing.T) {
+	rows := statementRows(pkg.NewMoney(100, 0),
+		statementTransaction("tx-1", models.TransactionStatusSuccess, models.TransactionDirectionOut, pkg.NewMoney(30, 0), "=cmd|' /C calc'!A0"),
+		statementTransaction("tx-2", models.TransactionStatusPending, models.TransactionDirectionOut, pkg.NewMoney(20, 0), "pending"),
+		statementTransaction("tx-3", models.TransactionStatusFailed, models.TransactionDirectionIn, pkg.NewMoney(10, 0), "failed"),
+		statementTransaction("tx-4", models.TransactionStatusSuccess, models.TransactionDirectionIn, pkg.NewMoney(5, 50), "refund"),
+	)
+
+	var out bytes.Buffer
+	writer := &csvStatement{w: csv.NewWriter(&out)}
+	for _, row := range rows {
+		if err := writer.Row(row); err != nil {
+			t.Fatalf("write row: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+
+	want := [][]string{
+		{"2025-06-01 10:00:00", "tx-1", "Transfer", "OUT", "SUCCESS", "'=cmd|' /C calc'!A0", "30.00", "70.00"},
+		{"2025-06-01 10:00:00", "tx-2", "Transfer", "OUT", "PENDING", "pending", "20.00", ""},
+		{"2025-06-01 10:00:00", "tx-3", "Transfer", "IN", "FAILED", "failed", "10.00", ""},
+		{"2025-06-01 10:00:00", "tx-4", "Transfer", "IN", "SUCCESS", "refund", "5.50", "75.50"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("%d records, want %d: %q", len(records), len(want), records)
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("record %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestPDFStatement(t *testing.T) {
+	var out bytes.Buffer
+	writer := &pdfStatement{pdf: pkg.NewPDFWriter(&out)}
+
+	header := &models.StatementHeader{
+		Name:           "Budi (Test)",
+		From:           time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+		OpeningBalance: pkg.NewMoney(100, 0),
+	}
+	if err := writer.Header(header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+
+	statement := models.NewStatement(header.OpeningBalance)
+	txs := []models.TransactionResponse{
+		statementTransaction("tx-1", models.TransactionStatusSuccess, models.TransactionDirectionOut, pkg.NewMoney(30, 0), "lunch"),
+		statementTransaction("tx-2", models.TransactionStatusPending, models.TransactionDirectionOut, pkg.NewMoney(20, 0), "pending"),
+	}
+	for _, tx := range txs {
+		if err := writer.Row(statement.Add(tx)); err != nil {
+			t.Fatalf("row: %v", err)
+		}
+	}
+	if err := writer.Footer(statement.Summary()); err != nil {
+		t.Fatalf("footer: %v", err)
+	}
+	if err := writer.pdf.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	document := out.String()
+	if !strings.HasPrefix(document, "%PDF-1.4\n") || !strings.HasSuffix(document, "%%EOF\n") {
+		t.Fatalf("not a PDF document:\n%s", document)
+	}
+	for _, want := range []string{
+		`(Name       : Budi \(Test\)) Tj`,
+		"lunch                                 30.00              70.00) Tj",
+		"pending                               20.00                   ) Tj",
+		"(Closing balance : 70.00) Tj",
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("document does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/middlewares"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+const (
+	TransactionPinHeader = "X-Transaction-PIN"
+	StepUpTokenHeader    = "X-Step-Up-Token"
+)
+
+var (
+	ErrStepUpRequired     = apperrors.New(http.StatusForbidden, apperrors.CodeStepUpRequired, "PIN confirmation required for this amount")
+	ErrInvalidStepUpToken = apperrors.New(http.StatusForbidden, apperrors.CodeInvalidStepUpToken, "Invalid, used or expired step-up token")
+	ErrStepUpMismatch     = apperrors.New(http.StatusForbidden, apperrors.CodeInvalidStepUpToken, "Step-up token was issued for another amount or recipient")
+)
+
+// StepUpHandler confirms money movements above the configured threshold with the user's PIN,
+// given with the request or exchanged beforehand for a short-lived, single-use step-up token
+type StepUpHandler struct {
+	users  repositories.UserRepoInterface
+	pins   pinChecker
+	tokens *pkg.JwtUtil
+	config *config.Config
+}
+
+func NewStepUpHandler(
+	users repositories.UserRepoInterface,
+	throttle repositories.LoginThrottleRepoInterface,
+	hasher *pkg.Hasher,
+	tokens *pkg.JwtUtil,
+) *StepUpHandler {
+	return &StepUpHandler{
+		users:  users,
+		pins:   newPinChecker(throttle, hasher),
+		tokens: tokens,
+		config: config.GetConfig(),
+	}
+}
+
+// Verify exchanges the PIN for a step-up token of the calling session, good for the payment or
+// transfer named in the request
+func (s *StepUpHandler) Verify(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+	sessionID, _ := middlewares.GetSessionID(c)
+
+	var req models.StepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	if err := s.checkPin(c, userID, req.Pin); err != nil {
+		response.Error(err)
+		return
+	}
+
+	token, err := s.tokens.GenerateStepUpToken(userID, sessionID, uuid.NewString(), req.Amount, req.TargetUser, s.config.StepUp.TokenExpiry)
+	if err != nil {
+		response.Error(apperrors.Internal(err))
+		return
+	}
+
+	response.Success("", models.StepUpResponse{
+		StepUpToken: token,
+		ExpiresIn:   int(s.config.StepUp.TokenExpiry.Seconds()),
+	})
+}
+
+// require lets amounts up to the threshold through, larger ones need the PIN header or a
+// step-up token issued to the same session for this amount and recipient, recipientID is empty
+// for payments. It returns the claim of the token, which the repository spends only when the
+// money movement commits, nil when no token was used.
+func (s *StepUpHandler) require(c *gin.Context, userID string, amount pkg.Money, recipientID string) (*models.StepUpClaim, error) {
+	if amount <= s.config.StepUp.Threshold {
+		return nil, nil
+	}
+
+	if token := c.GetHeader(StepUpTokenHeader); token != "" {
+		claims, err := s.tokens.ValidateStepUpToken(token)
+		if err != nil {
+			return nil, ErrInvalidStepUpToken.Wrap(err)
+		}
+		sessionID, _ := middlewares.GetSessionID(c)
+		if claims.UserID != userID || claims.SessionID != sessionID || claims.ID == "" {
+			return nil, ErrInvalidStepUpToken
+		}
+		if claims.Amount != amount || claims.RecipientID != recipientID {
+			return nil, ErrStepUpMismatch
+		}
+		return &models.StepUpClaim{
+			JTI:       claims.ID,
+			UserID:    userID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}, nil
+	}
+
+	if pin := c.GetHeader(TransactionPinHeader); pin != "" {
+		return nil, s.checkPin(c, userID, pin)
+	}
+
+	return nil, ErrStepUpRequired
+}
+
+func (s *StepUpHandler) checkPin(c *gin.Context, userID, pin string) error {
+	user, err := s.users.GetUserByID(c, userID)
+	if err != nil {
+		return err
+	}
+	return s.pins.check(c, user, pin)
+}
@@ -1,24 +1,25 @@
 package handlers
 
 import (
-	"context"
-	"errors"
-	"log"
-	"strings"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
 	"github.com/redha28/foomlet/internal/middlewares"
 	"github.com/redha28/foomlet/internal/models"
 	"github.com/redha28/foomlet/internal/repositories"
-	"github.com/redha28/foomlet/pkg"
 )
 
+// ErrSelfTransfer is returned when the target of a transfer is the sender
+var ErrSelfTransfer = apperrors.New(http.StatusUnprocessableEntity, apperrors.CodeSelfTransfer, "Cannot transfer to yourself")
+
 type TransactionHandler struct {
-	repo repositories.TransactionRepoInterface
+	repo   repositories.TransactionRepoInterface
+	stepUp *StepUpHandler
 }
 
-func NewTransactionHandler(repo repositories.TransactionRepoInterface) *TransactionHandler {
-	return &TransactionHandler{repo: repo}
+func NewTransactionHandler(repo repositories.TransactionRepoInterface, stepUp *StepUpHandler) *TransactionHandler {
+	return &TransactionHandler{repo: repo, stepUp: stepUp}
 }
 
 func (h *TransactionHandler) TopUp(c *gin.Context) {
@@ -27,35 +28,33 @@ func (h *TransactionHandler) TopUp(c *gin.Context) {
 	// Get user ID from context
 	userID, exists := middlewares.GetUserID(c)
 	if !exists {
-		response.Unauthorized("User not authenticated", nil)
+		response.Error(apperrors.ErrUnauthorized)
 		return
 	}
 
 	// Parse request
 	var req models.TopUpRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		response.BadRequest("Invalid input", err.Error())
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
 
-	// Validate amount
-	if req.Amount <= 0 {
-		response.BadRequest("Amount must be greater than 0", nil)
+	// A retry with the same Idempotency-Key must find this top-up
+	idempotency, err := middlewares.GetIdempotencyClaim(c)
+	if err != nil {
+		response.Error(apperrors.Internal(err))
 		return
 	}
 
 	// Process top-up
-	result, err := h.repo.TopUp(c, userID, req.Amount)
+	result, err := h.repo.TopUp(c, userID, req.Amount, idempotency)
 	if err != nil {
-		response.InternalServerError("Failed to process top-up", err.Error())
+		response.Error(err)
 		return
 	}
 
 	// Return success response
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": result,
-	})
+	response.Success("", result)
 }
 
 func (h *TransactionHandler) Payment(c *gin.Context) {
@@ -64,44 +63,40 @@ func (h *TransactionHandler) Payment(c *gin.Context) {
 	// Get user ID from context
 	userID, exists := middlewares.GetUserID(c)
 	if !exists {
-		response.Unauthorized("User not authenticated", nil)
+		response.Error(apperrors.ErrUnauthorized)
 		return
 	}
 
 	// Parse request
 	var req models.PaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		response.BadRequest("Invalid input", err.Error())
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
 
-	// Validate amount and remarks
-	if req.Amount <= 0 {
-		response.BadRequest("Amount must be greater than 0", nil)
+	// A retry with the same Idempotency-Key must find this payment
+	idempotency, err := middlewares.GetIdempotencyClaim(c)
+	if err != nil {
+		response.Error(apperrors.Internal(err))
 		return
 	}
 
-	if req.Remarks == "" {
-		response.BadRequest("Remarks cannot be empty", nil)
+	// Large payments need the PIN
+	stepUp, err := h.stepUp.require(c, userID, req.Amount, "")
+	if err != nil {
+		response.Error(err)
 		return
 	}
 
 	// Process payment
-	result, err := h.repo.Payment(c, userID, req.Amount, req.Remarks)
+	result, err := h.repo.Payment(c, userID, req.Amount, req.Remarks, idempotency, stepUp)
 	if err != nil {
-		if strings.Contains(err.Error(), "saldo tidak cukup") {
-			response.BadRequest("Saldo tidak cukup", nil)
-			return
-		}
-		response.InternalServerError("Failed to process payment", err.Error())
+		response.Error(err)
 		return
 	}
 
 	// Return success response
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": result,
-	})
+	response.Success("", result)
 }
 
 func (h *TransactionHandler) GetAllTransactions(c *gin.Context) {
@@ -110,28 +105,38 @@ func (h *TransactionHandler) GetAllTransactions(c *gin.Context) {
 	// Get user ID from context
 	userID, exists := middlewares.GetUserID(c)
 	if !exists {
-		response.Unauthorized("User not authenticated", nil)
+		response.Error(apperrors.ErrUnauthorized)
 		return
 	}
 
-	// Get transactions
-	transactions, err := h.repo.GetUserTransactions(c, userID)
+	// Parse pagination and filters
+	var req models.TransactionHistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	filter, err := req.Filter()
 	if err != nil {
-		response.InternalServerError("Failed to get transactions", err.Error())
+		response.Error(err)
 		return
 	}
 
-	// Check if transactions are empty
-	if len(transactions) == 0 {
-		response.NotFound("No transactions found", nil)
+	// Get one page of transactions
+	transactions, nextCursor, err := h.repo.GetUserTransactions(c, userID, filter)
+	if err != nil {
+		response.Error(err)
 		return
 	}
 
+	// An empty page is a valid result, next_cursor is null on the last page
+	var next *string
+	if nextCursor != "" {
+		next = &nextCursor
+	}
+
 	// Return success response
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": transactions,
-	})
+	response.Page(transactions, models.PageMeta{NextCursor: next})
 }
 
 func (h *TransactionHandler) Transfer(c *gin.Context) {
@@ -140,85 +145,118 @@ func (h *TransactionHandler) Transfer(c *gin.Context) {
 	// Get user ID from context
 	userID, exists := middlewares.GetUserID(c)
 	if !exists {
-		response.Unauthorized("User not authenticated", nil)
+		response.Error(apperrors.ErrUnauthorized)
 		return
 	}
 
 	// Parse request
 	var req models.TransferRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		response.BadRequest("Invalid input", err.Error())
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
 
-	// Validate amount and remarks
-	if req.Amount <= 0 {
-		response.BadRequest("Amount must be greater than 0", nil)
+	// Don't allow transfers to self
+	if userID == req.TargetUser {
+		response.Error(ErrSelfTransfer)
 		return
 	}
 
-	// Don't allow transfers to self
-	if userID == req.TargetUser {
-		response.BadRequest("Cannot transfer to yourself", nil)
+	// A retry with the same Idempotency-Key must find this transfer
+	idempotency, err := middlewares.GetIdempotencyClaim(c)
+	if err != nil {
+		response.Error(apperrors.Internal(err))
+		return
+	}
+
+	// Large transfers need the PIN
+	stepUp, err := h.stepUp.require(c, userID, req.Amount, req.TargetUser)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	// Create transfer record and queue it through the outbox (this doesn't process the actual transfer yet)
+	result, err := h.repo.Transfer(c, userID, req.TargetUser, req.Amount, req.Remarks, idempotency, stepUp)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	// Return the PENDING transfer, clients poll GET /api/transfers/:id for the outcome
+	response.Success("", result)
+}
+
+func (h *TransactionHandler) GetTransfer(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user ID from context
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var param models.IDParam
+	if err := c.ShouldBindUri(&param); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
 
-	// Create transfer record (this doesn't process the actual transfer yet)
-	result, err := h.repo.Transfer(c, userID, req.TargetUser, req.Amount, req.Remarks)
+	// Only the sender or the recipient can see a transfer
+	result, err := h.repo.GetTransfer(c, userID, param.ID)
 	if err != nil {
-		if errors.Is(err, repositories.ErrInsufficientBalance) {
-			response.BadRequest("Saldo tidak cukup", nil)
-			return
-		}
-		if strings.Contains(err.Error(), "user not found") {
-			response.BadRequest("Recipient user not found", nil)
-			return
-		}
-		response.InternalServerError("Failed to process transfer", err.Error())
-		return
-	}
-
-	// Create transfer message
-	transferMsg := pkg.TransferMessage{
-		TransferID:  result.ID,
-		SenderID:    userID,
-		RecipientID: req.TargetUser,
-		Amount:      req.Amount,
-		Remarks:     req.Remarks,
-	}
-
-	// Try to publish to RabbitMQ, if not available process directly
-	rmqSuccess := false
-	if pkg.GlobalRabbitMQ != nil && pkg.GlobalRabbitMQ.IsReady() {
-		err := pkg.GlobalRabbitMQ.PublishTransfer(transferMsg)
-		if err == nil {
-			rmqSuccess = true
-			log.Println("Transfer queued successfully:", result.ID)
-		} else {
-			log.Printf("Failed to publish transfer message: %v", err)
-		}
-	}
-
-	// Process transfer directly if RabbitMQ failed or isn't available
-	if !rmqSuccess {
-		log.Println("Processing transfer synchronously:", result.ID)
-
-		// Create a copy of the context to prevent it from being canceled when request completes
-		bgCtx := context.Background()
-
-		// Process the transfer immediately
-		go func() {
-			if err := h.repo.ProcessTransfer(bgCtx, result.ID, userID, req.TargetUser, req.Amount, req.Remarks); err != nil {
-				log.Printf("Failed to process transfer: %v", err)
-			} else {
-				log.Println("Transfer processed successfully:", result.ID)
-			}
-		}()
-	}
-
-	// Return success response to the client
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": result,
-	})
+		response.Error(err)
+		return
+	}
+
+	// Return success response
+	response.Success("", result)
+}
+
+func (h *TransactionHandler) GetTransaction(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user ID from context
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var param models.IDParam
+	if err := c.ShouldBindUri(&param); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	// Only the owner of the wallet or the other side of the transfer can see a transaction
+	result, err := h.repo.GetTransactionDetail(c, userID, param.ID)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	// Return success response
+	response.Success("", result)
+}
+
+func (h *TransactionHandler) GetWallet(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user ID from context
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	summary, err := h.repo.GetWalletSummary(c, userID)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	// Clients polling the summary send If-None-Match and get a 304 while nothing changed
+	response.Cached("", summary)
 }
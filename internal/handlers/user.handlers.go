@@ -1,25 +1,57 @@
 package handlers
 
 import (
-	"strings"
+	"errors"
+	"fmt"
+	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/apperrors"
 	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/i18n"
 	"github.com/redha28/foomlet/internal/middlewares"
 	"github.com/redha28/foomlet/internal/models"
 	"github.com/redha28/foomlet/internal/repositories"
 	"github.com/redha28/foomlet/pkg"
 )
 
+// oneTimeCodeDigits is the length of the codes sent to the user's phone
+const oneTimeCodeDigits = 6
+
 type UserHandler struct {
-	repo   repositories.UserRepoInterface
-	config *config.Config
+	repo     repositories.UserRepoInterface
+	sessions repositories.SessionRepoInterface
+	throttle repositories.LoginThrottleRepoInterface
+	codes    repositories.OneTimeCodeRepoInterface
+	notifier pkg.Notifier
+	hasher   *pkg.Hasher
+	tokens   *pkg.JwtUtil
+	config   *config.Config
+	pins     pinChecker
 }
 
-func NewUserHandler(repo repositories.UserRepoInterface) *UserHandler {
+func NewUserHandler(
+	repo repositories.UserRepoInterface,
+	sessions repositories.SessionRepoInterface,
+	throttle repositories.LoginThrottleRepoInterface,
+	codes repositories.OneTimeCodeRepoInterface,
+	notifier pkg.Notifier,
+	hasher *pkg.Hasher,
+	tokens *pkg.JwtUtil,
+) *UserHandler {
+	cfg := config.GetConfig()
 	return &UserHandler{
-		repo:   repo,
-		config: config.GetConfig(),
+		repo:     repo,
+		sessions: sessions,
+		throttle: throttle,
+		codes:    codes,
+		notifier: notifier,
+		hasher:   hasher,
+		tokens:   tokens,
+		config:   cfg,
+		pins:     newPinChecker(throttle, hasher),
 	}
 }
 
@@ -28,92 +60,82 @@ func (u *UserHandler) Login(c *gin.Context) {
 	response := models.NewResponse(c)
 
 	if err := c.ShouldBindJSON(&loginReq); err != nil {
-		if strings.Contains(err.Error(), "Field validation for 'Pin'") {
-			response.BadRequest("Pin length must be exactly 6 characters", err.Error())
-			return
-		}
-		response.BadRequest("Invalid input", err.Error())
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	// Refuse the attempt while the phone number or IP is locked out or has to wait
+	attempt := models.LoginAttempt{Phone: loginReq.Phone, Device: deviceInfo(c)}
+	if err := u.throttle.BeginAttempt(c, attempt, u.pins.phonePolicy, u.pins.ipPolicy); err != nil {
+		response.Error(err)
 		return
 	}
 
 	// Fetch user from repository
 	user, err := u.repo.GetUserByPhone(c, loginReq.Phone)
-	if err != nil {
-		response.Unauthorized("Invalid credentials", "Phone Number dan PIN tidak cocok")
+	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+		response.Error(err)
 		return
 	}
 
-	// Check password/PIN
-	hash := pkg.InitHashConfig()
-	hash.UseDefaultConfig()
-	isValid, err := hash.CompareHashAndPassword(user.Pin, loginReq.Pin)
+	// Check password/PIN, unknown phone numbers take as long as a wrong PIN
+	isValid := false
+	if user != nil {
+		attempt.UserID = &user.ID
+		isValid, err = u.hasher.Compare(c.Request.Context(), user.Pin, loginReq.Pin)
+	} else {
+		err = u.hasher.CompareDummy(c.Request.Context(), loginReq.Pin)
+	}
 	if err != nil {
-		response.InternalServerError("Failed to verify PIN", err.Error())
+		response.Error(apperrors.Internal(err))
 		return
 	}
 	if !isValid {
-		response.Unauthorized("Invalid credentials", "Phone Number dan PIN tidak cocok")
+		// Unknown phone numbers are counted too, so they cannot be told apart
+		if err := u.throttle.RecordFailure(c, attempt, u.pins.phonePolicy, u.pins.ipPolicy); err != nil {
+			response.Error(err)
+			return
+		}
+		response.Error(apperrors.ErrInvalidCredentials)
 		return
 	}
 
-	// Generate JWT tokens using config values
-	jwtUtil := pkg.NewJwtUtil(
-		u.config.JWT.AccessSecret,
-		u.config.JWT.RefreshSecret,
-		u.config.JWT.AccessExpiry,
-		u.config.JWT.RefreshExpiry,
-	)
-
-	accessToken, err := jwtUtil.GenerateAccessToken(user.ID)
-	if err != nil {
-		response.InternalServerError("Failed to generate token", err.Error())
+	if err := u.throttle.RecordSuccess(c, attempt); err != nil {
+		response.Error(err)
 		return
 	}
 
-	refreshToken, err := jwtUtil.GenerateRefreshToken(user.ID)
+	// Bring the stored hash up to the current argon2 parameters while the PIN is at hand
+	u.rehashPin(c, user, loginReq.Pin)
+
+	tokens, err := u.startSession(c, user.ID)
 	if err != nil {
-		response.InternalServerError("Failed to generate refresh token", err.Error())
+		response.Error(err)
 		return
 	}
 
 	// Return response
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": models.TokenResponse{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-		},
-	})
+	response.Success("", tokens)
 }
 
 func (u *UserHandler) Register(c *gin.Context) {
 	var userReq models.UserRegist
 	response := models.NewResponse(c)
 	if err := c.ShouldBindJSON(&userReq); err != nil {
-		if strings.Contains(err.Error(), "Field validation for 'Pin'") {
-			response.BadRequest("Pin length must be exactly 6 characters", err.Error())
-			return
-		}
-		response.BadRequest("Invalid input", err.Error())
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
-	hash := pkg.InitHashConfig()
-	hash.UseDefaultConfig()
-	hadhedPin, err := hash.GenHashedPassword(userReq.Pin)
+	hashedPin, err := u.hasher.Hash(c.Request.Context(), userReq.Pin)
 	if err != nil {
-		response.BadRequest("Failed to hash password", err.Error())
+		response.Error(apperrors.Internal(err))
 		return
 	}
-	result, err := u.repo.UseRegister(c, userReq, hadhedPin)
+	result, err := u.repo.UseRegister(c, userReq, hashedPin)
 	if err != nil {
-		if strings.Contains(err.Error(), "user already exists") {
-			response.BadRequest("User already exists", err.Error())
-			return
-		}
-		response.InternalServerError("Failed to register user", err.Error())
+		response.Error(err)
 		return
 	}
-	response.Created("User registered successfully", result)
+	response.Created(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgUserRegistered), result)
 }
 
 func (u *UserHandler) UpdateProfile(c *gin.Context) {
@@ -122,39 +144,26 @@ func (u *UserHandler) UpdateProfile(c *gin.Context) {
 	// Get user ID from the context (set by AuthMiddleware)
 	userID, exists := middlewares.GetUserID(c)
 	if !exists {
-		response.Unauthorized("User not authenticated", nil)
+		response.Error(apperrors.ErrUnauthorized)
 		return
 	}
 
 	// Parse request body
 	var updateReq models.UpdateProfileRequest
 	if err := c.ShouldBindJSON(&updateReq); err != nil {
-		response.BadRequest("Invalid input", err.Error())
-		return
-	}
-
-	// Validate required fields
-	if updateReq.Firstname == "" || updateReq.Lastname == "" {
-		response.BadRequest("Nama Firstname atau Lastname tidak boleh kosong", nil)
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
 
 	// Call repository to update profile
 	result, err := u.repo.UpdateUserProfile(c, userID, updateReq)
 	if err != nil {
-		if strings.Contains(err.Error(), "user not found") {
-			response.NotFound("User not found", err.Error())
-			return
-		}
-		response.InternalServerError("Failed to update profile", err.Error())
+		response.Error(err)
 		return
 	}
 
 	// Return success response
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": result,
-	})
+	response.Success("", result)
 }
 
 func (u *UserHandler) RefreshToken(c *gin.Context) {
@@ -162,37 +171,346 @@ func (u *UserHandler) RefreshToken(c *gin.Context) {
 	response := models.NewResponse(c)
 
 	if err := c.ShouldBindJSON(&refreshReq); err != nil {
-		response.BadRequest("Invalid input", err.Error())
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
 		return
 	}
 
-	// Validate refresh token using config values
-	jwtUtil := pkg.NewJwtUtil(
-		u.config.JWT.AccessSecret,
-		u.config.JWT.RefreshSecret,
-		u.config.JWT.AccessExpiry,
-		u.config.JWT.RefreshExpiry,
-	)
+	// Validate refresh token
+	claims, err := u.tokens.ValidateRefreshToken(refreshReq.RefreshToken)
+	if err != nil {
+		response.Error(apperrors.ErrInvalidToken.Wrap(err))
+		return
+	}
+	if _, err := uuid.Parse(claims.ID); err != nil {
+		response.Error(apperrors.ErrInvalidToken.Wrap(err))
+		return
+	}
 
-	claims, err := jwtUtil.ValidateRefreshToken(refreshReq.RefreshToken)
+	// Use up the presented token, the response carries its successor
+	jti := uuid.NewString()
+	session, err := u.sessions.Rotate(c, claims.ID, jti, time.Now().Add(u.config.JWT.RefreshExpiry),
+		u.config.JWT.SessionLifetime, deviceInfo(c))
 	if err != nil {
-		response.Unauthorized("Invalid refresh token", err.Error())
+		response.Error(err)
 		return
 	}
 
-	// Generate new access token
-	accessToken, err := jwtUtil.GenerateAccessToken(claims.UserID)
+	tokens, err := u.issueTokens(claims.UserID, session.ID, jti)
 	if err != nil {
-		response.InternalServerError("Failed to generate token", err.Error())
+		response.Error(apperrors.Internal(err))
 		return
 	}
 
 	// Return response
-	c.JSON(200, gin.H{
-		"status": "SUCCESS",
-		"result": models.TokenResponse{
-			AccessToken:  accessToken,
-			RefreshToken: refreshReq.RefreshToken,
-		},
+	response.Success("", tokens)
+}
+
+// Logout ends the session of the access token, its refresh token stops working too
+func (u *UserHandler) Logout(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+	sessionID, _ := middlewares.GetSessionID(c)
+
+	if err := u.sessions.Revoke(c, userID, sessionID, models.SessionRevokedLogout); err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgLoggedOut), nil)
+}
+
+// LogoutAll ends every session of the user, including the current one
+func (u *UserHandler) LogoutAll(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	revoked, err := u.sessions.RevokeAll(c, userID, models.SessionRevokedLogoutAll)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgLoggedOutAll), models.LogoutAllResponse{
+		RevokedSessions: revoked,
 	})
 }
+
+// RequestUnlockCode sends a code that lifts the lockout of a phone number. The answer is the
+// same whether or not the number exists or is locked.
+func (u *UserHandler) RequestUnlockCode(c *gin.Context) {
+	response := models.NewResponse(c)
+	lang := middlewares.GetLanguage(c)
+
+	var req models.UnlockCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	// Every request counts against the IP, whichever number it names
+	if err := u.throttle.CountCodeRequest(c, deviceInfo(c), u.pins.ipPolicy); err != nil {
+		response.Error(err)
+		return
+	}
+
+	if err := u.sendUnlockCode(c, req.Phone, lang); err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(lang, i18n.MsgUnlockCodeSent), nil)
+}
+
+func (u *UserHandler) sendUnlockCode(c *gin.Context, phone string, lang i18n.Language) error {
+	locked, err := u.throttle.IsLocked(c, phone)
+	if err != nil || !locked {
+		return err
+	}
+
+	user, err := u.repo.GetUserByPhone(c, phone)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return u.sendCode(c, user, models.OneTimeCodeUnlock, i18n.MsgUnlockCodeMessage, lang)
+}
+
+// sendCode sends the user a new one-time code for purpose, message is formatted with the code.
+// A code requested again too soon is not sent, the previous one is still valid.
+func (u *UserHandler) sendCode(c *gin.Context, user *models.User, purpose models.OneTimeCodePurpose, message i18n.Key, lang i18n.Language) error {
+	code, err := pkg.GenerateCode(oneTimeCodeDigits)
+	if err != nil {
+		return apperrors.Internal(err)
+	}
+
+	created, err := u.codes.Create(c, user.ID, purpose, pkg.HashCode(u.config.OTP.Secret, user.ID, code),
+		u.config.OTP.TTL, u.config.OTP.ResendInterval)
+	if err != nil || !created {
+		return err
+	}
+
+	return u.notifier.Send(c, user.Phone, fmt.Sprintf(i18n.Translate(lang, message), code))
+}
+
+// Unlock lifts the lockout of a phone number with the code sent to it
+func (u *UserHandler) Unlock(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	var req models.UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	user, err := u.repo.GetUserByPhone(c, req.Phone)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		response.Error(repositories.ErrInvalidCode)
+		return
+	}
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	err = u.codes.Consume(c, user.ID, models.OneTimeCodeUnlock, pkg.HashCode(u.config.OTP.Secret, user.ID, req.Code), u.config.OTP.MaxAttempts)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	if err := u.throttle.Unlock(c, req.Phone); err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgAccountUnlocked), nil)
+}
+
+// ChangePin replaces the PIN of the user after checking the current one. Every session is
+// revoked, the answer carries the tokens of a new session for the calling device.
+func (u *UserHandler) ChangePin(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	// Get user ID from the context (set by AuthMiddleware)
+	userID, exists := middlewares.GetUserID(c)
+	if !exists {
+		response.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var req models.ChangePinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	user, err := u.repo.GetUserByID(c, userID)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	// Wrong PINs count toward the lockout of the phone number like failed logins
+	if err := u.pins.check(c, user, req.OldPin); err != nil {
+		response.Error(err)
+		return
+	}
+
+	hashedPin, err := u.hasher.Hash(c.Request.Context(), req.NewPin)
+	if err != nil {
+		response.Error(apperrors.Internal(err))
+		return
+	}
+	if err := u.repo.UpdatePin(c, userID, hashedPin, models.SessionRevokedPinChange); err != nil {
+		response.Error(err)
+		return
+	}
+
+	tokens, err := u.startSession(c, userID)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgPinChanged), tokens)
+}
+
+// RequestPinResetCode sends a code to reset a forgotten PIN. The answer is the same whether
+// or not the number exists.
+func (u *UserHandler) RequestPinResetCode(c *gin.Context) {
+	response := models.NewResponse(c)
+	lang := middlewares.GetLanguage(c)
+
+	var req models.PinResetCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	// Every request counts against the IP, whichever number it names
+	if err := u.throttle.CountCodeRequest(c, deviceInfo(c), u.pins.ipPolicy); err != nil {
+		response.Error(err)
+		return
+	}
+
+	user, err := u.repo.GetUserByPhone(c, req.Phone)
+	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+		response.Error(err)
+		return
+	}
+	if user != nil {
+		if err := u.sendCode(c, user, models.OneTimeCodePinReset, i18n.MsgPinResetCodeMessage, lang); err != nil {
+			response.Error(err)
+			return
+		}
+	}
+
+	response.Success(i18n.Translate(lang, i18n.MsgPinResetCodeSent), nil)
+}
+
+// ResetPin sets a new PIN with the code sent to the phone number. Every session is revoked
+// and a lockout of the number is lifted.
+func (u *UserHandler) ResetPin(c *gin.Context) {
+	response := models.NewResponse(c)
+
+	var req models.PinResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(apperrors.ErrInvalidInput.Wrap(err))
+		return
+	}
+
+	user, err := u.repo.GetUserByPhone(c, req.Phone)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		response.Error(repositories.ErrInvalidCode)
+		return
+	}
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	err = u.codes.Consume(c, user.ID, models.OneTimeCodePinReset, pkg.HashCode(u.config.OTP.Secret, user.ID, req.Code), u.config.OTP.MaxAttempts)
+	if err != nil {
+		response.Error(err)
+		return
+	}
+
+	hashedPin, err := u.hasher.Hash(c.Request.Context(), req.NewPin)
+	if err != nil {
+		response.Error(apperrors.Internal(err))
+		return
+	}
+	if err := u.repo.UpdatePin(c, user.ID, hashedPin, models.SessionRevokedPinReset); err != nil {
+		response.Error(err)
+		return
+	}
+	if err := u.throttle.Unlock(c, req.Phone); err != nil {
+		response.Error(err)
+		return
+	}
+
+	response.Success(i18n.Translate(middlewares.GetLanguage(c), i18n.MsgPinReset), nil)
+}
+
+// startSession starts a session for the calling device with its own refresh token family
+func (u *UserHandler) startSession(c *gin.Context, userID string) (*models.TokenResponse, error) {
+	jti := uuid.NewString()
+	expiresAt := time.Now().Add(min(u.config.JWT.RefreshExpiry, u.config.JWT.SessionLifetime))
+	session, err := u.sessions.Create(c, userID, jti, expiresAt, deviceInfo(c))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := u.issueTokens(userID, session.ID, jti)
+	if err != nil {
+		return nil, apperrors.Internal(err)
+	}
+	return tokens, nil
+}
+
+// rehashPin replaces a hash made with old parameters, a failure only means it is tried again
+// on the next login
+func (u *UserHandler) rehashPin(c *gin.Context, user *models.User, pin string) {
+	if !u.hasher.NeedsRehash(user.Pin) {
+		return
+	}
+
+	hashedPin, err := u.hasher.Hash(c.Request.Context(), pin)
+	if err == nil {
+		err = u.repo.RehashPin(c, user.ID, user.Pin, hashedPin)
+	}
+	if err != nil {
+		log.Printf("Failed to rehash PIN of user %s: %v", user.ID, err)
+	}
+}
+
+// issueTokens signs an access token and the refresh token jti of the session
+func (u *UserHandler) issueTokens(userID, sessionID, jti string) (*models.TokenResponse, error) {
+	accessToken, err := u.tokens.GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := u.tokens.GenerateRefreshToken(userID, sessionID, jti)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package i18n
+
+// catalog holds every message by language, a key missing from a language falls back to English
+var catalog = map[Language]map[Key]string{
+	English: {
+		"INVALID_INPUT":               "Invalid input",
+		"INVALID_CURSOR":              "Invalid cursor",
+		"INVALID_DATE":                "Dates must be YYYY-MM-DD or RFC 3339",
+		"INVALID_DATE_RANGE":          "The start date must not be after the end date",
+		"INVALID_AMOUNT_RANGE":        "Invalid amount range",
+		"INVALID_IDEMPOTENCY_KEY":     "Idempotency-Key must be at most 255 characters",
+		"UNAUTHORIZED":                "User not authenticated",
+		"INVALID_CREDENTIALS":         "Phone number and PIN do not match",
+		"INVALID_TOKEN":               "Invalid or expired token",
+		"SESSION_REVOKED":             "Session has ended, please log in again",
+		"REFRESH_TOKEN_REUSED":        "This refresh token was already used, please log in again",
+		"ACCOUNT_LOCKED":              "Too many failed attempts, the account is temporarily locked",
+		"TOO_MANY_ATTEMPTS":           "Too many failed attempts, try again later",
+		"INVALID_CODE":                "Invalid or expired code",
+		"INVALID_PIN":                 "PIN is incorrect",
+		"STEP_UP_REQUIRED":            "Confirm this transaction with your PIN",
+		"INVALID_STEP_UP_TOKEN":       "PIN confirmation is invalid, already used or has expired, enter your PIN again",
+		"FORBIDDEN":                   "Forbidden",
+		"ROUTE_NOT_FOUND":             "Route not found",
+		"USER_NOT_FOUND":              "User not found",
+		"RECIPIENT_NOT_FOUND":         "Recipient user not found",
+		"WALLET_NOT_FOUND":            "Wallet not found",
+		"TRANSFER_NOT_FOUND":          "Transfer not found",
+		"TRANSACTION_NOT_FOUND":       "Transaction not found",
+		"SESSION_NOT_FOUND":           "Session not found",
+		"USER_ALREADY_EXISTS":         "User already exists",
+		"IDEMPOTENCY_KEY_REUSED":      "Idempotency-Key already used for a different request",
+		"IDEMPOTENCY_KEY_IN_PROGRESS": "A request with this Idempotency-Key is still being processed",
+		"INSUFFICIENT_BALANCE":        "Insufficient balance",
+		"LIMIT_EXCEEDED":              "Transaction limit exceeded",
+		"SELF_TRANSFER":               "Cannot transfer to yourself",
+		"SERVICE_UNAVAILABLE":         "Service unavailable",
+		"INTERNAL_ERROR":              "Internal server error",
+		MsgUserRegistered:             "User registered successfully",
+		MsgLoggedOut:                  "Logged out",
+		MsgLoggedOutAll:               "Logged out from all devices",
+		MsgSessionRevoked:             "Session revoked",
+		MsgUnlockCodeSent:             "If the account is locked, an unlock code has been sent to its phone number",
+		MsgUnlockCodeMessage:          "Your Foomlet unlock code is %s. Never share it with anyone.",
+		MsgAccountUnlocked:            "Account unlocked, you can log in again",
+		MsgPinChanged:                 "PIN changed, other devices have been logged out",
+		MsgPinResetCodeSent:           "If the phone number is registered, a PIN reset code has been sent to it",
+		MsgPinResetCodeMessage:        "Your Foomlet PIN reset code is %s. Never share it with anyone.",
+		MsgPinReset:                   "PIN reset, please log in with the new PIN",
+	},
+	Indonesian: {
+		"INVALID_INPUT":               "Input tidak valid",
+		"INVALID_CURSOR":              "Cursor tidak valid",
+		"INVALID_DATE":                "Tanggal harus berformat YYYY-MM-DD atau RFC 3339",
+		"INVALID_DATE_RANGE":          "Tanggal awal tidak boleh setelah tanggal akhir",
+		"INVALID_AMOUNT_RANGE":        "Rentang nominal tidak valid",
+		"INVALID_IDEMPOTENCY_KEY":     "Idempotency-Key maksimal 255 karakter",
+		"UNAUTHORIZED":                "Pengguna belum terautentikasi",
+		"INVALID_CREDENTIALS":         "Nomor telepon dan PIN tidak cocok",
+		"INVALID_TOKEN":               "Token tidak valid atau sudah kedaluwarsa",
+		"SESSION_REVOKED":             "Sesi telah berakhir, silakan masuk kembali",
+		"REFRESH_TOKEN_REUSED":        "Refresh token ini sudah pernah dipakai, silakan masuk kembali",
+		"ACCOUNT_LOCKED":              "Terlalu banyak percobaan gagal, akun dikunci sementara",
+		"TOO_MANY_ATTEMPTS":           "Terlalu banyak percobaan gagal, coba lagi nanti",
+		"INVALID_CODE":                "Kode tidak valid atau sudah kedaluwarsa",
+		"INVALID_PIN":                 "PIN salah",
+		"STEP_UP_REQUIRED":            "Konfirmasi transaksi ini dengan PIN Anda",
+		"INVALID_STEP_UP_TOKEN":       "Konfirmasi PIN tidak valid, sudah dipakai atau sudah kedaluwarsa, masukkan PIN Anda lagi",
+		"FORBIDDEN":                   "Akses ditolak",
+		"ROUTE_NOT_FOUND":             "Rute tidak ditemukan",
+		"USER_NOT_FOUND":              "Pengguna tidak ditemukan",
+		"RECIPIENT_NOT_FOUND":         "Pengguna penerima tidak ditemukan",
+		"WALLET_NOT_FOUND":            "Dompet tidak ditemukan",
+		"TRANSFER_NOT_FOUND":          "Transfer tidak ditemukan",
+		"TRANSACTION_NOT_FOUND":       "Transaksi tidak ditemukan",
+		"SESSION_NOT_FOUND":           "Sesi tidak ditemukan",
+		"USER_ALREADY_EXISTS":         "Pengguna sudah terdaftar",
+		"IDEMPOTENCY_KEY_REUSED":      "Idempotency-Key sudah dipakai untuk permintaan lain",
+		"IDEMPOTENCY_KEY_IN_PROGRESS": "Permintaan dengan Idempotency-Key ini masih diproses",
+		"INSUFFICIENT_BALANCE":        "Saldo tidak cukup",
+		"LIMIT_EXCEEDED":              "Batas transaksi terlampaui",
+		"SELF_TRANSFER":               "Tidak dapat transfer ke diri sendiri",
+		"SERVICE_UNAVAILABLE":         "Layanan tidak tersedia",
+		"INTERNAL_ERROR":              "Terjadi kesalahan pada server",
+		MsgUserRegistered:             "Pengguna berhasil didaftarkan",
+		MsgLoggedOut:                  "Berhasil keluar",
+		MsgLoggedOutAll:               "Berhasil keluar dari semua perangkat",
+		MsgSessionRevoked:             "Sesi berhasil diakhiri",
+		MsgUnlockCodeSent:             "Jika akun terkunci, kode buka kunci telah dikirim ke nomor teleponnya",
+		MsgUnlockCodeMessage:          "Kode buka kunci Foomlet Anda adalah %s. Jangan berikan kode ini kepada siapa pun.",
+		MsgAccountUnlocked:            "Akun berhasil dibuka, silakan masuk kembali",
+		MsgPinChanged:                 "PIN berhasil diubah, perangkat lain telah dikeluarkan",
+		MsgPinResetCodeSent:           "Jika nomor telepon terdaftar, kode reset PIN telah dikirim ke nomor tersebut",
+		MsgPinResetCodeMessage:        "Kode reset PIN Foomlet Anda adalah %s. Jangan berikan kode ini kepada siapa pun.",
+		MsgPinReset:                   "PIN berhasil direset, silakan masuk dengan PIN baru",
+	},
+}
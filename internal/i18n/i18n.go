@@ -0,0 +1,97 @@
+// Package i18n holds the messages shown to API clients in every supported language. The
+// language of a request is negotiated from its Accept-Language header.
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Language is a supported language, identified by its ISO 639-1 code
+type Language string
+
+const (
+	English    Language = "en"
+	Indonesian Language = "id"
+)
+
+// DefaultLanguage is used when a client accepts none of the supported languages
+const DefaultLanguage = English
+
+// Key identifies a message in the catalog, error messages use their error code as key
+type Key string
+
+// Messages that are not tied to an error code
+const (
+	MsgUserRegistered      Key = "USER_REGISTERED"
+	MsgLoggedOut           Key = "LOGGED_OUT"
+	MsgLoggedOutAll        Key = "LOGGED_OUT_ALL"
+	MsgSessionRevoked      Key = "SESSION_REVOKED_BY_USER"
+	MsgUnlockCodeSent      Key = "UNLOCK_CODE_SENT"
+	MsgUnlockCodeMessage   Key = "UNLOCK_CODE_MESSAGE"
+	MsgAccountUnlocked     Key = "ACCOUNT_UNLOCKED"
+	MsgPinChanged          Key = "PIN_CHANGED"
+	MsgPinResetCodeSent    Key = "PIN_RESET_CODE_SENT"
+	MsgPinResetCodeMessage Key = "PIN_RESET_CODE_MESSAGE"
+	MsgPinReset            Key = "PIN_RESET"
+)
+
+// aliases maps the primary language subtags we accept to a supported language
+var aliases = map[string]Language{
+	"en": English,
+	"id": Indonesian,
+	"in": Indonesian, // deprecated code for Indonesian, still sent by older Android versions
+}
+
+// Negotiate picks the supported language the client prefers the most from an
+// Accept-Language header such as "id-ID,id;q=0.9,en;q=0.8"
+func Negotiate(header string) Language {
+	type candidate struct {
+		lang    Language
+		quality float64
+		order   int
+	}
+
+	var candidates []candidate
+	for i, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		primary, _, _ := strings.Cut(tag, "-")
+		primary, _, _ = strings.Cut(primary, "_")
+		if lang, ok := aliases[strings.ToLower(primary)]; ok {
+			candidates = append(candidates, candidate{lang: lang, quality: quality, order: i})
+		}
+	}
+	if len(candidates) == 0 {
+		return DefaultLanguage
+	}
+
+	// Highest quality wins, ties go to the language listed first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	return candidates[0].lang
+}
+
+// Translate returns the message for key in lang, falling back to English and then to the key itself
+func Translate(lang Language, key Key) string {
+	if message, ok := catalog[lang][key]; ok {
+		return message
+	}
+	if message, ok := catalog[DefaultLanguage][key]; ok {
+		return message
+	}
+	return string(key)
+}
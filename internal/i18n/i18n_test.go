@@ -0,0 +1,71 @@
+package i18n
+
+import (
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   Language
+	}{
+		{name: "no header", header: "", want: English},
+		{name: "English", header: "en", want: English},
+		{name: "Indonesian", header: "id", want: Indonesian},
+		{name: "region falls back to the language", header: "id-ID", want: Indonesian},
+		{name: "underscore region", header: "id_ID", want: Indonesian},
+		{name: "case insensitive", header: "ID-id", want: Indonesian},
+		{name: "deprecated Indonesian code", header: "in-ID", want: Indonesian},
+		{name: "unknown language", header: "fr-FR", want: English},
+		{name: "unknown languages only", header: "fr, de;q=0.9", want: English},
+		{name: "wildcard", header: "*", want: English},
+		{name: "highest quality wins", header: "en;q=0.5, id;q=0.9", want: Indonesian},
+		{name: "unknown language preferred", header: "fr, id;q=0.8, en;q=0.7", want: Indonesian},
+		{name: "browser header", header: "id-ID,id;q=0.9,en-US;q=0.8,en;q=0.7", want: Indonesian},
+		{name: "tie goes to the first listed", header: "en;q=0.8, id;q=0.8", want: English},
+		{name: "missing quality counts as 1", header: "en;q=0.9, id", want: Indonesian},
+		{name: "refused language", header: "id;q=0, en;q=0.1", want: English},
+		{name: "malformed quality is skipped", header: "id;q=abc, en;q=0.5", want: English},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.header); got != tt.want {
+				t.Errorf("Negotiate(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name string
+		lang Language
+		key  Key
+		want string
+	}{
+		{name: "English", lang: English, key: "USER_NOT_FOUND", want: "User not found"},
+		{name: "Indonesian", lang: Indonesian, key: "INSUFFICIENT_BALANCE", want: "Saldo tidak cukup"},
+		{name: "unsupported language falls back to English", lang: "fr", key: "USER_NOT_FOUND", want: "User not found"},
+		{name: "unknown key", lang: Indonesian, key: "NO_SUCH_KEY", want: "NO_SUCH_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.lang, tt.key); got != tt.want {
+				t.Errorf("Translate(%s, %s) = %q, want %q", tt.lang, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogIsComplete(t *testing.T) {
+	for lang, messages := range catalog {
+		for key := range catalog[DefaultLanguage] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("%s has no message for %s", lang, key)
+			}
+		}
+	}
+}
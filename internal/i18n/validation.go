@@ -0,0 +1,56 @@
+package i18n
+
+import (
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	id_translations "github.com/go-playground/validator/v10/translations/id"
+)
+
+var universal = ut.New(en.New(), en.New(), id.New())
+
+// validatorExtras are rules used by our requests that the bundled translations miss
+var validatorExtras = map[Language]map[string]string{
+	Indonesian: {
+		"datetime": "{0} tidak sesuai dengan format {1}",
+	},
+}
+
+// RegisterValidator installs the validation messages of every supported language on v
+func RegisterValidator(v *validator.Validate) error {
+	registrations := map[Language]func(*validator.Validate, ut.Translator) error{
+		English:    en_translations.RegisterDefaultTranslations,
+		Indonesian: id_translations.RegisterDefaultTranslations,
+	}
+	for lang, register := range registrations {
+		trans, _ := universal.GetTranslator(string(lang))
+		if err := register(v, trans); err != nil {
+			return err
+		}
+		for tag, text := range validatorExtras[lang] {
+			err := v.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+				return trans.Add(tag, text, false)
+			}, translateWithParam)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TranslateField explains a failed validation rule in lang
+func TranslateField(lang Language, fieldErr validator.FieldError) string {
+	trans, _ := universal.GetTranslator(string(lang))
+	return fieldErr.Translate(trans)
+}
+
+func translateWithParam(trans ut.Translator, fieldErr validator.FieldError) string {
+	message, err := trans.T(fieldErr.Tag(), fieldErr.Field(), fieldErr.Param())
+	if err != nil {
+		return fieldErr.Error()
+	}
+	return message
+}
@@ -0,0 +1,62 @@
+package i18n
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type validatedRequest struct {
+	Phone  string `binding:"required"`
+	Pin    string `binding:"len=6"`
+	Amount int    `binding:"gt=0"`
+	From   string `binding:"datetime=2006-01-02"`
+	Format string `binding:"oneof=csv pdf"`
+}
+
+func TestTranslateField(t *testing.T) {
+	v := validator.New()
+	v.SetTagName("binding")
+	if err := RegisterValidator(v); err != nil {
+		t.Fatalf("register validator: %v", err)
+	}
+
+	var fieldErrs validator.ValidationErrors
+	if err := v.Struct(validatedRequest{Pin: "1", From: "yesterday", Format: "doc"}); !errors.As(err, &fieldErrs) {
+		t.Fatalf("validation error = %v, want field errors", err)
+	}
+	byTag := make(map[string]validator.FieldError)
+	for _, fieldErr := range fieldErrs {
+		byTag[fieldErr.Tag()] = fieldErr
+	}
+
+	tests := []struct {
+		tag  string
+		lang Language
+		want string
+	}{
+		{tag: "required", lang: English, want: "Phone is a required field"},
+		{tag: "required", lang: Indonesian, want: "Phone wajib diisi"},
+		{tag: "len", lang: English, want: "Pin must be 6 characters in length"},
+		{tag: "len", lang: Indonesian, want: "panjang Pin harus 6 karakter"},
+		{tag: "gt", lang: English, want: "Amount must be greater than 0"},
+		{tag: "gt", lang: Indonesian, want: "Amount harus lebih besar dari 0"},
+		{tag: "datetime", lang: English, want: "From does not match the 2006-01-02 format"},
+		{tag: "datetime", lang: Indonesian, want: "From tidak sesuai dengan format 2006-01-02"},
+		{tag: "oneof", lang: English, want: "Format must be one of [csv pdf]"},
+		{tag: "oneof", lang: Indonesian, want: "Format harus berupa salah satu dari [csv pdf]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+string(tt.lang), func(t *testing.T) {
+			fieldErr, ok := byTag[tt.tag]
+			if !ok {
+				t.Fatalf("no %s error", tt.tag)
+			}
+			if got := TranslateField(tt.lang, fieldErr); got != tt.want {
+				t.Errorf("TranslateField(%s) = %q, want %q", tt.lang, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,51 +4,58 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redha28/foomlet/internal/config"
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/apperrors"
 	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
 	"github.com/redha28/foomlet/pkg"
 )
 
-// AuthMiddleware checks if the request has a valid JWT token
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware checks if the request has a valid JWT token whose session was not revoked
+func AuthMiddleware(sessions repositories.SessionRepoInterface, tokens *pkg.JwtUtil) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		response := models.NewResponse(c)
 		authHeader := c.GetHeader("Authorization")
 
 		if authHeader == "" {
-			response.Unauthorized("Authorization header is required", nil)
+			response.Error(apperrors.ErrUnauthorized)
 			return
 		}
 
 		// Check if the header format is correct
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			response.Unauthorized("Invalid authorization format", "Authorization header must be Bearer {token}")
+			response.Error(apperrors.ErrInvalidToken.WithDetails("Authorization header must be Bearer {token}"))
 			return
 		}
 
 		tokenString := parts[1]
 
-		// Get configuration
-		cfg := config.GetConfig()
-
-		// Initialize JWT util with config values
-		jwtUtil := pkg.NewJwtUtil(
-			cfg.JWT.AccessSecret,
-			cfg.JWT.RefreshSecret,
-			cfg.JWT.AccessExpiry,
-			cfg.JWT.RefreshExpiry,
-		)
-
 		// Validate the token
-		claims, err := jwtUtil.ValidateAccessToken(tokenString)
+		claims, err := tokens.ValidateAccessToken(tokenString)
+		if err != nil {
+			response.Error(apperrors.ErrInvalidToken.Wrap(err))
+			return
+		}
+		if _, err := uuid.Parse(claims.SessionID); err != nil {
+			response.Error(apperrors.ErrInvalidToken.Wrap(err))
+			return
+		}
+
+		// Tokens stop working as soon as their session is logged out, the device list shows the last use
+		active, err := sessions.Touch(c, claims.SessionID)
 		if err != nil {
-			response.Unauthorized("Invalid or expired token", err.Error())
+			response.Error(apperrors.Internal(err))
+			return
+		}
+		if !active {
+			response.Error(repositories.ErrSessionNotActive)
 			return
 		}
 
-		// Set user ID in the context for use in handlers
+		// Set user and session ID in the context for use in handlers
 		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.SessionID)
 
 		c.Next()
 	}
@@ -63,3 +70,13 @@ func GetUserID(c *gin.Context) (string, bool) {
 
 	return userID.(string), true
 }
+
+// GetSessionID retrieves the session ID from the Gin context
+func GetSessionID(c *gin.Context) (string, bool) {
+	sessionID, exists := c.Get("sessionID")
+	if !exists {
+		return "", false
+	}
+
+	return sessionID.(string), true
+}
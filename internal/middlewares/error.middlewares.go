@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/i18n"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ErrorMiddleware turns the errors added with c.Error into the response envelope, in the language
+// of the request. Server errors are logged with their cause, clients only see the code and a generic message.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		appErr := apperrors.From(err)
+		lang := GetLanguage(c)
+		if appErr.Status >= http.StatusInternalServerError {
+			log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		} else if appErr.Details == nil {
+			appErr = appErr.WithDetails(clientErrorDetails(lang, errors.Unwrap(appErr)))
+		}
+
+		// Errors that ask the client to wait say for how long
+		if retry, ok := appErr.Details.(interface{ RetryAfterSeconds() int }); ok {
+			c.Header("Retry-After", strconv.Itoa(retry.RetryAfterSeconds()))
+		}
+
+		c.JSON(appErr.Status, models.NewErrorResponse(appErr, i18n.Translate(lang, i18n.Key(appErr.Code))))
+	}
+}
+
+// Recover answers a panic with the internal error envelope
+func Recover(c *gin.Context, recovered any) {
+	log.Printf("%s %s: panic: %v", c.Request.Method, c.Request.URL.Path, recovered)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, models.NewErrorResponse(apperrors.ErrInternal, i18n.Translate(GetLanguage(c), i18n.Key(apperrors.CodeInternal))))
+}
+
+// NotFound answers requests to unknown routes
+func NotFound(c *gin.Context) {
+	models.NewResponse(c).Error(apperrors.ErrRouteNotFound)
+}
+
+// clientErrorDetails explains the cause of a client error, validation failures are listed per field
+func clientErrorDetails(lang i18n.Language, cause error) any {
+	if cause == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(cause, &validationErrs) {
+		fields := make([]FieldError, len(validationErrs))
+		for i, fieldErr := range validationErrs {
+			fields[i] = FieldError{
+				Field:   fieldErr.Field(),
+				Rule:    fieldErr.Tag(),
+				Message: i18n.TranslateField(lang, fieldErr),
+			}
+		}
+		return fields
+	}
+
+	return cause.Error()
+}
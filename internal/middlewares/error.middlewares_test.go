@@ -0,0 +1,252 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/i18n"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+// errorRouter serves GET /fail behind the error middleware stack of the API, the handler fails with err
+func errorRouter(err error) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(LanguageMiddleware(), gin.CustomRecovery(Recover), ErrorMiddleware())
+	router.NoRoute(NotFound)
+	router.GET("/fail", func(c *gin.Context) {
+		models.NewResponse(c).Error(err)
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("secret panic")
+	})
+	return router
+}
+
+func get(router http.Handler, path, acceptLanguage string) (*httptest.ResponseRecorder, models.Response) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+func TestErrorMiddlewareEnvelope(t *testing.T) {
+	errTooManyAttempts := apperrors.New(http.StatusTooManyRequests, apperrors.CodeTooManyAttempts, "Too many failed attempts")
+
+	tests := []struct {
+		name           string
+		path           string
+		err            error
+		acceptLanguage string
+		wantStatus     int
+		wantCode       apperrors.Code
+		wantMessage    string
+		wantDetails    any
+	}{
+		{
+			name:        "client error",
+			path:        "/fail",
+			err:         apperrors.ErrForbidden,
+			wantStatus:  http.StatusForbidden,
+			wantCode:    apperrors.CodeForbidden,
+			wantMessage: "Forbidden",
+		},
+		{
+			name:           "client error in Indonesian",
+			path:           "/fail",
+			err:            apperrors.ErrForbidden,
+			acceptLanguage: "id-ID,id;q=0.9,en;q=0.8",
+			wantStatus:     http.StatusForbidden,
+			wantCode:       apperrors.CodeForbidden,
+			wantMessage:    "Akses ditolak",
+		},
+		{
+			name:        "client error explains its cause",
+			path:        "/fail",
+			err:         apperrors.ErrInvalidInput.Wrap(errors.New("amount is not a number")),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    apperrors.CodeInvalidInput,
+			wantMessage: "Invalid input",
+			wantDetails: "amount is not a number",
+		},
+		{
+			name:        "wrapped domain error",
+			path:        "/fail",
+			err:         fmt.Errorf("transfer: %w", apperrors.ErrForbidden),
+			wantStatus:  http.StatusForbidden,
+			wantCode:    apperrors.CodeForbidden,
+			wantMessage: "Forbidden",
+		},
+		{
+			name:        "unexpected error",
+			path:        "/fail",
+			err:         errors.New(`secret: relation "wallets" does not exist`),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    apperrors.CodeInternal,
+			wantMessage: "Internal server error",
+		},
+		{
+			name:        "internal error",
+			path:        "/fail",
+			err:         apperrors.Internal(errors.New("secret: connection refused")),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    apperrors.CodeInternal,
+			wantMessage: "Internal server error",
+		},
+		{
+			name:           "panic",
+			path:           "/panic",
+			acceptLanguage: "id",
+			wantStatus:     http.StatusInternalServerError,
+			wantCode:       apperrors.CodeInternal,
+			wantMessage:    "Terjadi kesalahan pada server",
+		},
+		{
+			name:        "unknown route",
+			path:        "/missing",
+			wantStatus:  http.StatusNotFound,
+			wantCode:    apperrors.CodeRouteNotFound,
+			wantMessage: "Route not found",
+		},
+		{
+			name:        "retry after",
+			path:        "/fail",
+			err:         errTooManyAttempts.WithDetails(models.NewRetryAfter(90 * time.Second)),
+			wantStatus:  http.StatusTooManyRequests,
+			wantCode:    apperrors.CodeTooManyAttempts,
+			wantMessage: "Too many failed attempts, try again later",
+			wantDetails: map[string]any{"retry_after_seconds": float64(90)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, response := get(errorRouter(tt.err), tt.path, tt.acceptLanguage)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if response.Status != models.ResponseStatusError {
+				t.Errorf("envelope status %q, want %q", response.Status, models.ResponseStatusError)
+			}
+			if response.Error == nil {
+				t.Fatalf("response %s has no error", recorder.Body)
+			}
+			if response.Error.Code != tt.wantCode {
+				t.Errorf("error code %s, want %s", response.Error.Code, tt.wantCode)
+			}
+			if response.Message != tt.wantMessage {
+				t.Errorf("message %q, want %q", response.Message, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(response.Error.Details, tt.wantDetails) {
+				t.Errorf("details %#v, want %#v", response.Error.Details, tt.wantDetails)
+			}
+			if strings.Contains(recorder.Body.String(), "secret") {
+				t.Errorf("response leaks the cause: %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestErrorMiddlewareRetryAfterHeader(t *testing.T) {
+	err := apperrors.New(http.StatusTooManyRequests, apperrors.CodeTooManyAttempts, "Too many failed attempts").
+		WithDetails(models.NewRetryAfter(1500 * time.Millisecond))
+	recorder, _ := get(errorRouter(err), "/fail", "")
+
+	if got := recorder.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+
+	recorder, _ = get(errorRouter(apperrors.ErrForbidden), "/fail", "")
+	if got := recorder.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q on an error without a wait", got)
+	}
+}
+
+func TestErrorMiddlewareListsInvalidFields(t *testing.T) {
+	v := validator.New()
+	v.SetTagName("binding")
+	if err := i18n.RegisterValidator(v); err != nil {
+		t.Fatalf("register validator: %v", err)
+	}
+	validationErr := v.Struct(struct {
+		Phone string `binding:"required"`
+		Pin   string `binding:"len=6"`
+	}{Pin: "1"})
+
+	tests := []struct {
+		acceptLanguage string
+		want           []FieldError
+	}{
+		{
+			acceptLanguage: "en",
+			want: []FieldError{
+				{Field: "Phone", Rule: "required", Message: "Phone is a required field"},
+				{Field: "Pin", Rule: "len", Message: "Pin must be 6 characters in length"},
+			},
+		},
+		{
+			acceptLanguage: "id",
+			want: []FieldError{
+				{Field: "Phone", Rule: "required", Message: "Phone wajib diisi"},
+				{Field: "Pin", Rule: "len", Message: "panjang Pin harus 6 karakter"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			recorder, _ := get(errorRouter(apperrors.ErrInvalidInput.Wrap(validationErr)), "/fail", tt.acceptLanguage)
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400", recorder.Code)
+			}
+
+			var response struct {
+				Error struct {
+					Code    apperrors.Code `json:"code"`
+					Details []FieldError   `json:"details"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response %q: %v", recorder.Body, err)
+			}
+			if response.Error.Code != apperrors.CodeInvalidInput {
+				t.Errorf("error code %s, want %s", response.Error.Code, apperrors.CodeInvalidInput)
+			}
+			if !reflect.DeepEqual(response.Error.Details, tt.want) {
+				t.Errorf("details %+v, want %+v", response.Error.Details, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMiddlewareKeepsAWrittenResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.GET("/written", func(c *gin.Context) {
+		models.NewResponse(c).Success("done", nil)
+		c.Error(errors.New("failed after answering"))
+	})
+
+	recorder, response := get(router, "/written", "")
+	if recorder.Code != http.StatusOK || response.Status != models.ResponseStatusSuccess {
+		t.Errorf("answered %d %s, want the handler's 200 %s", recorder.Code, response.Status, models.ResponseStatusSuccess)
+	}
+}
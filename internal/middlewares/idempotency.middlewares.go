@@ -0,0 +1,187 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+const (
+	IdempotencyKeyHeader    = "Idempotency-Key"
+	IdempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+
+	// maxIdempotentBodyBytes bounds the body read into memory to fingerprint it, the money
+	// movement requests are a few hundred bytes
+	maxIdempotentBodyBytes = 64 << 10
+
+	// idempotencyClaimKey holds the models.IdempotencyClaim reserved for the request in its gin context
+	idempotencyClaimKey = "idempotencyClaim"
+)
+
+var (
+	ErrInvalidIdempotencyKey = apperrors.New(http.StatusBadRequest, apperrors.CodeInvalidIdempotency, "Idempotency-Key must be at most 255 characters")
+	ErrIdempotencyKeyReused  = apperrors.New(http.StatusConflict, apperrors.CodeIdempotencyReused, "Idempotency-Key already used for a different request")
+	ErrIdempotencyKeyPending = apperrors.New(http.StatusConflict, apperrors.CodeIdempotencyPending, "A request with this Idempotency-Key is still being processed")
+	ErrRequestBodyTooLarge   = apperrors.New(http.StatusRequestEntityTooLarge, apperrors.CodeInvalidInput, "Request body is too large")
+
+	// ErrIdempotencyClaimMissing is returned for a request with an Idempotency-Key that was never
+	// reserved, the route is missing IdempotencyMiddleware and a retry could move the money again
+	ErrIdempotencyClaimMissing = errors.New("idempotency key of the request was not reserved")
+)
+
+// responseRecorder keeps a copy of the response body while it is written to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the stored response when a request is retried with the same
+// Idempotency-Key, and rejects a key reused for a different request. Must run after AuthMiddleware.
+func IdempotencyMiddleware(repo repositories.IdempotencyRepoInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		response := models.NewResponse(c)
+		if len(key) > maxIdempotencyKeyLength {
+			response.Error(ErrInvalidIdempotencyKey)
+			return
+		}
+
+		userID, exists := GetUserID(c)
+		if !exists {
+			response.Error(apperrors.ErrUnauthorized)
+			return
+		}
+
+		// Read the body to fingerprint it, then put it back for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.Error(ErrRequestBodyTooLarge)
+			return
+		}
+		if err != nil {
+			response.Error(apperrors.ErrInvalidInput.Wrap(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash := fingerprintRequest(c.Request.Method, c.FullPath(), body)
+		cfg := config.GetConfig().Idempotency
+
+		existing, reservationID, err := repo.Reserve(c, userID, key, requestHash, cfg.TTL, cfg.PendingTimeout)
+		if errors.Is(err, repositories.ErrIdempotencyKeyContended) {
+			response.Error(ErrIdempotencyKeyPending)
+			return
+		}
+		if err != nil {
+			response.Error(apperrors.Internal(err))
+			return
+		}
+
+		if existing != nil {
+			if existing.RequestHash != requestHash {
+				response.Error(ErrIdempotencyKeyReused)
+				return
+			}
+			if !existing.Completed() {
+				// The money may already have moved, point the client at the transaction
+				if existing.MovedMoney() {
+					response.Error(ErrIdempotencyKeyPending.WithDetails(map[string]string{"transaction_id": *existing.TransactionID}))
+					return
+				}
+				response.Error(ErrIdempotencyKeyPending)
+				return
+			}
+
+			// Same request seen before, return the original result
+			c.Header(IdempotentReplayHeader, "true")
+			c.Data(*existing.ResponseStatus, "application/json; charset=utf-8", existing.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		// The handler passes the claim on, the repositories link the key to the money movement in
+		// its own DB transaction
+		claim := models.IdempotencyClaim{UserID: userID, Key: key, ReservationID: reservationID}
+		c.Set(idempotencyClaimKey, claim)
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		// Store the outcome even if the client already went away
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := recorder.Status()
+		if recorder.Written() && status >= 200 && status < 300 {
+			if err := repo.Complete(ctx, claim, status, recorder.body.Bytes()); err != nil {
+				// The key stays linked to the movement, retries get 409 instead of moving money again
+				log.Printf("Failed to store idempotent response for key %s: %v", key, err)
+			}
+			return
+		}
+
+		// Let the client retry with the same key, Release keeps it when money was moved anyway
+		if err := repo.Release(ctx, claim); err != nil {
+			log.Printf("Failed to release Idempotency-Key %s: %v", key, err)
+		}
+	}
+}
+
+// GetIdempotencyClaim returns the key IdempotencyMiddleware reserved for the request, nil when the
+// request carries no Idempotency-Key. A key without a reservation is an error, the money must not
+// move unprotected.
+func GetIdempotencyClaim(c *gin.Context) (*models.IdempotencyClaim, error) {
+	if c.GetHeader(IdempotencyKeyHeader) == "" {
+		return nil, nil
+	}
+
+	claim, exists := c.Get(idempotencyClaimKey)
+	if !exists {
+		return nil, ErrIdempotencyClaimMissing
+	}
+
+	reserved := claim.(models.IdempotencyClaim)
+	return &reserved, nil
+}
+
+// fingerprintRequest hashes the method, route and (compacted) JSON body of a request
+func fingerprintRequest(method, path string, body []byte) string {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, body); err == nil {
+		body = compacted.Bytes()
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,258 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+const testUserID = "user"
+
+// memoryIdempotencyRepo keeps the keys in memory with the semantics of repositories.IdempotencyRepo
+type memoryIdempotencyRepo struct {
+	mu           sync.Mutex
+	records      map[string]*models.IdempotencyRecord
+	reservations map[string]string
+	reserved     int
+}
+
+func newMemoryIdempotencyRepo() *memoryIdempotencyRepo {
+	return &memoryIdempotencyRepo{
+		records:      map[string]*models.IdempotencyRecord{},
+		reservations: map[string]string{},
+	}
+}
+
+func (m *memoryIdempotencyRepo) Reserve(ctx context.Context, userID, key, requestHash string, ttl, pendingTimeout time.Duration) (*models.IdempotencyRecord, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := userID + "/" + key
+	if record, exists := m.records[id]; exists {
+		copied := *record
+		return &copied, "", nil
+	}
+
+	m.reserved++
+	reservationID := strconv.Itoa(m.reserved)
+	m.records[id] = &models.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash}
+	m.reservations[id] = reservationID
+	return nil, reservationID, nil
+}
+
+// moveMoney links the key to a transaction, like the repositories do when the money moves
+func (m *memoryIdempotencyRepo) moveMoney(claim models.IdempotencyClaim, transactionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if record := m.claimed(claim); record != nil {
+		record.TransactionID = &transactionID
+	}
+}
+
+func (m *memoryIdempotencyRepo) Complete(ctx context.Context, claim models.IdempotencyClaim, status int, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if record := m.claimed(claim); record != nil {
+		record.ResponseStatus = &status
+		record.ResponseBody = append([]byte(nil), body...)
+	}
+	return nil
+}
+
+func (m *memoryIdempotencyRepo) Release(ctx context.Context, claim models.IdempotencyClaim) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if record := m.claimed(claim); record != nil && !record.Completed() && !record.MovedMoney() {
+		delete(m.records, claim.UserID+"/"+claim.Key)
+	}
+	return nil
+}
+
+func (m *memoryIdempotencyRepo) PurgeExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryIdempotencyRepo) claimed(claim models.IdempotencyClaim) *models.IdempotencyRecord {
+	id := claim.UserID + "/" + claim.Key
+	if m.reservations[id] != claim.ReservationID {
+		return nil
+	}
+	return m.records[id]
+}
+
+// idempotentRouter serves POST /transfer behind IdempotencyMiddleware, answering with handler
+func idempotentRouter(repo *memoryIdempotencyRepo, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.POST("/transfer", func(c *gin.Context) {
+		c.Set("userID", testUserID)
+	}, IdempotencyMiddleware(repo), handler)
+	return router
+}
+
+func postTransfer(router http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, key)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) apperrors.Code {
+	t.Helper()
+	var response models.Response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response %q: %v", recorder.Body, err)
+	}
+	if response.Error == nil {
+		t.Fatalf("response %s has no error", recorder.Body)
+	}
+	return response.Error.Code
+}
+
+func TestIdempotencyReplaysACompletedRequest(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	calls := 0
+	router := idempotentRouter(repo, func(c *gin.Context) {
+		calls++
+		models.NewResponse(c).Created("", gin.H{"transfer": calls})
+	})
+
+	first := postTransfer(router, "key", `{"amount": 100}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request answered %d, want 201", first.Code)
+	}
+	if first.Header().Get(IdempotentReplayHeader) != "" {
+		t.Error("first request marked as replayed")
+	}
+
+	// Formatting of the JSON body does not matter
+	replay := postTransfer(router, "key", `{ "amount":100 }`)
+	if replay.Code != http.StatusCreated {
+		t.Errorf("replay answered %d, want 201", replay.Code)
+	}
+	if replay.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Errorf("%s = %q, want true", IdempotentReplayHeader, replay.Header().Get(IdempotentReplayHeader))
+	}
+	if replay.Body.String() != first.Body.String() {
+		t.Errorf("replayed body %s, want %s", replay.Body, first.Body)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyRejectsAKeyReusedForAnotherBody(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	calls := 0
+	router := idempotentRouter(repo, func(c *gin.Context) {
+		calls++
+		models.NewResponse(c).Created("", nil)
+	})
+
+	if first := postTransfer(router, "key", `{"amount": 100}`); first.Code != http.StatusCreated {
+		t.Fatalf("first request answered %d, want 201", first.Code)
+	}
+
+	other := postTransfer(router, "key", `{"amount": 200}`)
+	if other.Code != http.StatusConflict {
+		t.Fatalf("other body answered %d, want 409", other.Code)
+	}
+	if code := errorCode(t, other); code != apperrors.CodeIdempotencyReused {
+		t.Errorf("error code %s, want %s", code, apperrors.CodeIdempotencyReused)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyPointsARetryAtTheMovedMoney(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	var retry *httptest.ResponseRecorder
+	var router *gin.Engine
+	router = idempotentRouter(repo, func(c *gin.Context) {
+		claim, err := GetIdempotencyClaim(c)
+		if err != nil {
+			t.Errorf("claim: %v", err)
+			return
+		}
+		repo.moveMoney(*claim, "transaction")
+
+		// The client retries before the first request answered
+		retry = postTransfer(router, "key", `{"amount": 100}`)
+		models.NewResponse(c).Created("", nil)
+	})
+
+	postTransfer(router, "key", `{"amount": 100}`)
+
+	if retry.Code != http.StatusConflict {
+		t.Fatalf("retry answered %d, want 409", retry.Code)
+	}
+	var response models.Response
+	if err := json.Unmarshal(retry.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Error == nil || response.Error.Code != apperrors.CodeIdempotencyPending {
+		t.Fatalf("retry answered %s, want %s", retry.Body, apperrors.CodeIdempotencyPending)
+	}
+	details, _ := response.Error.Details.(map[string]any)
+	if details["transaction_id"] != "transaction" {
+		t.Errorf("details = %v, want the transaction_id", response.Error.Details)
+	}
+}
+
+func TestIdempotencyReleasesTheKeyOfAFailedRequest(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	fail := true
+	router := idempotentRouter(repo, func(c *gin.Context) {
+		if fail {
+			models.NewResponse(c).Error(apperrors.ErrInvalidInput)
+			return
+		}
+		models.NewResponse(c).Created("", nil)
+	})
+
+	if first := postTransfer(router, "key", `{"amount": 100}`); first.Code != http.StatusBadRequest {
+		t.Fatalf("first request answered %d, want 400", first.Code)
+	}
+
+	fail = false
+	retry := postTransfer(router, "key", `{"amount": 100}`)
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("retry answered %d, want 201", retry.Code)
+	}
+	if retry.Header().Get(IdempotentReplayHeader) != "" {
+		t.Error("retry of a failed request was replayed")
+	}
+}
+
+func TestIdempotencyLimitsTheBody(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	router := idempotentRouter(repo, func(c *gin.Context) {
+		io.Copy(io.Discard, c.Request.Body)
+		models.NewResponse(c).Created("", nil)
+	})
+
+	body := `{"remarks": "` + strings.Repeat("a", maxIdempotentBodyBytes) + `"}`
+	recorder := postTransfer(router, "key", body)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body answered %d, want 413", recorder.Code)
+	}
+	if len(repo.records) != 0 {
+		t.Errorf("%d keys reserved for the rejected request, want 0", len(repo.records))
+	}
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/i18n"
+)
+
+const languageKey = "language"
+
+// LanguageMiddleware negotiates the language of the response from the Accept-Language header
+func LanguageMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Negotiate(c.GetHeader("Accept-Language"))
+		c.Set(languageKey, lang)
+		c.Header("Content-Language", string(lang))
+		c.Header("Vary", "Accept-Language")
+
+		c.Next()
+	}
+}
+
+// GetLanguage retrieves the negotiated language from the Gin context
+func GetLanguage(c *gin.Context) i18n.Language {
+	if lang, ok := c.Get(languageKey); ok {
+		return lang.(i18n.Language)
+	}
+	return i18n.Negotiate(c.GetHeader("Accept-Language"))
+}
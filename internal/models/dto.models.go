@@ -1,22 +1,26 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/redha28/foomlet/pkg"
+)
 
 // Request DTOs
 
 type TopUpRequest struct {
-	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Amount pkg.Money `json:"amount" binding:"required,gt=0"`
 }
 
 type PaymentRequest struct {
-	Amount  float64 `json:"amount" binding:"required,gt=0"`
-	Remarks string  `json:"remarks" binding:"required"`
+	Amount  pkg.Money `json:"amount" binding:"required,gt=0"`
+	Remarks string    `json:"remarks" binding:"required"`
 }
 
 type TransferRequest struct {
-	TargetUser string  `json:"target_user" binding:"required,uuid"`
-	Amount     float64 `json:"amount" binding:"required,gt=0"`
-	Remarks    string  `json:"remarks" binding:"required"`
+	TargetUser string    `json:"target_user" binding:"required,uuid"`
+	Amount     pkg.Money `json:"amount" binding:"required,gt=0"`
+	Remarks    string    `json:"remarks" binding:"required"`
 }
 
 type UpdateProfileRequest struct {
@@ -25,6 +29,34 @@ type UpdateProfileRequest struct {
 	Address   string `json:"address" binding:"required"`
 }
 
+type ChangePinRequest struct {
+	OldPin string `json:"old_pin" binding:"required,len=6,numeric"`
+	NewPin string `json:"new_pin" binding:"required,len=6,numeric,nefield=OldPin"`
+}
+
+type PinResetCodeRequest struct {
+	Phone string `json:"phone_number" binding:"required,max=20"`
+}
+
+type PinResetRequest struct {
+	Phone  string `json:"phone_number" binding:"required,max=20"`
+	Code   string `json:"code" binding:"required,len=6,numeric"`
+	NewPin string `json:"new_pin" binding:"required,len=6,numeric"`
+}
+
+// StepUpRequest names the payment or transfer the step-up token will confirm, target_user is
+// left out for payments
+type StepUpRequest struct {
+	Pin        string    `json:"pin" binding:"required,len=6,numeric"`
+	Amount     pkg.Money `json:"amount" binding:"required,gt=0"`
+	TargetUser string    `json:"target_user" binding:"omitempty,uuid"`
+}
+
+// IDParam is the :id path parameter of a resource
+type IDParam struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
@@ -45,42 +77,113 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+type StepUpResponse struct {
+	StepUpToken string `json:"step_up_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type LogoutAllResponse struct {
+	RevokedSessions int64 `json:"revoked_sessions"`
+}
+
 type TopUpResponse struct {
 	ID            string    `json:"top_up_id"`
-	Amount        float64   `json:"amount_top_up"`
-	BalanceBefore float64   `json:"balance_before"`
-	BalanceAfter  float64   `json:"balance_after"`
+	Amount        pkg.Money `json:"amount_top_up"`
+	BalanceBefore pkg.Money `json:"balance_before"`
+	BalanceAfter  pkg.Money `json:"balance_after"`
 	CreatedAt     time.Time `json:"created_date"`
 }
 
 type PaymentResponse struct {
 	ID            string    `json:"payment_id"`
-	Amount        float64   `json:"amount"`
+	Amount        pkg.Money `json:"amount"`
 	Remarks       string    `json:"remarks"`
-	BalanceBefore float64   `json:"balance_before"`
-	BalanceAfter  float64   `json:"balance_after"`
+	BalanceBefore pkg.Money `json:"balance_before"`
+	BalanceAfter  pkg.Money `json:"balance_after"`
 	CreatedAt     time.Time `json:"created_date"`
 }
 
 type TransferResponse struct {
-	ID            string    `json:"transfer_id"`
-	Amount        float64   `json:"amount"`
-	Remarks       string    `json:"remarks"`
-	BalanceBefore float64   `json:"balance_before"`
-	BalanceAfter  float64   `json:"balance_after"`
-	CreatedAt     time.Time `json:"created_date"`
+	ID            string            `json:"transfer_id"`
+	Status        TransactionStatus `json:"status"`
+	Amount        pkg.Money         `json:"amount"`
+	Remarks       string            `json:"remarks"`
+	BalanceBefore pkg.Money         `json:"balance_before"`
+	BalanceAfter  pkg.Money         `json:"balance_after"`
+	CreatedAt     time.Time         `json:"created_date"`
+}
+
+type TransferStatusResponse struct {
+	ID            string            `json:"transfer_id"`
+	Status        TransactionStatus `json:"status"`
+	SenderID      string            `json:"sender_id"`
+	RecipientID   string            `json:"recipient_id"`
+	Amount        pkg.Money         `json:"amount"`
+	Remarks       string            `json:"remarks"`
+	FailureReason string            `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time         `json:"created_date"`
+	UpdatedAt     time.Time         `json:"updated_date"`
+	ProcessedAt   *time.Time        `json:"processed_date,omitempty"`
 }
 
 type TransactionResponse struct {
-	ID              string            `json:"transaction_id"`
-	Userid          string            `json:"user_id"`
-	Status          TransactionStatus `json:"status"`
-	TransactionType string            `json:"transaction_type"`
-	Amount          float64           `json:"amount"`
-	Remarks         string            `json:"remarks"`
-	BalanceBefore   float64           `json:"balance_before"`
-	BalanceAfter    float64           `json:"balance_after"`
-	CreatedAt       time.Time         `json:"created_date"`
+	ID              string               `json:"transaction_id"`
+	Userid          string               `json:"user_id"`
+	Status          TransactionStatus    `json:"status"`
+	TransactionType string               `json:"transaction_type"`
+	Direction       TransactionDirection `json:"direction"`
+	Amount          pkg.Money            `json:"amount"`
+	Remarks         string               `json:"remarks"`
+	BalanceBefore   pkg.Money            `json:"balance_before"`
+	BalanceAfter    pkg.Money            `json:"balance_after"`
+	CreatedAt       time.Time            `json:"created_date"`
+}
+
+type CounterpartyResponse struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone_number"`
+}
+
+type StatusChangeResponse struct {
+	Status    TransactionStatus `json:"status"`
+	ChangedAt time.Time         `json:"changed_date"`
+}
+
+type TransactionDetailResponse struct {
+	ID                  string                 `json:"transaction_id"`
+	Status              TransactionStatus      `json:"status"`
+	TransactionType     string                 `json:"transaction_type"`
+	Direction           TransactionDirection   `json:"direction"`
+	Amount              pkg.Money              `json:"amount"`
+	Remarks             string                 `json:"remarks"`
+	BalanceBefore       *pkg.Money             `json:"balance_before,omitempty"`
+	BalanceAfter        *pkg.Money             `json:"balance_after,omitempty"`
+	TransferID          *string                `json:"transfer_id,omitempty"`
+	DebitTransactionID  *string                `json:"debit_transaction_id,omitempty"`
+	CreditTransactionID *string                `json:"credit_transaction_id,omitempty"`
+	FailureReason       string                 `json:"failure_reason,omitempty"`
+	Counterparty        *CounterpartyResponse  `json:"counterparty,omitempty"`
+	StatusHistory       []StatusChangeResponse `json:"status_history"`
+	CreatedAt           time.Time              `json:"created_date"`
+	UpdatedAt           time.Time              `json:"updated_date"`
+}
+
+type TransactionTotal struct {
+	TransactionType string               `json:"transaction_type"`
+	Direction       TransactionDirection `json:"direction"`
+	Count           int                  `json:"count"`
+	Amount          pkg.Money            `json:"amount"`
+}
+
+type WalletSummaryResponse struct {
+	WalletID         string             `json:"wallet_id"`
+	LedgerBalance    pkg.Money          `json:"ledger_balance"`
+	PendingOutgoing  pkg.Money          `json:"pending_outgoing"`
+	AvailableBalance pkg.Money          `json:"available_balance"`
+	MonthStart       time.Time          `json:"month_start"`
+	MonthToDate      []TransactionTotal `json:"month_to_date"`
+	UpdatedAt        time.Time          `json:"updated_date"`
 }
 
 type UpdateProfileResponse struct {
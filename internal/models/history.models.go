@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// TransactionDirection tells whether a transaction added money to the wallet or took it out
+type TransactionDirection string
+
+const (
+	TransactionDirectionIn  TransactionDirection = "IN"
+	TransactionDirectionOut TransactionDirection = "OUT"
+)
+
+const (
+	DefaultHistoryLimit = 20
+	MaxHistoryLimit     = 100
+)
+
+var (
+	ErrInvalidCursor    = apperrors.New(http.StatusBadRequest, apperrors.CodeInvalidCursor, "Invalid cursor")
+	ErrInvalidDate      = apperrors.New(http.StatusBadRequest, apperrors.CodeInvalidDate, "Dates must be YYYY-MM-DD or RFC 3339")
+	ErrInvalidDateRange = apperrors.New(http.StatusBadRequest, apperrors.CodeInvalidDateRange, "From must not be after to")
+	ErrInvalidAmount    = apperrors.New(http.StatusBadRequest, apperrors.CodeInvalidAmountRange, "Invalid amount range")
+)
+
+var transactionTypeIDs = map[string]int{
+	"topup":    TransactionTypeTopUp,
+	"payment":  TransactionTypePayment,
+	"transfer": TransactionTypeTransfer,
+}
+
+// TransactionHistoryRequest holds the query parameters of GET /api/transactions
+type TransactionHistoryRequest struct {
+	Cursor    string `form:"cursor"`
+	Limit     int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Type      string `form:"type" binding:"omitempty,oneof=topup payment transfer"`
+	Direction string `form:"direction" binding:"omitempty,oneof=in out"`
+	From      string `form:"from"`
+	To        string `form:"to"`
+	MinAmount string `form:"min_amount"`
+	MaxAmount string `form:"max_amount"`
+	Query     string `form:"q" binding:"omitempty,max=100"`
+}
+
+// TransactionFilter narrows the transaction history of a wallet, zero values mean no filter
+type TransactionFilter struct {
+	TypeID    int
+	Direction TransactionDirection
+	From      *time.Time
+	To        *time.Time // exclusive
+	MinAmount *pkg.Money
+	MaxAmount *pkg.Money
+	Query     string
+	Limit     int
+	After     *TransactionCursor
+}
+
+// TransactionCursor points at the last transaction of a page, ordered by (created_at, id) descending
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque form of the cursor sent to clients as next_cursor
+func (c TransactionCursor) Encode() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeTransactionCursor parses a cursor produced by TransactionCursor.Encode
+func DecodeTransactionCursor(s string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &TransactionCursor{CreatedAt: t, ID: id}, nil
+}
+
+// Filter validates the request and turns it into a TransactionFilter.
+// A date-only to is inclusive, so to=2025-06-30 covers the whole day.
+func (r TransactionHistoryRequest) Filter() (TransactionFilter, error) {
+	filter := TransactionFilter{
+		TypeID:    transactionTypeIDs[r.Type],
+		Direction: TransactionDirection(strings.ToUpper(r.Direction)),
+		Query:     strings.TrimSpace(r.Query),
+		Limit:     r.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultHistoryLimit
+	}
+
+	if r.Cursor != "" {
+		cursor, err := DecodeTransactionCursor(r.Cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = cursor
+	}
+
+	var err error
+	if filter.From, err = parseHistoryDate(r.From, false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseHistoryDate(r.To, true); err != nil {
+		return filter, err
+	}
+	// To is exclusive, a period ending where it starts is empty
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, ErrInvalidDateRange
+	}
+
+	if filter.MinAmount, err = parseHistoryAmount(r.MinAmount); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parseHistoryAmount(r.MaxAmount); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, ErrInvalidAmount
+	}
+
+	return filter, nil
+}
+
+// parseHistoryDate accepts a date or an RFC 3339 timestamp, an end date moves to the start of the next day.
+// Timestamps are converted to UTC: created_at has no time zone and the offset would be dropped.
+func parseHistoryDate(s string, end bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+func parseHistoryAmount(s string) (*pkg.Money, error) {
+	if s == "" {
+		return nil, nil
+	}
+	amount, err := pkg.ParseMoney(s)
+	if err != nil || amount < 0 {
+		return nil, ErrInvalidAmount
+	}
+	return &amount, nil
+}
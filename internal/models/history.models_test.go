@@ -0,0 +1,186 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/pkg"
+)
+
+func TestTransactionCursorRoundTrip(t *testing.T) {
+	cursor := TransactionCursor{CreatedAt: time.Date(2025, 6, 1, 10, 30, 0, 123456000, time.UTC), ID: uuid.NewString()}
+
+	decoded, err := DecodeTransactionCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeTransactionCursorRejectsBadCursors(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	valid := TransactionCursor{CreatedAt: time.Now().UTC(), ID: uuid.NewString()}.Encode()
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "truncated", cursor: valid[:len(valid)-5]},
+		{name: "no separator", cursor: encode("2025-06-01T10:00:00Z")},
+		{name: "bad timestamp", cursor: encode("yesterday|" + uuid.NewString())},
+		{name: "date only", cursor: encode("2025-06-01|" + uuid.NewString())},
+		{name: "id is not a UUID", cursor: encode("2025-06-01T10:00:00Z|1 OR 1=1")},
+		{name: "empty id", cursor: encode("2025-06-01T10:00:00Z|")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeTransactionCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeTransactionCursor(%q) = %v, want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
+
+func TestTransactionHistoryRequestFilter(t *testing.T) {
+	date := func(s string) *time.Time {
+		parsed, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		return &parsed
+	}
+	money := func(m pkg.Money) *pkg.Money { return &m }
+
+	tests := []struct {
+		name    string
+		req     TransactionHistoryRequest
+		want    TransactionFilter
+		wantErr error
+	}{
+		{
+			name: "no filters",
+			req:  TransactionHistoryRequest{},
+			want: TransactionFilter{Limit: DefaultHistoryLimit},
+		},
+		{
+			name: "type and direction",
+			req:  TransactionHistoryRequest{Type: "transfer", Direction: "out", Limit: 5},
+			want: TransactionFilter{TypeID: TransactionTypeTransfer, Direction: TransactionDirectionOut, Limit: 5},
+		},
+		{
+			name: "top-up type",
+			req:  TransactionHistoryRequest{Type: "topup"},
+			want: TransactionFilter{TypeID: TransactionTypeTopUp, Limit: DefaultHistoryLimit},
+		},
+		{
+			name: "date-only range includes the last day",
+			req:  TransactionHistoryRequest{From: "2025-06-01", To: "2025-06-30"},
+			want: TransactionFilter{From: date("2025-06-01T00:00:00Z"), To: date("2025-07-01T00:00:00Z"), Limit: DefaultHistoryLimit},
+		},
+		{
+			name: "timestamps are converted to UTC",
+			req:  TransactionHistoryRequest{From: "2025-06-01T07:00:00+07:00"},
+			want: TransactionFilter{From: date("2025-06-01T00:00:00Z"), Limit: DefaultHistoryLimit},
+		},
+		{
+			name: "same day",
+			req:  TransactionHistoryRequest{From: "2025-06-01", To: "2025-06-01"},
+			want: TransactionFilter{From: date("2025-06-01T00:00:00Z"), To: date("2025-06-02T00:00:00Z"), Limit: DefaultHistoryLimit},
+		},
+		{
+			name:    "from after to",
+			req:     TransactionHistoryRequest{From: "2025-06-02", To: "2025-06-01"},
+			wantErr: ErrInvalidDateRange,
+		},
+		{
+			name:    "empty timestamp range",
+			req:     TransactionHistoryRequest{From: "2025-06-01T10:00:00Z", To: "2025-06-01T10:00:00Z"},
+			wantErr: ErrInvalidDateRange,
+		},
+		{
+			name:    "malformed date",
+			req:     TransactionHistoryRequest{From: "01/06/2025"},
+			wantErr: ErrInvalidDate,
+		},
+		{
+			name: "amount range and query",
+			req:  TransactionHistoryRequest{MinAmount: "10", MaxAmount: "20.50", Query: "  listrik "},
+			want: TransactionFilter{MinAmount: money(pkg.NewMoney(10, 0)), MaxAmount: money(pkg.NewMoney(20, 50)), Query: "listrik", Limit: DefaultHistoryLimit},
+		},
+		{
+			name:    "min above max",
+			req:     TransactionHistoryRequest{MinAmount: "20", MaxAmount: "10"},
+			wantErr: ErrInvalidAmount,
+		},
+		{
+			name:    "negative amount",
+			req:     TransactionHistoryRequest{MinAmount: "-1"},
+			wantErr: ErrInvalidAmount,
+		},
+		{
+			name:    "tampered cursor",
+			req:     TransactionHistoryRequest{Cursor: "dGFtcGVyZWQ"},
+			wantErr: ErrInvalidCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.Filter()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			if got.TypeID != tt.want.TypeID || got.Direction != tt.want.Direction || got.Query != tt.want.Query || got.Limit != tt.want.Limit {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+			if !equalTime(got.From, tt.want.From) || !equalTime(got.To, tt.want.To) {
+				t.Errorf("period = %v - %v, want %v - %v", got.From, got.To, tt.want.From, tt.want.To)
+			}
+			if !equalMoney(got.MinAmount, tt.want.MinAmount) || !equalMoney(got.MaxAmount, tt.want.MaxAmount) {
+				t.Errorf("amounts = %v - %v, want %v - %v", got.MinAmount, got.MaxAmount, tt.want.MinAmount, tt.want.MaxAmount)
+			}
+		})
+	}
+}
+
+func TestTransactionHistoryRequestFilterKeepsTheCursor(t *testing.T) {
+	cursor := TransactionCursor{CreatedAt: time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC), ID: uuid.NewString()}
+
+	filter, err := TransactionHistoryRequest{Cursor: cursor.Encode()}.Filter()
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	if filter.After == nil || !filter.After.CreatedAt.Equal(cursor.CreatedAt) || filter.After.ID != cursor.ID {
+		t.Errorf("after = %+v, want %+v", filter.After, cursor)
+	}
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func equalMoney(a, b *pkg.Money) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
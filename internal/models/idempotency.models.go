@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// IdempotencyRecord represents the idempotency_keys table
+type IdempotencyRecord struct {
+	UserID         string    `json:"user_id"`
+	Key            string    `json:"idempotency_key"`
+	RequestHash    string    `json:"request_hash"`
+	ResponseStatus *int      `json:"response_status"`
+	ResponseBody   []byte    `json:"response_body"`
+	TransactionID  *string   `json:"transaction_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// IdempotencyClaim is the key reserved by the request in flight, the repositories link it to the
+// transaction that moves the money
+type IdempotencyClaim struct {
+	UserID        string
+	Key           string
+	ReservationID string
+}
+
+// Completed reports whether the original request finished and its response was stored
+func (r *IdempotencyRecord) Completed() bool {
+	return r.ResponseStatus != nil
+}
+
+// MovedMoney reports whether the original request committed its money movement, even if its
+// response was never stored
+func (r *IdempotencyRecord) MovedMoney() bool {
+	return r.TransactionID != nil
+}
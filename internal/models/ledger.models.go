@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// System ledger accounts, wallet accounts share the ID of their wallet
+const (
+	LedgerAccountTopUpFunding       = "00000000-0000-0000-0000-000000000001"
+	LedgerAccountMerchantSettlement = "00000000-0000-0000-0000-000000000002"
+)
+
+// JournalKind represents the operation a journal records
+type JournalKind string
+
+const (
+	JournalKindOpeningBalance JournalKind = "OPENING_BALANCE"
+	JournalKindTopUp          JournalKind = "TOPUP"
+	JournalKindPayment        JournalKind = "PAYMENT"
+	JournalKindTransfer       JournalKind = "TRANSFER"
+)
+
+// EntryDirection represents the side of a ledger entry
+type EntryDirection string
+
+const (
+	EntryDebit  EntryDirection = "DEBIT"
+	EntryCredit EntryDirection = "CREDIT"
+)
+
+// LedgerEntry represents the ledger_entries table
+type LedgerEntry struct {
+	AccountID string         `json:"account_id"`
+	Direction EntryDirection `json:"direction"`
+	Amount    pkg.Money      `json:"amount"`
+}
+
+// Journal represents the ledger_journals table together with its entries
+type Journal struct {
+	ID            string        `json:"id"`
+	TransactionID string        `json:"transaction_id"`
+	Kind          JournalKind   `json:"kind"`
+	Description   string        `json:"description"`
+	Entries       []LedgerEntry `json:"entries"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// NewJournal creates an empty journal for a transaction with a generated UUID
+func NewJournal(transactionID string, kind JournalKind, description string) *Journal {
+	return &Journal{
+		ID:            uuid.New().String(),
+		TransactionID: transactionID,
+		Kind:          kind,
+		Description:   description,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// Debit adds a debit entry, lowering the balance of the account
+func (j *Journal) Debit(accountID string, amount pkg.Money) *Journal {
+	j.Entries = append(j.Entries, LedgerEntry{AccountID: accountID, Direction: EntryDebit, Amount: amount})
+	return j
+}
+
+// Credit adds a credit entry, raising the balance of the account
+func (j *Journal) Credit(accountID string, amount pkg.Money) *Journal {
+	j.Entries = append(j.Entries, LedgerEntry{AccountID: accountID, Direction: EntryCredit, Amount: amount})
+	return j
+}
+
+// Balanced reports whether the journal has entries and its debits equal its credits
+func (j *Journal) Balanced() bool {
+	var debits, credits pkg.Money
+	for _, entry := range j.Entries {
+		if !entry.Amount.IsPositive() {
+			return false
+		}
+		if entry.Direction == EntryDebit {
+			debits += entry.Amount
+		} else {
+			credits += entry.Amount
+		}
+	}
+	return len(j.Entries) >= 2 && debits == credits
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/redha28/foomlet/pkg"
+)
+
+func TestJournalBalanced(t *testing.T) {
+	const walletA, walletB = "wallet-a", "wallet-b"
+	amount := pkg.NewMoney(100, 0)
+
+	tests := []struct {
+		name    string
+		journal *Journal
+		want    bool
+	}{
+		{
+			name:    "transfer",
+			journal: NewJournal("tx", JournalKindTransfer, "").Debit(walletA, amount).Credit(walletB, amount),
+			want:    true,
+		},
+		{
+			name:    "split credit",
+			journal: NewJournal("tx", JournalKindPayment, "").Debit(walletA, amount).Credit(walletB, amount-1).Credit(LedgerAccountMerchantSettlement, 1),
+			want:    true,
+		},
+		{
+			name:    "no entries",
+			journal: NewJournal("tx", JournalKindTopUp, ""),
+		},
+		{
+			name:    "single entry",
+			journal: NewJournal("tx", JournalKindTopUp, "").Credit(walletA, amount),
+		},
+		{
+			name:    "debits exceed credits",
+			journal: NewJournal("tx", JournalKindTransfer, "").Debit(walletA, amount).Credit(walletB, amount-1),
+		},
+		{
+			name:    "credits exceed debits",
+			journal: NewJournal("tx", JournalKindTransfer, "").Debit(walletA, amount).Credit(walletB, amount+1),
+		},
+		{
+			name:    "zero entries",
+			journal: NewJournal("tx", JournalKindTransfer, "").Debit(walletA, 0).Credit(walletB, 0),
+		},
+		{
+			name:    "negative entries balancing each other",
+			journal: NewJournal("tx", JournalKindTransfer, "").Debit(walletA, -amount).Credit(walletB, -amount),
+		},
+		{
+			name:    "negative entry hiding an extra credit",
+			journal: NewJournal("tx", JournalKindTransfer, "").Debit(walletA, amount).Credit(walletB, amount*2).Credit(walletA, -amount),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.journal.Balanced(); got != tt.want {
+				t.Errorf("Balanced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
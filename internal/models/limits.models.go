@@ -0,0 +1,40 @@
+package models
+
+import (
+	"github.com/redha28/foomlet/pkg"
+)
+
+// KYC levels with their own row in transaction_limits
+const (
+	KYCLevelBasic    = "BASIC"
+	KYCLevelVerified = "VERIFIED"
+)
+
+// LimitCode identifies the limit a transaction ran into, clients can map it to a message
+type LimitCode string
+
+const (
+	LimitMaxBalance      LimitCode = "LIMIT_MAX_BALANCE"
+	LimitMaxTransaction  LimitCode = "LIMIT_MAX_TRANSACTION"
+	LimitDailyOutgoing   LimitCode = "LIMIT_DAILY_OUTGOING"
+	LimitMonthlyOutgoing LimitCode = "LIMIT_MONTHLY_OUTGOING"
+	LimitHourlyTransfers LimitCode = "LIMIT_HOURLY_TRANSFERS"
+)
+
+// TransactionLimits represents the transaction_limits table, nil means no limit
+type TransactionLimits struct {
+	KYCLevel        string     `json:"kyc_level"`
+	MaxBalance      *pkg.Money `json:"max_balance"`
+	MaxTransaction  *pkg.Money `json:"max_transaction"`
+	DailyOutgoing   *pkg.Money `json:"daily_outgoing"`
+	MonthlyOutgoing *pkg.Money `json:"monthly_outgoing"`
+	HourlyTransfers *int       `json:"hourly_transfers"`
+}
+
+// LimitViolation is the error detail returned when a limit is exceeded
+type LimitViolation struct {
+	Code      LimitCode `json:"code"`
+	KYCLevel  string    `json:"kyc_level"`
+	Limit     string    `json:"limit"`
+	Remaining string    `json:"remaining"`
+}
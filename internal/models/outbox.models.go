@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxStatus represents the delivery state of an outbox message
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "PENDING"
+	OutboxStatusSent    OutboxStatus = "SENT"
+)
+
+// OutboxMessage represents the outbox table
+type OutboxMessage struct {
+	ID          string       `json:"id"`
+	AggregateID string       `json:"aggregate_id"`
+	RoutingKey  string       `json:"routing_key"`
+	Payload     []byte       `json:"payload"`
+	Status      OutboxStatus `json:"status"`
+	Attempts    int          `json:"attempts"`
+	LastError   string       `json:"last_error"`
+	CreatedAt   time.Time    `json:"created_at"`
+	SentAt      *time.Time   `json:"sent_at"`
+}
+
+// NewOutboxMessage creates a new pending outbox message with a generated UUID
+func NewOutboxMessage(aggregateID, routingKey string, payload []byte) *OutboxMessage {
+	return &OutboxMessage{
+		ID:          uuid.New().String(),
+		AggregateID: aggregateID,
+		RoutingKey:  routingKey,
+		Payload:     payload,
+		Status:      OutboxStatusPending,
+		CreatedAt:   time.Now(),
+	}
+}
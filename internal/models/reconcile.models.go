@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/redha28/foomlet/pkg"
+)
+
+// DiscrepancyType represents the kind of inconsistency found by a reconciliation run
+type DiscrepancyType string
+
+const (
+	// DiscrepancyWalletHistory means wallets.balance differs from the sum of its successful transactions
+	DiscrepancyWalletHistory DiscrepancyType = "WALLET_HISTORY_MISMATCH"
+	// DiscrepancyWalletLedger means wallets.balance differs from the balance derived from the ledger
+	DiscrepancyWalletLedger DiscrepancyType = "WALLET_LEDGER_MISMATCH"
+	// DiscrepancyMissingCredit means a successful transfer has no credit on the recipient wallet
+	DiscrepancyMissingCredit DiscrepancyType = "TRANSFER_MISSING_CREDIT"
+	// DiscrepancyStuckTransfer means a transfer stayed PENDING longer than expected
+	DiscrepancyStuckTransfer DiscrepancyType = "TRANSFER_STUCK_PENDING"
+)
+
+// Discrepancy is one inconsistency found by a reconciliation run
+type Discrepancy struct {
+	Type          DiscrepancyType `json:"type"`
+	WalletID      string          `json:"wallet_id,omitempty"`
+	UserID        string          `json:"user_id,omitempty"`
+	TransactionID string          `json:"transaction_id,omitempty"`
+	Expected      pkg.Money       `json:"expected"`
+	Actual        pkg.Money       `json:"actual"`
+	Detail        string          `json:"detail"`
+}
+
+// ReconciliationReport is the result of comparing wallet balances with their history
+type ReconciliationReport struct {
+	StartedAt        time.Time     `json:"started_at"`
+	FinishedAt       time.Time     `json:"finished_at"`
+	WalletsChecked   int           `json:"wallets_checked"`
+	TransfersChecked int           `json:"transfers_checked"`
+	Discrepancies    []Discrepancy `json:"discrepancies"`
+}
+
+// Clean reports whether the run found no discrepancies
+func (r *ReconciliationReport) Clean() bool {
+	return len(r.Discrepancies) == 0
+}
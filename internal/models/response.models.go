@@ -1,99 +1,122 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/internal/apperrors"
+)
+
+// Envelope statuses
+const (
+	ResponseStatusSuccess = "SUCCESS"
+	ResponseStatusError   = "ERROR"
 )
 
 type Responder struct {
 	C *gin.Context
 }
 
+// Response is the envelope of every JSON response
 type Response struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-	Data    any    `json:"data,omitempty"`
-	Error   any    `json:"error,omitempty"`
+	Status  string     `json:"status"`
+	Message string     `json:"message,omitempty"`
+	Result  any        `json:"result,omitempty"`
+	Meta    any        `json:"meta,omitempty"`
+	Error   *ErrorBody `json:"error,omitempty"`
+}
+
+// ErrorBody describes what went wrong in a machine-readable way
+type ErrorBody struct {
+	Code    apperrors.Code `json:"code"`
+	Details any            `json:"details,omitempty"`
 }
 
-type LoginResponse struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-	Data    any    `json:"data,omitempty"`
-	Token   string `json:"token,omitempty"`
+// PageMeta is sent with paginated results
+type PageMeta struct {
+	NextCursor *string `json:"next_cursor"`
 }
 
 func NewResponse(ctx *gin.Context) *Responder {
 	return &Responder{C: ctx}
 }
 
-func (r *Responder) Success(message string, data interface{}) {
-	r.C.JSON(http.StatusOK, Response{
-		Status:  http.StatusOK,
+// NewErrorResponse builds the envelope of an error with its localized message, internal causes are never included
+func NewErrorResponse(err *apperrors.Error, message string) Response {
+	return Response{
+		Status:  ResponseStatusError,
 		Message: message,
-		Data:    data,
-	})
+		Error:   &ErrorBody{Code: err.Code, Details: err.Details},
+	}
 }
 
-func (r *Responder) LoginSuccess(message string, data interface{}, token string) {
-	r.C.JSON(http.StatusOK, LoginResponse{
-		Status:  http.StatusOK,
+func (r *Responder) Success(message string, result any) {
+	r.C.JSON(http.StatusOK, Response{
+		Status:  ResponseStatusSuccess,
 		Message: message,
-		Data:    data,
-		Token:   token,
+		Result:  result,
 	})
 }
 
-func (r *Responder) Created(message string, data interface{}) {
-	r.C.JSON(http.StatusCreated, Response{
-		Status:  http.StatusCreated,
-		Message: message,
-		Data:    data,
+// Page answers with one page of results and the metadata to fetch the next one
+func (r *Responder) Page(result any, meta PageMeta) {
+	r.C.JSON(http.StatusOK, Response{
+		Status: ResponseStatusSuccess,
+		Result: result,
+		Meta:   meta,
 	})
 }
 
-func (r *Responder) BadRequest(message string, err interface{}) {
-	r.C.JSON(http.StatusBadRequest, Response{
-		Status:  http.StatusBadRequest,
+// Cached answers like Success with an ETag derived from the body, or with a 304 and no body when the
+// request's If-None-Match already lists it. The ETag changes with any figure in the result.
+func (r *Responder) Cached(message string, result any) {
+	body, err := json.Marshal(Response{
+		Status:  ResponseStatusSuccess,
 		Message: message,
-		Error:   err,
+		Result:  result,
 	})
-	r.C.Abort()
-}
+	if err != nil {
+		r.Error(apperrors.Internal(err))
+		return
+	}
 
-func (r *Responder) Unauthorized(message string, err interface{}) {
-	r.C.JSON(http.StatusUnauthorized, Response{
-		Status:  http.StatusUnauthorized,
-		Message: message,
-		Error:   err,
-	})
-	r.C.Abort()
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	r.C.Header("ETag", etag)
+	r.C.Header("Cache-Control", "private, no-cache")
+	if etagMatches(r.C.GetHeader("If-None-Match"), etag) {
+		r.C.Status(http.StatusNotModified)
+		return
+	}
+
+	r.C.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
-func (r *Responder) Forbidden(message string, err interface{}) {
-	r.C.JSON(http.StatusForbidden, Response{
-		Status:  http.StatusForbidden,
-		Message: message,
-		Error:   err,
-	})
-	r.C.Abort()
+// etagMatches reports whether an If-None-Match header lists the ETag, weak validators included
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
 }
 
-func (r *Responder) NotFound(message string, err interface{}) {
-	r.C.JSON(http.StatusNotFound, Response{
-		Status:  http.StatusNotFound,
+func (r *Responder) Created(message string, result any) {
+	r.C.JSON(http.StatusCreated, Response{
+		Status:  ResponseStatusSuccess,
 		Message: message,
-		Error:   err,
+		Result:  result,
 	})
-	r.C.Abort()
 }
 
-func (r *Responder) InternalServerError(message string, err interface{}) {
-	r.C.JSON(http.StatusInternalServerError, Response{
-		Status:  http.StatusInternalServerError,
-		Message: message,
-		Error:   err,
-	})
+// Error hands err to the error middleware, which logs it and writes the response
+func (r *Responder) Error(err error) {
+	r.C.Error(err)
 	r.C.Abort()
 }
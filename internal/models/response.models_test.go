@@ -0,0 +1,87 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// cachedSummary answers a request for summary through Responder.Cached
+func cachedSummary(t *testing.T, summary WalletSummaryResponse, ifNoneMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/wallet", nil)
+	if ifNoneMatch != "" {
+		c.Request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	NewResponse(c).Cached("", summary)
+	c.Writer.WriteHeaderNow()
+	return recorder
+}
+
+func TestCachedSendsAnETag(t *testing.T) {
+	summary := WalletSummaryResponse{WalletID: "wallet", LedgerBalance: pkg.NewMoney(100, 0), AvailableBalance: pkg.NewMoney(100, 0)}
+
+	first := cachedSummary(t, summary, "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag header")
+	}
+	if first.Body.Len() == 0 {
+		t.Error("empty body")
+	}
+
+	// The same figures give the same ETag
+	if again := cachedSummary(t, summary, "").Header().Get("ETag"); again != etag {
+		t.Errorf("ETag of the same summary = %s, want %s", again, etag)
+	}
+
+	// A balance change gives another one
+	summary.LedgerBalance += pkg.NewMoney(1, 0)
+	if changed := cachedSummary(t, summary, "").Header().Get("ETag"); changed == etag {
+		t.Errorf("ETag %s did not change with the balance", changed)
+	}
+}
+
+func TestCachedAnswersNotModified(t *testing.T) {
+	summary := WalletSummaryResponse{WalletID: "wallet", LedgerBalance: pkg.NewMoney(100, 0)}
+	etag := cachedSummary(t, summary, "").Header().Get("ETag")
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "matching ETag", ifNoneMatch: etag, want: http.StatusNotModified},
+		{name: "weak validator", ifNoneMatch: "W/" + etag, want: http.StatusNotModified},
+		{name: "wildcard", ifNoneMatch: "*", want: http.StatusNotModified},
+		{name: "in a list", ifNoneMatch: `"other", ` + etag, want: http.StatusNotModified},
+		{name: "other ETag", ifNoneMatch: `"other"`, want: http.StatusOK},
+		{name: "unquoted ETag", ifNoneMatch: etag[1 : len(etag)-1], want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := cachedSummary(t, summary, tt.ifNoneMatch)
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Errorf("304 carries a body: %s", recorder.Body)
+			}
+			if got := recorder.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %s, want %s", got, etag)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// SessionRevokedReason tells why a session was ended before it expired
+type SessionRevokedReason string
+
+const (
+	SessionRevokedLogout    SessionRevokedReason = "LOGOUT"
+	SessionRevokedLogoutAll SessionRevokedReason = "LOGOUT_ALL"
+	SessionRevokedByUser    SessionRevokedReason = "REVOKED_BY_USER"
+	SessionRevokedPinChange SessionRevokedReason = "PIN_CHANGE"
+	SessionRevokedPinReset  SessionRevokedReason = "PIN_RESET"
+	SessionRevokedReuse     SessionRevokedReason = "REFRESH_TOKEN_REUSE"
+)
+
+// Session represents the sessions table, one row per login
+type Session struct {
+	ID            string                `json:"session_id"`
+	UserID        string                `json:"user_id"`
+	CreatedAt     time.Time             `json:"created_at"`
+	LastUsedAt    time.Time             `json:"last_used_at"`
+	ExpiresAt     time.Time             `json:"expires_at"`
+	UserAgent     string                `json:"user_agent"`
+	IPAddress     string                `json:"ip_address"`
+	RevokedAt     *time.Time            `json:"revoked_at,omitempty"`
+	RevokedReason *SessionRevokedReason `json:"revoked_reason,omitempty"`
+}
+
+// DeviceInfo describes the client a session is used from
+type DeviceInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// SessionResponse is a session as listed to its user
+type SessionResponse struct {
+	ID         string    `json:"session_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
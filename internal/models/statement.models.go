@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"github.com/redha28/foomlet/pkg"
+)
+
+const (
+	StatementFormatCSV = "csv"
+	StatementFormatPDF = "pdf"
+)
+
+// StatementRequest holds the query parameters of GET /api/statements, both dates are inclusive
+type StatementRequest struct {
+	From   string `form:"from" binding:"required,datetime=2006-01-02"`
+	To     string `form:"to" binding:"required,datetime=2006-01-02"`
+	Format string `form:"format" binding:"omitempty,oneof=csv pdf"`
+}
+
+// Filter turns the request into a history filter covering the whole period
+func (r StatementRequest) Filter() (TransactionFilter, error) {
+	from, err := parseHistoryDate(r.From, false)
+	if err != nil {
+		return TransactionFilter{}, err
+	}
+	to, err := parseHistoryDate(r.To, true)
+	if err != nil {
+		return TransactionFilter{}, err
+	}
+	// to already moved to the day after the last one
+	if !from.Before(*to) {
+		return TransactionFilter{}, ErrInvalidDateRange
+	}
+	return TransactionFilter{From: from, To: to}, nil
+}
+
+// StatementHeader is the profile and opening balance printed at the top of a statement
+type StatementHeader struct {
+	UserID         string    `json:"user_id"`
+	Name           string    `json:"name"`
+	Phone          string    `json:"phone_number"`
+	Address        string    `json:"address"`
+	WalletID       string    `json:"wallet_id"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance pkg.Money `json:"opening_balance"`
+}
+
+// StatementRow is one transaction of a statement with the wallet balance after it. Transactions
+// that did not move the balance, pending and failed ones, have no running balance.
+type StatementRow struct {
+	TransactionResponse
+	RunningBalance *pkg.Money `json:"running_balance"`
+}
+
+// StatementSummary closes a statement
+type StatementSummary struct {
+	OpeningBalance pkg.Money          `json:"opening_balance"`
+	ClosingBalance pkg.Money          `json:"closing_balance"`
+	TotalIn        pkg.Money          `json:"total_in"`
+	TotalOut       pkg.Money          `json:"total_out"`
+	Totals         []TransactionTotal `json:"totals"`
+}
+
+// Statement accumulates the running balance and the totals while rows are streamed.
+// Only SUCCESS transactions move the balance, pending and failed ones are listed as they are.
+type Statement struct {
+	summary StatementSummary
+	totals  map[TransactionTotal]int
+}
+
+// NewStatement starts a statement from the balance at the start of the period
+func NewStatement(opening pkg.Money) *Statement {
+	return &Statement{
+		summary: StatementSummary{OpeningBalance: opening, ClosingBalance: opening},
+		totals:  make(map[TransactionTotal]int),
+	}
+}
+
+// Add applies a transaction and returns its statement row
+func (s *Statement) Add(tx TransactionResponse) StatementRow {
+	if tx.Status != TransactionStatusSuccess {
+		return StatementRow{TransactionResponse: tx}
+	}
+
+	if tx.Direction == TransactionDirectionIn {
+		s.summary.ClosingBalance += tx.Amount
+		s.summary.TotalIn += tx.Amount
+	} else {
+		s.summary.ClosingBalance -= tx.Amount
+		s.summary.TotalOut += tx.Amount
+	}
+
+	key := TransactionTotal{TransactionType: tx.TransactionType, Direction: tx.Direction}
+	i, ok := s.totals[key]
+	if !ok {
+		i = len(s.summary.Totals)
+		s.totals[key] = i
+		s.summary.Totals = append(s.summary.Totals, key)
+	}
+	s.summary.Totals[i].Count++
+	s.summary.Totals[i].Amount += tx.Amount
+
+	balance := s.summary.ClosingBalance
+	return StatementRow{TransactionResponse: tx, RunningBalance: &balance}
+}
+
+// Summary returns the closing balance and the totals of the rows added so far
+func (s *Statement) Summary() *StatementSummary {
+	return &s.summary
+}
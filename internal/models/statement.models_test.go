@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatementRequestFilter(t *testing.T) {
+	day := func(s string) time.Time {
+		parsed, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name     string
+		req      StatementRequest
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  error
+	}{
+		{name: "month", req: StatementRequest{From: "2025-06-01", To: "2025-06-30"}, wantFrom: day("2025-06-01"), wantTo: day("2025-07-01")},
+		{name: "one day", req: StatementRequest{From: "2025-06-01", To: "2025-06-01"}, wantFrom: day("2025-06-01"), wantTo: day("2025-06-02")},
+		{name: "from after to", req: StatementRequest{From: "2025-06-02", To: "2025-06-01"}, wantErr: ErrInvalidDateRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.req.Filter()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !filter.From.Equal(tt.wantFrom) || !filter.To.Equal(tt.wantTo) {
+				t.Errorf("period = %s - %s, want %s - %s", filter.From, filter.To, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// StepUpClaim is the step-up token confirming the request in flight, the repositories spend it
+// in the transaction that moves the money
+type StepUpClaim struct {
+	JTI       string
+	UserID    string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// ThrottleScope is what failed login attempts are counted against
+type ThrottleScope string
+
+const (
+	ThrottleScopePhone ThrottleScope = "PHONE"
+	ThrottleScopeIP    ThrottleScope = "IP"
+)
+
+// ThrottlePolicy limits the failed logins of one scope
+type ThrottlePolicy struct {
+	// MaxFailures is the number of failures that triggers a lockout
+	MaxFailures int
+	// FreeAttempts is the number of failures allowed before delays begin
+	FreeAttempts int
+	// BaseDelay is the first delay, it doubles with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a failure is remembered
+	Window time.Duration
+	// Lockout is how long a lockout lasts unless it is lifted with an unlock code
+	Lockout time.Duration
+}
+
+// Delay returns how long to wait after the given number of failures before the next attempt
+func (p ThrottlePolicy) Delay(failures int) time.Duration {
+	if failures < p.FreeAttempts || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// RetryAfter is sent as the details of errors that ask the client to wait
+type RetryAfter struct {
+	Seconds int `json:"retry_after_seconds"`
+}
+
+func NewRetryAfter(wait time.Duration) RetryAfter {
+	return RetryAfter{Seconds: max(1, int(math.Ceil(wait.Seconds())))}
+}
+
+// RetryAfterSeconds is the value of the Retry-After header
+func (r RetryAfter) RetryAfterSeconds() int {
+	return r.Seconds
+}
+
+// LoginAttempt describes a login request for throttling and lockout events
+type LoginAttempt struct {
+	Phone  string
+	UserID *string
+	Device DeviceInfo
+}
+
+// OneTimeCodePurpose tells what a one-time code can be used for
+type OneTimeCodePurpose string
+
+const (
+	OneTimeCodeUnlock   OneTimeCodePurpose = "UNLOCK"
+	OneTimeCodePinReset OneTimeCodePurpose = "PIN_RESET"
+)
+
+// UnlockCodeRequest asks for a code to lift the lockout of a phone number
+type UnlockCodeRequest struct {
+	Phone string `json:"phone_number" binding:"required,max=20"`
+}
+
+// UnlockRequest lifts the lockout of a phone number with the code sent to it
+type UnlockRequest struct {
+	Phone string `json:"phone_number" binding:"required,max=20"`
+	Code  string `json:"code" binding:"required,len=6,numeric"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottlePolicyDelay(t *testing.T) {
+	policy := ThrottlePolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		name     string
+		policy   ThrottlePolicy
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", policy: policy, failures: 0, want: 0},
+		{name: "last free attempt", policy: policy, failures: 2, want: 0},
+		{name: "first delay", policy: policy, failures: 3, want: time.Second},
+		{name: "doubles", policy: policy, failures: 4, want: 2 * time.Second},
+		{name: "doubles again", policy: policy, failures: 6, want: 8 * time.Second},
+		{name: "capped", policy: policy, failures: 7, want: 10 * time.Second},
+		{name: "stays capped", policy: policy, failures: 1000, want: 10 * time.Second},
+		{name: "no free attempts", policy: ThrottlePolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, failures: 0, want: time.Second},
+		{name: "base above the cap", policy: ThrottlePolicy{BaseDelay: time.Minute, MaxDelay: time.Second}, failures: 0, want: time.Second},
+		{name: "delays disabled", policy: ThrottlePolicy{FreeAttempts: 3, MaxDelay: time.Minute}, failures: 10, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.failures); got != tt.want {
+				t.Errorf("Delay(%d) = %s, want %s", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/redha28/foomlet/pkg"
 )
 
 // Transaction Types Constants
@@ -27,13 +28,13 @@ type Transaction struct {
 	ID                string            `json:"id"`
 	WalletID          string            `json:"wallet_id"`
 	TransactionTypeID int               `json:"transaction_type_id"`
-	Amount            float64           `json:"amount"`
+	Amount            pkg.Money         `json:"amount"`
 	CreatedAt         time.Time         `json:"created_at"`
 	UpdatedAt         time.Time         `json:"updated_at"`
 	Status            TransactionStatus `json:"status"`
 	Remarks           string            `json:"remarks"`
-	BalanceBefore     float64           `json:"balance_before"`
-	BalanceAfter      float64           `json:"balance_after"`
+	BalanceBefore     pkg.Money         `json:"balance_before"`
+	BalanceAfter      pkg.Money         `json:"balance_after"`
 }
 
 // NewTransaction creates a new transaction with a generated UUID
@@ -66,7 +67,7 @@ func NewTopUp(transactionID string) *TopUp {
 type Payment struct {
 	TransactionID string    `json:"transaction_id"`
 	UserID        string    `json:"user_id"`
-	Amount        int       `json:"amount"`
+	Amount        pkg.Money `json:"amount"`
 	Remarks       string    `json:"remarks"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
@@ -105,7 +106,7 @@ type TransferQueue struct {
 	ID         string            `json:"id"`
 	SenderUser string            `json:"sender_user"`
 	TargetUser string            `json:"target_user"`
-	Amount     float64           `json:"amount"`
+	Amount     pkg.Money         `json:"amount"`
 	Remarks    string            `json:"remarks"`
 	Status     TransactionStatus `json:"status"`
 	CreatedAt  time.Time         `json:"created_at"`
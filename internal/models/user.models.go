@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/redha28/foomlet/pkg"
 )
 
 type User struct {
@@ -30,7 +31,7 @@ func NewUser() *User {
 type Wallet struct {
 	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
-	Balance   float64   `json:"balance"`
+	Balance   pkg.Money `json:"balance"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrorClass tells a worker whether a failed operation is worth retrying
+type ErrorClass string
+
+const (
+	// ErrorClassRetryable covers transient infrastructure failures such as lost connections or deadlocks
+	ErrorClassRetryable ErrorClass = "RETRYABLE"
+	// ErrorClassPermanent covers business rule violations that will fail the same way every time
+	ErrorClassPermanent ErrorClass = "PERMANENT"
+)
+
+// permanentErrors are domain errors that retrying can never fix
+var permanentErrors = []error{
+	ErrInsufficientBalance,
+	ErrWalletNotFound,
+	ErrTransferNotFound,
+	ErrUserNotFound,
+	ErrLimitExceeded,
+}
+
+// retryablePgCodeClasses are the SQLSTATE classes of transient Postgres failures
+var retryablePgCodeClasses = map[string]bool{
+	"08": true, // connection exception
+	"40": true, // transaction rollback (serialization failure, deadlock)
+	"53": true, // insufficient resources
+	"57": true, // operator intervention (admin shutdown, crash shutdown)
+	"58": true, // system error
+}
+
+// ClassifyError decides whether err is retryable. Unknown errors are treated as retryable
+// because the number of retries is bounded and a retry never applies a transfer twice.
+func ClassifyError(err error) ErrorClass {
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return ErrorClassPermanent
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if len(pgErr.Code) >= 2 && retryablePgCodeClasses[pgErr.Code[:2]] {
+			return ErrorClassRetryable
+		}
+		if pgErr.Code == "55P03" { // lock_not_available
+			return ErrorClassRetryable
+		}
+		// Any other SQL error (constraint, syntax, data) is deterministic
+		return ErrorClassPermanent
+	}
+
+	// Timeouts, dropped connections and other I/O failures end up here as well
+	return ErrorClassRetryable
+}
+
+// IsRetryable reports whether err is classified as retryable
+func IsRetryable(err error) bool {
+	return ClassifyError(err) == ErrorClassRetryable
+}
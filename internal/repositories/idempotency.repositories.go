@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+var (
+	// ErrIdempotencyKeyContended is returned when the key kept changing hands while Reserve tried to claim it
+	ErrIdempotencyKeyContended = errors.New("idempotency key is contended")
+	// ErrIdempotencyKeyLost is returned by a money movement whose key was freed and reserved again
+	// by a retry in the meantime, the movement is rolled back so only the retry can apply
+	ErrIdempotencyKeyLost = apperrors.New(http.StatusConflict, apperrors.CodeIdempotencyPending, "A request with this Idempotency-Key is still being processed")
+)
+
+// reserveAttempts bounds how often Reserve retries when the key is released under it
+const reserveAttempts = 3
+
+type IdempotencyRepoInterface interface {
+	Reserve(ctx context.Context, userID, key, requestHash string, ttl, pendingTimeout time.Duration) (*models.IdempotencyRecord, string, error)
+	Complete(ctx context.Context, claim models.IdempotencyClaim, status int, body []byte) error
+	Release(ctx context.Context, claim models.IdempotencyClaim) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type IdempotencyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdempotencyRepo(db *pgxpool.Pool) *IdempotencyRepo {
+	return &IdempotencyRepo{db: db}
+}
+
+// Reserve claims the key for a new request and returns the reservation ID identifying it. When
+// the key is taken it returns the existing record instead, so the caller can replay or reject
+// the request. A key still in progress after pendingTimeout that moved no money belongs to a
+// request that died, it is freed; one that moved money is kept until it expires.
+func (i *IdempotencyRepo) Reserve(ctx context.Context, userID, key, requestHash string, ttl, pendingTimeout time.Duration) (*models.IdempotencyRecord, string, error) {
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		record, reservationID, err := i.reserve(ctx, userID, key, requestHash, ttl, pendingTimeout)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return record, reservationID, err
+		}
+		// The other request released the key between our insert and select, try again
+	}
+	return nil, "", ErrIdempotencyKeyContended
+}
+
+func (i *IdempotencyRepo) reserve(ctx context.Context, userID, key, requestHash string, ttl, pendingTimeout time.Duration) (*models.IdempotencyRecord, string, error) {
+	// An expired key, or an abandoned one that moved nothing, can be reused as if it was never seen
+	deleteQuery := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2
+			AND (expires_at < NOW()
+				OR (response_status IS NULL AND transaction_id IS NULL AND created_at < NOW() - make_interval(secs => $3)))`
+
+	if _, err := i.db.Exec(ctx, deleteQuery, userID, key, pendingTimeout.Seconds()); err != nil {
+		return nil, "", err
+	}
+
+	// Both timestamps come from the database clock, like the NOW() they are compared with
+	reservationID := uuid.NewString()
+	insertQuery := `
+		INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, reservation_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW() + make_interval(secs => $5))
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING`
+
+	result, err := i.db.Exec(ctx, insertQuery, userID, key, requestHash, reservationID, ttl.Seconds())
+	if err != nil {
+		return nil, "", err
+	}
+	if result.RowsAffected() == 1 {
+		return nil, reservationID, nil
+	}
+
+	var record models.IdempotencyRecord
+	selectQuery := `
+		SELECT user_id, idempotency_key, request_hash, response_status, response_body, transaction_id::TEXT, created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2`
+
+	err = i.db.QueryRow(ctx, selectQuery, userID, key).Scan(
+		&record.UserID, &record.Key, &record.RequestHash, &record.ResponseStatus,
+		&record.ResponseBody, &record.TransactionID, &record.CreatedAt, &record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &record, "", nil
+}
+
+// recordIdempotentOutcome links the key reserved by the request to the transaction that moves the
+// money, inside the DB transaction moving it. A nil claim, for requests without a key, is left alone.
+func recordIdempotentOutcome(ctx context.Context, tx pgx.Tx, claim *models.IdempotencyClaim, transactionID string) error {
+	if claim == nil {
+		return nil
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET transaction_id = $4
+		WHERE user_id = $1 AND idempotency_key = $2 AND reservation_id = $3 AND transaction_id IS NULL`
+
+	result, err := tx.Exec(ctx, query, claim.UserID, claim.Key, claim.ReservationID, transactionID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrIdempotencyKeyLost
+	}
+	return nil
+}
+
+// Complete stores the response of the request that holds the key
+func (i *IdempotencyRepo) Complete(ctx context.Context, claim models.IdempotencyClaim, status int, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET response_status = $4, response_body = $5
+		WHERE user_id = $1 AND idempotency_key = $2 AND reservation_id = $3`
+
+	_, err := i.db.Exec(ctx, query, claim.UserID, claim.Key, claim.ReservationID, status, body)
+	return err
+}
+
+// Release frees the key so the client can retry a request that did not succeed. A key whose
+// request moved money is kept, a retry must not move it again.
+func (i *IdempotencyRepo) Release(ctx context.Context, claim models.IdempotencyClaim) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2 AND reservation_id = $3
+			AND response_status IS NULL AND transaction_id IS NULL`
+
+	_, err := i.db.Exec(ctx, query, claim.UserID, claim.Key, claim.ReservationID)
+	return err
+}
+
+// PurgeExpired removes every key past its expiry
+func (i *IdempotencyRepo) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := i.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+var ErrUnbalancedJournal = errors.New("ledger journal is unbalanced")
+
+// PostJournal writes a journal and its entries inside the caller's DB transaction.
+// The database rejects the commit as well if the entries do not balance.
+func PostJournal(ctx context.Context, tx pgx.Tx, journal *models.Journal) error {
+	if !journal.Balanced() {
+		return ErrUnbalancedJournal
+	}
+
+	var transactionID *string
+	if journal.TransactionID != "" {
+		transactionID = &journal.TransactionID
+	}
+
+	journalQuery := `
+		INSERT INTO ledger_journals (id, transaction_id, kind, description, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := tx.Exec(ctx, journalQuery, journal.ID, transactionID, journal.Kind, journal.Description, journal.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	entryQuery := `
+		INSERT INTO ledger_entries (journal_id, account_id, direction, amount, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	batch := &pgx.Batch{}
+	for _, entry := range journal.Entries {
+		batch.Queue(entryQuery, journal.ID, entry.AccountID, entry.Direction, entry.Amount, journal.CreatedAt)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
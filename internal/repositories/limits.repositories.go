@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// ErrLimitExceeded is returned with a models.LimitViolation as details naming the limit
+var ErrLimitExceeded = apperrors.New(http.StatusUnprocessableEntity, apperrors.CodeLimitExceeded, "Transaction limit exceeded")
+
+func newMoneyLimitError(code models.LimitCode, limits *models.TransactionLimits, limit, used pkg.Money) error {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return ErrLimitExceeded.WithDetails(models.LimitViolation{
+		Code:      code,
+		KYCLevel:  limits.KYCLevel,
+		Limit:     limit.String(),
+		Remaining: remaining.String(),
+	})
+}
+
+// getLimits loads the limits of the user's KYC level inside tx
+func getLimits(ctx context.Context, tx pgx.Tx, userID string) (*models.TransactionLimits, error) {
+	query := `
+		SELECT l.kyc_level, l.max_balance, l.max_transaction, l.daily_outgoing, l.monthly_outgoing, l.hourly_transfers
+		FROM users u
+			JOIN transaction_limits l ON l.kyc_level = u.kyc_level
+		WHERE u.id = $1`
+
+	var limits models.TransactionLimits
+	err := tx.QueryRow(ctx, query, userID).Scan(
+		&limits.KYCLevel,
+		&limits.MaxBalance,
+		&limits.MaxTransaction,
+		&limits.DailyOutgoing,
+		&limits.MonthlyOutgoing,
+		&limits.HourlyTransfers,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// checkIncomingLimits makes sure a credit keeps the wallet under the maximum balance.
+// The wallet must already be locked in tx.
+func checkIncomingLimits(ctx context.Context, tx pgx.Tx, userID string, balance, amount pkg.Money) error {
+	limits, err := getLimits(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Without a maximum the wallet still cannot hold more than pkg.Money can count. Comparing with
+	// the room left never overflows, balance+amount could.
+	maxBalance := pkg.Money(math.MaxInt64)
+	if limits.MaxBalance != nil {
+		maxBalance = *limits.MaxBalance
+	}
+	if amount > maxBalance-balance {
+		return newMoneyLimitError(models.LimitMaxBalance, limits, maxBalance, balance)
+	}
+	return nil
+}
+
+// checkOutgoingLimits makes sure a debit stays within the per-transaction, daily and monthly
+// caps, and for transfers within the hourly count. PENDING transfers count as spent. The wallet
+// must already be locked in tx so concurrent debits are checked one after the other.
+func checkOutgoingLimits(ctx context.Context, tx pgx.Tx, userID, walletID string, amount pkg.Money, transfer bool) error {
+	limits, err := getLimits(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxTransaction != nil && amount > *limits.MaxTransaction {
+		return newMoneyLimitError(models.LimitMaxTransaction, limits, *limits.MaxTransaction, 0)
+	}
+
+	if limits.DailyOutgoing != nil || limits.MonthlyOutgoing != nil {
+		totalsQuery := `
+			SELECT
+				COALESCE(SUM(h.amount) FILTER (WHERE h.created_at >= date_trunc('day', NOW())), 0)::NUMERIC(20,2),
+				COALESCE(SUM(h.amount), 0)::NUMERIC(20,2)
+			FROM transaction_history h
+			WHERE h.wallet_id = $1
+				AND h.direction = $2
+				AND h.status IN ($3, $4)
+				AND h.created_at >= date_trunc('month', NOW())`
+
+		var daily, monthly pkg.Money
+		err := tx.QueryRow(ctx, totalsQuery, walletID, models.TransactionDirectionOut,
+			models.TransactionStatusSuccess, models.TransactionStatusPending).Scan(&daily, &monthly)
+		if err != nil {
+			return err
+		}
+
+		if limits.DailyOutgoing != nil && daily+amount > *limits.DailyOutgoing {
+			return newMoneyLimitError(models.LimitDailyOutgoing, limits, *limits.DailyOutgoing, daily)
+		}
+		if limits.MonthlyOutgoing != nil && monthly+amount > *limits.MonthlyOutgoing {
+			return newMoneyLimitError(models.LimitMonthlyOutgoing, limits, *limits.MonthlyOutgoing, monthly)
+		}
+	}
+
+	if transfer && limits.HourlyTransfers != nil {
+		countQuery := `
+			SELECT COUNT(*)
+			FROM transactions t
+				JOIN transfer tr ON tr.transaction_id = t.id
+			WHERE t.wallet_id = $1 AND t.status <> $2 AND t.created_at >= NOW() - INTERVAL '1 hour'`
+
+		var count int
+		if err := tx.QueryRow(ctx, countQuery, walletID, models.TransactionStatusFailed).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= *limits.HourlyTransfers {
+			return ErrLimitExceeded.WithDetails(models.LimitViolation{
+				Code:      models.LimitHourlyTransfers,
+				KYCLevel:  limits.KYCLevel,
+				Limit:     strconv.Itoa(*limits.HourlyTransfers),
+				Remaining: "0",
+			})
+		}
+	}
+
+	return nil
+}
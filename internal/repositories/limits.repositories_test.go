@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// limitedUser creates a user whose wallet holds balance, then moves it to a KYC level of its own
+// with the given limits
+func limitedUser(t *testing.T, repo *TransactionRepo, pool *pgxpool.Pool, limits models.TransactionLimits, balance pkg.Money) string {
+	t.Helper()
+	ctx := context.Background()
+	userID := fundedUser(t, repo, pool, balance)
+
+	level := "T-" + uuid.NewString()[:18]
+	levelQuery := `
+		INSERT INTO transaction_limits (kyc_level, max_balance, max_transaction, daily_outgoing, monthly_outgoing, hourly_transfers)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := pool.Exec(ctx, levelQuery, level, limits.MaxBalance, limits.MaxTransaction,
+		limits.DailyOutgoing, limits.MonthlyOutgoing, limits.HourlyTransfers)
+	if err != nil {
+		t.Fatalf("create KYC level: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE users SET kyc_level = $1 WHERE id = $2`, level, userID); err != nil {
+		t.Fatalf("set KYC level: %v", err)
+	}
+	return userID
+}
+
+// limitViolation returns the details of an ErrLimitExceeded, failing the test for any other error
+func limitViolation(t *testing.T, err error) models.LimitViolation {
+	t.Helper()
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("error = %v, want ErrLimitExceeded", err)
+	}
+	violation, ok := apperrors.From(err).Details.(models.LimitViolation)
+	if !ok {
+		t.Fatalf("details = %v, want a LimitViolation", apperrors.From(err).Details)
+	}
+	return violation
+}
+
+func TestLimitsRefuseTheMovementOverTheLimit(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	hundred := pkg.NewMoney(100, 0)
+	oneFifty := pkg.NewMoney(150, 0)
+	thousand := pkg.NewMoney(1000, 0)
+	oneTransfer := 1
+
+	payment := func(userID string, amount pkg.Money) error {
+		_, err := repo.Payment(ctx, userID, amount, "limit test", nil, nil)
+		return err
+	}
+	topUp := func(userID string, amount pkg.Money) error {
+		_, err := repo.TopUp(ctx, userID, amount, nil)
+		return err
+	}
+	recipientID := fundedUser(t, repo, pool, 0)
+	transfer := func(userID string, amount pkg.Money) error {
+		_, err := repo.Transfer(ctx, userID, recipientID, amount, "limit test", nil, nil)
+		return err
+	}
+
+	tests := []struct {
+		name          string
+		limits        models.TransactionLimits
+		move          func(userID string, amount pkg.Money) error
+		allowed       pkg.Money
+		refused       pkg.Money
+		want          models.LimitCode
+		wantLimit     pkg.Money
+		wantRemaining pkg.Money
+	}{
+		{
+			name:          "per transaction",
+			limits:        models.TransactionLimits{MaxTransaction: &hundred},
+			move:          payment,
+			allowed:       hundred,
+			refused:       hundred + 1,
+			want:          models.LimitMaxTransaction,
+			wantLimit:     hundred,
+			wantRemaining: hundred,
+		},
+		{
+			name:          "daily outgoing",
+			limits:        models.TransactionLimits{DailyOutgoing: &oneFifty},
+			move:          payment,
+			allowed:       hundred,
+			refused:       pkg.NewMoney(60, 0),
+			want:          models.LimitDailyOutgoing,
+			wantLimit:     oneFifty,
+			wantRemaining: pkg.NewMoney(50, 0),
+		},
+		{
+			name:          "monthly outgoing",
+			limits:        models.TransactionLimits{MonthlyOutgoing: &oneFifty},
+			move:          transfer,
+			allowed:       hundred,
+			refused:       pkg.NewMoney(60, 0),
+			want:          models.LimitMonthlyOutgoing,
+			wantLimit:     oneFifty,
+			wantRemaining: pkg.NewMoney(50, 0),
+		},
+		{
+			name:          "max balance",
+			limits:        models.TransactionLimits{MaxBalance: &thousand},
+			move:          topUp,
+			allowed:       pkg.NewMoney(400, 0),
+			refused:       pkg.NewMoney(1, 0),
+			want:          models.LimitMaxBalance,
+			wantLimit:     thousand,
+			wantRemaining: 0,
+		},
+		{
+			name:    "hourly transfers",
+			limits:  models.TransactionLimits{HourlyTransfers: &oneTransfer},
+			move:    transfer,
+			allowed: hundred,
+			refused: hundred,
+			want:    models.LimitHourlyTransfers,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := limitedUser(t, repo, pool, tt.limits, pkg.NewMoney(600, 0))
+
+			if err := tt.move(userID, tt.allowed); err != nil {
+				t.Fatalf("movement within the limit: %v", err)
+			}
+			before := walletBalance(t, repo, userID)
+
+			violation := limitViolation(t, tt.move(userID, tt.refused))
+			if violation.Code != tt.want {
+				t.Errorf("limit code = %s, want %s", violation.Code, tt.want)
+			}
+			if tt.want != models.LimitHourlyTransfers {
+				if violation.Limit != tt.wantLimit.String() {
+					t.Errorf("limit = %s, want %s", violation.Limit, tt.wantLimit)
+				}
+				if violation.Remaining != tt.wantRemaining.String() {
+					t.Errorf("remaining = %s, want %s", violation.Remaining, tt.wantRemaining)
+				}
+			}
+
+			if balance := walletBalance(t, repo, userID); balance != before {
+				t.Errorf("refused movement changed the balance from %s to %s", before, balance)
+			}
+		})
+	}
+}
+
+func TestUnlimitedLevelStopsAtTheMoneyRange(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	// testdb users are on a KYC level with every limit NULL
+	userID := fundedUser(t, repo, pool, 0)
+	large := pkg.Money(math.MaxInt64 / 2)
+
+	if _, err := repo.TopUp(ctx, userID, large, nil); err != nil {
+		t.Fatalf("large top-up on the unlimited level: %v", err)
+	}
+	if _, err := repo.Payment(ctx, userID, large/2, "large payment", nil, nil); err != nil {
+		t.Fatalf("large payment on the unlimited level: %v", err)
+	}
+
+	// Another top-up would wrap the balance around
+	balance := walletBalance(t, repo, userID)
+	_, err := repo.TopUp(ctx, userID, pkg.Money(math.MaxInt64)-balance+1, nil)
+	if violation := limitViolation(t, err); violation.Code != models.LimitMaxBalance {
+		t.Errorf("limit code = %s, want %s", violation.Code, models.LimitMaxBalance)
+	}
+	if after := walletBalance(t, repo, userID); after != balance {
+		t.Errorf("balance changed from %s to %s", balance, after)
+	}
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+var ErrInvalidCode = apperrors.New(http.StatusUnprocessableEntity, apperrors.CodeInvalidCode, "Invalid or expired code")
+
+type OneTimeCodeRepoInterface interface {
+	Create(ctx context.Context, userID string, purpose models.OneTimeCodePurpose, codeHash string, ttl, resendInterval time.Duration) (bool, error)
+	Consume(ctx context.Context, userID string, purpose models.OneTimeCodePurpose, codeHash string, maxAttempts int) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type OneTimeCodeRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOneTimeCodeRepo(db *pgxpool.Pool) *OneTimeCodeRepo {
+	return &OneTimeCodeRepo{db: db}
+}
+
+// Create stores a new code for the purpose and voids the previous ones. It returns false
+// without storing anything when the last code was created less than resendInterval ago.
+func (o *OneTimeCodeRepo) Create(ctx context.Context, userID string, purpose models.OneTimeCodePurpose, codeHash string, ttl, resendInterval time.Duration) (bool, error) {
+	tx, err := o.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize code requests of the user
+	if _, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return false, err
+	}
+
+	var recent bool
+	recentQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM one_time_codes
+			WHERE user_id = $1 AND purpose = $2 AND created_at > NOW() - make_interval(secs => $3)
+		)`
+	if err := tx.QueryRow(ctx, recentQuery, userID, purpose, resendInterval.Seconds()).Scan(&recent); err != nil {
+		return false, err
+	}
+	if recent {
+		return false, nil
+	}
+
+	voidQuery := `
+		UPDATE one_time_codes
+		SET consumed_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL`
+	if _, err := tx.Exec(ctx, voidQuery, userID, purpose); err != nil {
+		return false, err
+	}
+
+	insertQuery := `
+		INSERT INTO one_time_codes (user_id, purpose, code_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))`
+	if _, err := tx.Exec(ctx, insertQuery, userID, purpose, codeHash, ttl.Seconds()); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Consume uses up the current code of the purpose when codeHash matches. Every wrong guess
+// counts, after maxAttempts the code is void and ErrInvalidCode is returned whatever the guess.
+func (o *OneTimeCodeRepo) Consume(ctx context.Context, userID string, purpose models.OneTimeCodePurpose, codeHash string, maxAttempts int) error {
+	tx, err := o.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var id, storedHash string
+	var attempts int
+	selectQuery := `
+		SELECT id, code_hash, attempts
+		FROM one_time_codes
+		WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE`
+	err = tx.QueryRow(ctx, selectQuery, userID, purpose).Scan(&id, &storedHash, &attempts)
+	if err == pgx.ErrNoRows {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+
+	if attempts >= maxAttempts || storedHash != codeHash {
+		if _, err := tx.Exec(ctx, `UPDATE one_time_codes SET attempts = attempts + 1 WHERE id = $1`, id); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		return ErrInvalidCode
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE one_time_codes SET consumed_at = NOW() WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgeExpired removes codes past their expiry
+func (o *OneTimeCodeRepo) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := o.db.Exec(ctx, `DELETE FROM one_time_codes WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+)
+
+const (
+	testCodeHash  = "code-hash"
+	wrongCodeHash = "wrong-hash"
+)
+
+func TestOneTimeCodeResendInterval(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewOneTimeCodeRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+
+	created, err := repo.Create(ctx, userID, models.OneTimeCodePinReset, testCodeHash, time.Hour, time.Minute)
+	if err != nil || !created {
+		t.Fatalf("first code: created = %v, %v, want true", created, err)
+	}
+
+	// Asking again within the interval sends nothing and keeps the first code
+	created, err = repo.Create(ctx, userID, models.OneTimeCodePinReset, "resent-hash", time.Hour, time.Minute)
+	if err != nil || created {
+		t.Fatalf("code within the resend interval: created = %v, %v, want false", created, err)
+	}
+
+	// Another purpose has an interval of its own
+	created, err = repo.Create(ctx, userID, models.OneTimeCodeUnlock, testCodeHash, time.Hour, time.Minute)
+	if err != nil || !created {
+		t.Errorf("code for another purpose: created = %v, %v, want true", created, err)
+	}
+
+	if err := repo.Consume(ctx, userID, models.OneTimeCodePinReset, testCodeHash, 3); err != nil {
+		t.Errorf("consume the first code: %v", err)
+	}
+}
+
+func TestOneTimeCodeNewCodeVoidsThePreviousOne(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewOneTimeCodeRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+
+	if _, err := repo.Create(ctx, userID, models.OneTimeCodePinReset, "old-hash", time.Hour, 0); err != nil {
+		t.Fatalf("first code: %v", err)
+	}
+	if created, err := repo.Create(ctx, userID, models.OneTimeCodePinReset, testCodeHash, time.Hour, 0); err != nil || !created {
+		t.Fatalf("second code: created = %v, %v, want true", created, err)
+	}
+
+	if err := repo.Consume(ctx, userID, models.OneTimeCodePinReset, "old-hash", 3); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("previous code returned %v, want ErrInvalidCode", err)
+	}
+	if err := repo.Consume(ctx, userID, models.OneTimeCodePinReset, testCodeHash, 3); err != nil {
+		t.Errorf("current code: %v", err)
+	}
+}
+
+func TestOneTimeCodeAttemptCap(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewOneTimeCodeRepo(pool)
+	ctx := context.Background()
+
+	const maxAttempts = 3
+	userID := testdb.CreateUser(t, pool)
+
+	if _, err := repo.Create(ctx, userID, models.OneTimeCodePinReset, testCodeHash, time.Hour, 0); err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		if err := repo.Consume(ctx, userID, models.OneTimeCodePinReset, wrongCodeHash, maxAttempts); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("wrong guess %d returned %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+
+	// Out of attempts the right code is refused as well
+	if err := repo.Consume(ctx, userID, models.OneTimeCodePinReset, testCodeHash, maxAttempts); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("right code after %d wrong guesses returned %v, want ErrInvalidCode", maxAttempts, err)
+	}
+}
+
+func TestOneTimeCodeIsConsumedOnce(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewOneTimeCodeRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+
+	if _, err := repo.Create(ctx, userID, models.OneTimeCodeUnlock, testCodeHash, time.Hour, 0); err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+
+	// A wrong guess below the cap leaves the code usable
+	if err := repo.Consume(ctx, userID, models.OneTimeCodeUnlock, wrongCodeHash, 3); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("wrong guess returned %v, want ErrInvalidCode", err)
+	}
+	if err := repo.Consume(ctx, userID, models.OneTimeCodeUnlock, testCodeHash, 3); err != nil {
+		t.Fatalf("right code: %v", err)
+	}
+	if err := repo.Consume(ctx, userID, models.OneTimeCodeUnlock, testCodeHash, 3); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("consumed code returned %v, want ErrInvalidCode", err)
+	}
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+// OutboxPublisher delivers one outbox message, returning an error if the broker did not accept it
+type OutboxPublisher func(ctx context.Context, msg models.OutboxMessage) error
+
+type OutboxRepoInterface interface {
+	RelayPending(ctx context.Context, limit int, publish OutboxPublisher) (int, error)
+	RequeuePendingTransfers(ctx context.Context) (int, error)
+}
+
+type OutboxRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOutboxRepo(db *pgxpool.Pool) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+// insertOutbox writes a message inside the caller's DB transaction
+func insertOutbox(ctx context.Context, tx pgx.Tx, msg *models.OutboxMessage) error {
+	query := `
+		INSERT INTO outbox (id, aggregate_id, routing_key, payload, status)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := tx.Exec(ctx, query, msg.ID, msg.AggregateID, msg.RoutingKey, msg.Payload, msg.Status)
+	return err
+}
+
+// RelayPending publishes up to limit pending messages in creation order and marks them SENT.
+// Rows are claimed with SKIP LOCKED so several relays can run side by side. The batch stops at
+// the first publish error so the remaining messages keep their order for the next attempt.
+func (o *OutboxRepo) RelayPending(ctx context.Context, limit int, publish OutboxPublisher) (int, error) {
+	tx, err := o.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id, aggregate_id, routing_key, payload, status, attempts, COALESCE(last_error, ''), created_at
+		FROM outbox
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.Query(ctx, query, models.OutboxStatusPending, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var msg models.OutboxMessage
+		if err := rows.Scan(&msg.ID, &msg.AggregateID, &msg.RoutingKey, &msg.Payload,
+			&msg.Status, &msg.Attempts, &msg.LastError, &msg.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, msg := range messages {
+		if publishErr := publish(ctx, msg); publishErr != nil {
+			failQuery := `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`
+			if _, err := tx.Exec(ctx, failQuery, msg.ID, publishErr.Error()); err != nil {
+				return sent, err
+			}
+			break
+		}
+
+		sentQuery := `UPDATE outbox SET status = $2, attempts = attempts + 1, last_error = NULL, sent_at = NOW() WHERE id = $1`
+		if _, err := tx.Exec(ctx, sentQuery, msg.ID, models.OutboxStatusSent); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// RequeuePendingTransfers marks the last message of every transfer that is still PENDING as
+// unsent again, so the relay publishes it once more. The in-memory queue loses the messages it
+// held on restart; processing a transfer twice is harmless.
+func (o *OutboxRepo) RequeuePendingTransfers(ctx context.Context) (int, error) {
+	query := `
+		UPDATE outbox o
+		SET status = $1, sent_at = NULL
+		FROM transactions t
+		WHERE t.id = o.aggregate_id
+			AND t.status = $2
+			AND o.status = $3
+			AND o.created_at = (SELECT MAX(created_at) FROM outbox WHERE aggregate_id = o.aggregate_id)`
+
+	result, err := o.db.Exec(ctx, query, models.OutboxStatusPending, models.TransactionStatusPending, models.OutboxStatusSent)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// relayAll publishes every pending outbox message and returns how often each aggregate was published
+func relayAll(t *testing.T, outbox *OutboxRepo) map[string]int {
+	t.Helper()
+
+	published := map[string]int{}
+	publish := func(ctx context.Context, msg models.OutboxMessage) error {
+		published[msg.AggregateID]++
+		return nil
+	}
+	for {
+		sent, err := outbox.RelayPending(context.Background(), 100, publish)
+		if err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		if sent < 100 {
+			return published
+		}
+	}
+}
+
+func TestRequeuePendingTransfersAfterRestart(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	outbox := NewOutboxRepo(pool)
+	ctx := context.Background()
+
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(1000, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	pending, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(100, 0), "lost on restart", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	settled, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(100, 0), "settled", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+
+	// Both messages reach the queue, only one is processed before the process stops
+	if published := relayAll(t, outbox); published[pending.ID] != 1 || published[settled.ID] != 1 {
+		t.Fatalf("first relay published %v, want both transfers once", published)
+	}
+	if err := repo.ProcessTransfer(ctx, settled.ID); err != nil {
+		t.Fatalf("process transfer: %v", err)
+	}
+
+	if _, err := outbox.RequeuePendingTransfers(ctx); err != nil {
+		t.Fatalf("requeue: %v", err)
+	}
+
+	published := relayAll(t, outbox)
+	if published[pending.ID] != 1 {
+		t.Errorf("pending transfer was published %d times after the restart, want 1", published[pending.ID])
+	}
+	if published[settled.ID] != 0 {
+		t.Errorf("settled transfer was published %d times after the restart, want 0", published[settled.ID])
+	}
+}
+
+func TestTransferIsPublishedThroughTheOutbox(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	outbox := NewOutboxRepo(pool)
+	ctx := context.Background()
+
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	// A refused transfer leaves no message behind
+	if _, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(500, 0), "refused", nil, nil); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("unaffordable transfer returned %v, want ErrInsufficientBalance", err)
+	}
+	transfer, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(40, 0), "outbox", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+
+	var messages int
+	countQuery := `SELECT COUNT(*) FROM outbox WHERE payload->>'sender_id' = $1`
+	if err := pool.QueryRow(ctx, countQuery, senderID).Scan(&messages); err != nil {
+		t.Fatalf("count messages: %v", err)
+	}
+	if messages != 1 {
+		t.Fatalf("%d outbox messages for the sender, want 1", messages)
+	}
+
+	// The broker refuses the message, it stays pending for the next run
+	brokerDown := errors.New("broker unavailable")
+	failures := 0
+	failing := func(ctx context.Context, msg models.OutboxMessage) error {
+		if msg.AggregateID == transfer.ID {
+			failures++
+			return brokerDown
+		}
+		return nil
+	}
+	for {
+		sent, err := outbox.RelayPending(ctx, 100, failing)
+		if err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		if sent == 0 {
+			break
+		}
+	}
+
+	var attempts int
+	var lastError string
+	stateQuery := `SELECT attempts, COALESCE(last_error, '') FROM outbox WHERE aggregate_id = $1 AND status = $2`
+	if err := pool.QueryRow(ctx, stateQuery, transfer.ID, models.OutboxStatusPending).Scan(&attempts, &lastError); err != nil {
+		t.Fatalf("read pending message: %v", err)
+	}
+	if attempts != failures || lastError != brokerDown.Error() {
+		t.Errorf("message has %d attempts and error %q, want %d and %q", attempts, lastError, failures, brokerDown)
+	}
+
+	// Once the broker is back the message goes out with the transfer in its payload
+	var payload pkg.TransferMessage
+	publish := func(ctx context.Context, msg models.OutboxMessage) error {
+		if msg.AggregateID == transfer.ID {
+			return json.Unmarshal(msg.Payload, &payload)
+		}
+		return nil
+	}
+	if _, err := outbox.RelayPending(ctx, 100, publish); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	want := pkg.TransferMessage{TransferID: transfer.ID, SenderID: senderID, RecipientID: recipientID, Amount: pkg.NewMoney(40, 0), Remarks: "outbox"}
+	if payload != want {
+		t.Errorf("published %+v, want %+v", payload, want)
+	}
+
+	if published := relayAll(t, outbox); published[transfer.ID] != 0 {
+		t.Errorf("sent message was published %d more times", published[transfer.ID])
+	}
+}
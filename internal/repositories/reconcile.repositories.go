@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/pkg"
+)
+
+type ReconcileRepoInterface interface {
+	Reconcile(ctx context.Context, stuckAfter time.Duration) (*models.ReconciliationReport, error)
+}
+
+type ReconcileRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewReconcileRepo(db *pgxpool.Pool) *ReconcileRepo {
+	return &ReconcileRepo{db: db}
+}
+
+// Reconcile recomputes every wallet from its transaction history and its ledger entries and
+// looks for transfers that were never credited or never settled. It only reads, the whole run
+// uses one repeatable read snapshot so concurrent transfers cannot show up as false positives.
+func (r *ReconcileRepo) Reconcile(ctx context.Context, stuckAfter time.Duration) (*models.ReconciliationReport, error) {
+	report := &models.ReconciliationReport{
+		StartedAt:     time.Now(),
+		Discrepancies: []models.Discrepancy{},
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := r.checkWallets(ctx, tx, report); err != nil {
+		return nil, err
+	}
+	if err := r.checkTransfers(ctx, tx, report, stuckAfter); err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// checkWallets compares each wallet balance with its successful transactions and its ledger account.
+// The sender leg of a transfer is the row referenced by transfer.transaction_id, every other
+// transfer row is a credit to the recipient.
+func (r *ReconcileRepo) checkWallets(ctx context.Context, tx pgx.Tx, report *models.ReconciliationReport) error {
+	query := `
+		SELECT
+			w.id,
+			w.user_id,
+			w.balance,
+			COALESCE(SUM(
+				CASE
+					WHEN t.transaction_type_id = $1 THEN t.amount
+					WHEN t.transaction_type_id = $2 THEN -t.amount
+					WHEN t.transaction_type_id = $3 AND tr.transaction_id IS NOT NULL THEN -t.amount
+					WHEN t.transaction_type_id = $3 THEN t.amount
+					ELSE 0
+				END
+			) FILTER (WHERE t.status = $4), 0)::NUMERIC(20,2),
+			COALESCE(lb.balance, 0)
+		FROM wallets w
+			LEFT JOIN transactions t ON t.wallet_id = w.id
+			LEFT JOIN transfer tr ON tr.transaction_id = t.id
+			LEFT JOIN ledger_account_balances lb ON lb.account_id = w.id
+		GROUP BY w.id, w.user_id, w.balance, lb.balance
+		ORDER BY w.id`
+
+	rows, err := tx.Query(ctx, query, models.TransactionTypeTopUp, models.TransactionTypePayment,
+		models.TransactionTypeTransfer, models.TransactionStatusSuccess)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var walletID, userID string
+		var balance, history, ledger pkg.Money
+		if err := rows.Scan(&walletID, &userID, &balance, &history, &ledger); err != nil {
+			return err
+		}
+		report.WalletsChecked++
+
+		if balance != history {
+			report.Discrepancies = append(report.Discrepancies, models.Discrepancy{
+				Type:     models.DiscrepancyWalletHistory,
+				WalletID: walletID,
+				UserID:   userID,
+				Expected: history,
+				Actual:   balance,
+				Detail:   fmt.Sprintf("wallet balance is off by %s from its transaction history", balance-history),
+			})
+		}
+		if balance != ledger {
+			report.Discrepancies = append(report.Discrepancies, models.Discrepancy{
+				Type:     models.DiscrepancyWalletLedger,
+				WalletID: walletID,
+				UserID:   userID,
+				Expected: ledger,
+				Actual:   balance,
+				Detail:   fmt.Sprintf("wallet balance is off by %s from its ledger account", balance-ledger),
+			})
+		}
+	}
+
+	return rows.Err()
+}
+
+// checkTransfers finds successful transfers without a credit on the recipient wallet and transfers
+// stuck in PENDING. Transfers settled before credit_transaction_id existed are matched to an
+// unlinked credit of the same amount on the recipient wallet created after the transfer.
+func (r *ReconcileRepo) checkTransfers(ctx context.Context, tx pgx.Tx, report *models.ReconciliationReport, stuckAfter time.Duration) error {
+	query := `
+		SELECT
+			t.id,
+			t.wallet_id,
+			tr.sender_user,
+			t.amount,
+			t.status,
+			t.status = $2 AND tr.credit_transaction_id IS NULL AND NOT EXISTS (
+				SELECT 1
+				FROM transactions c
+					JOIN wallets rw ON rw.id = c.wallet_id
+				WHERE rw.user_id = tr.target_user
+					AND c.transaction_type_id = $1
+					AND c.amount = t.amount
+					AND c.created_at >= t.created_at
+					AND NOT EXISTS (SELECT 1 FROM transfer x WHERE x.transaction_id = c.id)
+			) AS missing_credit,
+			t.status = $3 AND t.created_at < NOW() - make_interval(secs => $4) AS stuck
+		FROM transactions t
+			JOIN transfer tr ON tr.transaction_id = t.id
+		ORDER BY t.created_at`
+
+	rows, err := tx.Query(ctx, query, models.TransactionTypeTransfer, models.TransactionStatusSuccess,
+		models.TransactionStatusPending, stuckAfter.Seconds())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transactionID, walletID, senderID string
+		var amount pkg.Money
+		var status models.TransactionStatus
+		var missingCredit, stuck bool
+		if err := rows.Scan(&transactionID, &walletID, &senderID, &amount, &status, &missingCredit, &stuck); err != nil {
+			return err
+		}
+		report.TransfersChecked++
+
+		if missingCredit {
+			report.Discrepancies = append(report.Discrepancies, models.Discrepancy{
+				Type:          models.DiscrepancyMissingCredit,
+				WalletID:      walletID,
+				UserID:        senderID,
+				TransactionID: transactionID,
+				Expected:      amount,
+				Actual:        0,
+				Detail:        "transfer is SUCCESS but the recipient wallet was never credited",
+			})
+		}
+		if stuck {
+			report.Discrepancies = append(report.Discrepancies, models.Discrepancy{
+				Type:          models.DiscrepancyStuckTransfer,
+				WalletID:      walletID,
+				UserID:        senderID,
+				TransactionID: transactionID,
+				Expected:      amount,
+				Actual:        0,
+				Detail:        fmt.Sprintf("transfer has been %s for more than %s", status, stuckAfter),
+			})
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+	"github.com/redha28/foomlet/pkg"
+)
+
+func TestReconcileReportsMismatchesAndStuckTransfers(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	reconcile := NewReconcileRepo(pool)
+	ctx := context.Background()
+
+	// A wallet whose balance was changed behind the history and the ledger
+	driftedID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	driftedWallet, _, err := repo.GetWalletByUserID(ctx, driftedID)
+	if err != nil {
+		t.Fatalf("get wallet: %v", err)
+	}
+	drift := pkg.NewMoney(5, 0)
+	if _, err := pool.Exec(ctx, `UPDATE wallets SET balance = balance + $1 WHERE id = $2`, drift, driftedWallet); err != nil {
+		t.Fatalf("change balance: %v", err)
+	}
+
+	// A transfer nobody processed, and a wallet that is in order
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+	stuck, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(30, 0), "stuck", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	backdateTransfer(t, pool, stuck.ID)
+	recent, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(10, 0), "recent", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	senderWallet, _, err := repo.GetWalletByUserID(ctx, senderID)
+	if err != nil {
+		t.Fatalf("get wallet: %v", err)
+	}
+
+	report, err := reconcile.Reconcile(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.Clean() {
+		t.Fatal("report is clean")
+	}
+
+	found := make(map[models.DiscrepancyType]map[string]models.Discrepancy)
+	for _, discrepancy := range report.Discrepancies {
+		if found[discrepancy.Type] == nil {
+			found[discrepancy.Type] = make(map[string]models.Discrepancy)
+		}
+		found[discrepancy.Type][discrepancy.WalletID+"/"+discrepancy.TransactionID] = discrepancy
+	}
+
+	for _, kind := range []models.DiscrepancyType{models.DiscrepancyWalletHistory, models.DiscrepancyWalletLedger} {
+		discrepancy, ok := found[kind][driftedWallet+"/"]
+		if !ok {
+			t.Errorf("no %s for the drifted wallet", kind)
+			continue
+		}
+		if discrepancy.Actual-discrepancy.Expected != drift {
+			t.Errorf("%s is off by %s, want %s", kind, discrepancy.Actual-discrepancy.Expected, drift)
+		}
+	}
+
+	if discrepancy, ok := found[models.DiscrepancyStuckTransfer][senderWallet+"/"+stuck.ID]; !ok {
+		t.Error("stuck transfer is not reported")
+	} else if discrepancy.UserID != senderID || discrepancy.Expected != stuck.Amount {
+		t.Errorf("stuck transfer reported as %+v", discrepancy)
+	}
+	if _, ok := found[models.DiscrepancyStuckTransfer][senderWallet+"/"+recent.ID]; ok {
+		t.Error("transfer younger than stuckAfter is reported as stuck")
+	}
+
+	// Pending transfers have not moved money yet, the sender's wallet is in order
+	for kind, discrepancies := range found {
+		if _, ok := discrepancies[senderWallet+"/"]; ok {
+			t.Errorf("sender wallet reported with %s", kind)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+var (
+	ErrSessionNotFound    = apperrors.New(http.StatusNotFound, apperrors.CodeSessionNotFound, "Session not found")
+	ErrSessionNotActive   = apperrors.New(http.StatusUnauthorized, apperrors.CodeSessionRevoked, "Session has been revoked or has expired")
+	ErrRefreshTokenReused = apperrors.New(http.StatusUnauthorized, apperrors.CodeRefreshTokenReused, "Refresh token was already used, the session has been revoked")
+)
+
+type SessionRepoInterface interface {
+	Create(ctx context.Context, userID, jti string, expiresAt time.Time, device models.DeviceInfo) (*models.Session, error)
+	Rotate(ctx context.Context, jti, nextJTI string, expiresAt time.Time, lifetime time.Duration, device models.DeviceInfo) (*models.Session, error)
+	GetActiveSessions(ctx context.Context, userID string) ([]models.Session, error)
+	Revoke(ctx context.Context, userID, sessionID string, reason models.SessionRevokedReason) error
+	RevokeAll(ctx context.Context, userID string, reason models.SessionRevokedReason) (int64, error)
+	Touch(ctx context.Context, sessionID string) (bool, error)
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type SessionRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepo(db *pgxpool.Pool) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+const sessionColumns = `id, user_id, created_at, last_used_at, expires_at, user_agent, ip_address, revoked_at, revoked_reason`
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.LastUsedAt,
+		&session.ExpiresAt, &session.UserAgent, &session.IPAddress, &session.RevokedAt, &session.RevokedReason)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Create starts a session for a login on device together with its first refresh token
+func (s *SessionRepo) Create(ctx context.Context, userID, jti string, expiresAt time.Time, device models.DeviceInfo) (*models.Session, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	session, err := scanSession(tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+sessionColumns, userID, expiresAt, device.UserAgent, device.IPAddress))
+	if err != nil {
+		return nil, err
+	}
+
+	insertToken := `INSERT INTO refresh_tokens (jti, session_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, insertToken, jti, session.ID, expiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Rotate uses up the refresh token jti and registers nextJTI as its successor. A token that was
+// already used means it leaked: the whole session is revoked and ErrRefreshTokenReused returned.
+// The session remembers the device of the latest refresh and never outlives lifetime after its login.
+func (s *SessionRepo) Rotate(ctx context.Context, jti, nextJTI string, expiresAt time.Time, lifetime time.Duration, device models.DeviceInfo) (*models.Session, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var sessionID string
+	var usedAt *time.Time
+	lockToken := `SELECT session_id, used_at FROM refresh_tokens WHERE jti = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, lockToken, jti).Scan(&sessionID, &usedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotActive
+		}
+		return nil, err
+	}
+
+	session, err := scanSession(tx.QueryRow(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE id = $1
+		FOR UPDATE`, sessionID))
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, ErrSessionNotActive
+	}
+
+	if usedAt != nil {
+		if err := revokeSession(ctx, tx, sessionID, models.SessionRevokedReuse); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	useToken := `UPDATE refresh_tokens SET used_at = NOW(), replaced_by = $2 WHERE jti = $1`
+	if _, err := tx.Exec(ctx, useToken, jti, nextJTI); err != nil {
+		return nil, err
+	}
+
+	// Every refresh keeps the session alive for another refresh token lifetime, up to its lifetime
+	session, err = scanSession(tx.QueryRow(ctx, `
+		UPDATE sessions
+		SET last_used_at = NOW(), expires_at = LEAST($2, created_at + make_interval(secs => $5)),
+			user_agent = $3, ip_address = $4
+		WHERE id = $1
+		RETURNING `+sessionColumns, sessionID, expiresAt, device.UserAgent, device.IPAddress, lifetime.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	if !session.ExpiresAt.After(time.Now()) {
+		return nil, ErrSessionNotActive
+	}
+
+	insertToken := `INSERT INTO refresh_tokens (jti, session_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, insertToken, nextJTI, sessionID, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func revokeSession(ctx context.Context, tx pgx.Tx, sessionID string, reason models.SessionRevokedReason) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW(), revoked_reason = $2
+		WHERE id = $1 AND revoked_at IS NULL`
+
+	_, err := tx.Exec(ctx, query, sessionID, reason)
+	return err
+}
+
+// GetActiveSessions lists the sessions of the user that can still be used, most recently used first
+func (s *SessionRepo) GetActiveSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke ends one active session of the user, ErrSessionNotFound when there is none with that ID
+func (s *SessionRepo) Revoke(ctx context.Context, userID, sessionID string, reason models.SessionRevokedReason) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW(), revoked_reason = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()`
+
+	result, err := s.db.Exec(ctx, query, sessionID, userID, reason)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every active session of the user and returns how many there were
+func (s *SessionRepo) RevokeAll(ctx context.Context, userID string, reason models.SessionRevokedReason) (int64, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()`
+
+	result, err := s.db.Exec(ctx, query, userID, reason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// Touch reports whether tokens of the session are still accepted and records the session as
+// used. last_used_at is written at most once a minute so busy clients don't rewrite the row on
+// every request.
+func (s *SessionRepo) Touch(ctx context.Context, sessionID string) (bool, error) {
+	query := `
+		WITH active AS (
+			SELECT id, last_used_at FROM sessions
+			WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		), touched AS (
+			UPDATE sessions s
+			SET last_used_at = NOW()
+			FROM active
+			WHERE s.id = active.id AND active.last_used_at < NOW() - INTERVAL '1 minute'
+		)
+		SELECT EXISTS (SELECT 1 FROM active)`
+
+	var active bool
+	if err := s.db.QueryRow(ctx, query, sessionID).Scan(&active); err != nil {
+		return false, err
+	}
+	return active, nil
+}
+
+// PurgeExpired removes sessions past their expiry together with their refresh tokens
+func (s *SessionRepo) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+)
+
+var testDevice = models.DeviceInfo{UserAgent: "session test", IPAddress: "192.0.2.1"}
+
+func TestRotateReusedRefreshTokenRevokesTheSession(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewSessionRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+	expiresAt := time.Now().Add(time.Hour)
+	first, second, third := uuid.NewString(), uuid.NewString(), uuid.NewString()
+
+	session, err := repo.Create(ctx, userID, first, expiresAt, testDevice)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if _, err := repo.Rotate(ctx, first, second, expiresAt, 24*time.Hour, testDevice); err != nil {
+		t.Fatalf("first rotation: %v", err)
+	}
+	if _, err := repo.Rotate(ctx, second, third, expiresAt, 24*time.Hour, testDevice); err != nil {
+		t.Fatalf("second rotation: %v", err)
+	}
+
+	// The first token leaked and is presented again
+	if _, err := repo.Rotate(ctx, first, uuid.NewString(), expiresAt, 24*time.Hour, testDevice); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token returned %v, want ErrRefreshTokenReused", err)
+	}
+
+	// The latest token of the family stops working too, and so do the access tokens
+	if _, err := repo.Rotate(ctx, third, uuid.NewString(), expiresAt, 24*time.Hour, testDevice); !errors.Is(err, ErrSessionNotActive) {
+		t.Errorf("latest token after the reuse returned %v, want ErrSessionNotActive", err)
+	}
+	if active, err := repo.Touch(ctx, session.ID); err != nil || active {
+		t.Errorf("Touch = %v, %v, want false", active, err)
+	}
+
+	var reason models.SessionRevokedReason
+	if err := pool.QueryRow(ctx, `SELECT revoked_reason FROM sessions WHERE id = $1`, session.ID).Scan(&reason); err != nil {
+		t.Fatalf("read revoked reason: %v", err)
+	}
+	if reason != models.SessionRevokedReuse {
+		t.Errorf("session revoked for %q, want %q", reason, models.SessionRevokedReuse)
+	}
+}
+
+func TestRotateNeverExtendsTheSessionPastItsLifetime(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewSessionRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+	first, second := uuid.NewString(), uuid.NewString()
+
+	session, err := repo.Create(ctx, userID, first, time.Now().Add(time.Hour), testDevice)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	// The login happened two hours ago
+	if _, err := pool.Exec(ctx, `UPDATE sessions SET created_at = created_at - INTERVAL '2 hours' WHERE id = $1`, session.ID); err != nil {
+		t.Fatalf("backdate session: %v", err)
+	}
+
+	// The refresh asks for another day, the lifetime only leaves one hour
+	rotated, err := repo.Rotate(ctx, first, second, time.Now().Add(24*time.Hour), 3*time.Hour, testDevice)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if want := rotated.CreatedAt.Add(3 * time.Hour); !rotated.ExpiresAt.Equal(want) {
+		t.Errorf("session expires at %s, want %s", rotated.ExpiresAt, want)
+	}
+
+	// With a lifetime already used up the refresh is refused
+	_, err = repo.Rotate(ctx, second, uuid.NewString(), time.Now().Add(24*time.Hour), time.Hour, testDevice)
+	if !errors.Is(err, ErrSessionNotActive) {
+		t.Errorf("rotation past the lifetime returned %v, want ErrSessionNotActive", err)
+	}
+}
+
+func TestSessionsAreListedAndRevokedPerDevice(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewSessionRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+	otherID := testdb.CreateUser(t, pool)
+	expiresAt := time.Now().Add(time.Hour)
+	phone := models.DeviceInfo{UserAgent: "phone", IPAddress: "192.0.2.10"}
+	laptop := models.DeviceInfo{UserAgent: "laptop", IPAddress: "192.0.2.20"}
+	laptopToken := uuid.NewString()
+
+	phoneSession, err := repo.Create(ctx, userID, uuid.NewString(), expiresAt, phone)
+	if err != nil {
+		t.Fatalf("create phone session: %v", err)
+	}
+	laptopSession, err := repo.Create(ctx, userID, laptopToken, expiresAt, laptop)
+	if err != nil {
+		t.Fatalf("create laptop session: %v", err)
+	}
+	otherSession, err := repo.Create(ctx, otherID, uuid.NewString(), expiresAt, testDevice)
+	if err != nil {
+		t.Fatalf("create other user's session: %v", err)
+	}
+
+	// The phone was used last, it comes first
+	if _, err := pool.Exec(ctx, `UPDATE sessions SET last_used_at = last_used_at - INTERVAL '1 minute' WHERE id = $1`, laptopSession.ID); err != nil {
+		t.Fatalf("backdate laptop session: %v", err)
+	}
+	sessions, err := repo.GetActiveSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions listed, want 2", len(sessions))
+	}
+	for i, want := range []struct {
+		id     string
+		device models.DeviceInfo
+	}{{phoneSession.ID, phone}, {laptopSession.ID, laptop}} {
+		got := sessions[i]
+		if got.ID != want.id || got.UserAgent != want.device.UserAgent || got.IPAddress != want.device.IPAddress {
+			t.Errorf("session %d = %s %q %q, want %s %q %q", i, got.ID, got.UserAgent, got.IPAddress, want.id, want.device.UserAgent, want.device.IPAddress)
+		}
+	}
+
+	// Sessions of another user can't be revoked, they are not found
+	if err := repo.Revoke(ctx, userID, otherSession.ID, models.SessionRevokedByUser); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking another user's session returned %v, want ErrSessionNotFound", err)
+	}
+	if active, err := repo.Touch(ctx, otherSession.ID); err != nil || !active {
+		t.Errorf("other user's session Touch = %v, %v, want true", active, err)
+	}
+
+	// The phone logs the laptop out
+	if err := repo.Revoke(ctx, userID, laptopSession.ID, models.SessionRevokedByUser); err != nil {
+		t.Fatalf("revoke laptop session: %v", err)
+	}
+	if active, err := repo.Touch(ctx, laptopSession.ID); err != nil || active {
+		t.Errorf("revoked session Touch = %v, %v, want false", active, err)
+	}
+	if _, err := repo.Rotate(ctx, laptopToken, uuid.NewString(), expiresAt, 24*time.Hour, laptop); !errors.Is(err, ErrSessionNotActive) {
+		t.Errorf("refresh of the revoked session returned %v, want ErrSessionNotActive", err)
+	}
+	if err := repo.Revoke(ctx, userID, laptopSession.ID, models.SessionRevokedByUser); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking the session twice returned %v, want ErrSessionNotFound", err)
+	}
+
+	sessions, err = repo.GetActiveSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != phoneSession.ID {
+		t.Errorf("sessions after the revocation = %+v, want only the phone", sessions)
+	}
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+// ErrStepUpTokenSpent is returned by a payment or transfer confirmed with a step-up token that
+// already confirmed another one
+var ErrStepUpTokenSpent = apperrors.New(http.StatusForbidden, apperrors.CodeInvalidStepUpToken, "Invalid, used or expired step-up token")
+
+type StepUpTokenRepoInterface interface {
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type StepUpTokenRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewStepUpTokenRepo(db *pgxpool.Pool) *StepUpTokenRepo {
+	return &StepUpTokenRepo{db: db}
+}
+
+// spendStepUpToken records the step-up token as spent inside the DB transaction moving the money,
+// so a token is only used up by a payment or transfer that commits. A nil claim, for requests
+// confirmed without a token, is left alone.
+func spendStepUpToken(ctx context.Context, tx pgx.Tx, claim *models.StepUpClaim) error {
+	if claim == nil {
+		return nil
+	}
+
+	query := `
+		INSERT INTO used_step_up_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`
+
+	result, err := tx.Exec(ctx, query, claim.JTI, claim.UserID, claim.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrStepUpTokenSpent
+	}
+	return nil
+}
+
+// PurgeExpired forgets spent tokens past their expiry, they are refused for being expired anyway
+func (s *StepUpTokenRepo) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.Exec(ctx, `DELETE FROM used_step_up_tokens WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
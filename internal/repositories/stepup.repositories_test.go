@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+	"github.com/redha28/foomlet/pkg"
+)
+
+func TestStepUpTokenIsSpentOnce(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	initial := pkg.NewMoney(1000, 0)
+	amount := pkg.NewMoney(100, 0)
+	senderID := fundedUser(t, repo, pool, initial)
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	claim := &models.StepUpClaim{JTI: uuid.NewString(), UserID: senderID, ExpiresAt: time.Now().Add(time.Minute)}
+	if _, err := repo.Payment(ctx, senderID, amount, "confirmed", nil, claim); err != nil {
+		t.Fatalf("first payment: %v", err)
+	}
+
+	// Replaying the token is refused for payments and transfers alike, and moves nothing
+	if _, err := repo.Payment(ctx, senderID, amount, "replayed", nil, claim); !errors.Is(err, ErrStepUpTokenSpent) {
+		t.Errorf("replayed payment returned %v, want ErrStepUpTokenSpent", err)
+	}
+	if _, err := repo.Transfer(ctx, senderID, recipientID, amount, "replayed", nil, claim); !errors.Is(err, ErrStepUpTokenSpent) {
+		t.Errorf("replayed transfer returned %v, want ErrStepUpTokenSpent", err)
+	}
+	if balance := walletBalance(t, repo, senderID); balance != initial-amount {
+		t.Errorf("balance is %s, want %s", balance, initial-amount)
+	}
+}
+
+func TestStepUpTokenOfAFailedPaymentStaysUnspent(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	userID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	claim := &models.StepUpClaim{JTI: uuid.NewString(), UserID: userID, ExpiresAt: time.Now().Add(time.Minute)}
+
+	if _, err := repo.Payment(ctx, userID, pkg.NewMoney(200, 0), "too much", nil, claim); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("payment returned %v, want ErrInsufficientBalance", err)
+	}
+	if _, err := repo.Payment(ctx, userID, pkg.NewMoney(100, 0), "affordable", nil, claim); err != nil {
+		t.Errorf("payment after the rolled back one: %v", err)
+	}
+}
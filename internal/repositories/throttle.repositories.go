@@ -0,0 +1,271 @@
+package repositories
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
+	"github.com/redha28/foomlet/internal/models"
+)
+
+var (
+	ErrAccountLocked   = apperrors.New(http.StatusLocked, apperrors.CodeAccountLocked, "Too many failed attempts, the account is temporarily locked")
+	ErrTooManyAttempts = apperrors.New(http.StatusTooManyRequests, apperrors.CodeTooManyAttempts, "Too many failed attempts, try again later")
+)
+
+type LoginThrottleRepoInterface interface {
+	BeginAttempt(ctx context.Context, attempt models.LoginAttempt, phonePolicy, ipPolicy models.ThrottlePolicy) error
+	RecordFailure(ctx context.Context, attempt models.LoginAttempt, phonePolicy, ipPolicy models.ThrottlePolicy) error
+	RecordSuccess(ctx context.Context, attempt models.LoginAttempt) error
+	CountCodeRequest(ctx context.Context, device models.DeviceInfo, ipPolicy models.ThrottlePolicy) error
+	IsLocked(ctx context.Context, phone string) (bool, error)
+	Unlock(ctx context.Context, phone string) error
+	PurgeStale(ctx context.Context, window time.Duration) (int64, error)
+}
+
+type LoginThrottleRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginThrottleRepo(db *pgxpool.Pool) *LoginThrottleRepo {
+	return &LoginThrottleRepo{db: db}
+}
+
+// throttleSubject pairs a scope with the value counted in it
+type throttleSubject struct {
+	scope   models.ThrottleScope
+	subject string
+	policy  models.ThrottlePolicy
+	// locked is returned once the subject is locked out
+	locked *apperrors.Error
+}
+
+// subjects lists the counters of an attempt, always in the same order so concurrent
+// attempts lock the rows in the same order
+func throttleSubjects(attempt models.LoginAttempt, phonePolicy, ipPolicy models.ThrottlePolicy) []throttleSubject {
+	return []throttleSubject{
+		{scope: models.ThrottleScopePhone, subject: attempt.Phone, policy: phonePolicy, locked: ErrAccountLocked},
+		{scope: models.ThrottleScopeIP, subject: attempt.Device.IPAddress, policy: ipPolicy, locked: ErrTooManyAttempts},
+	}
+}
+
+// BeginAttempt rejects the attempt while its phone number or IP is locked out or has to wait,
+// otherwise counts it as failed until RecordSuccess says otherwise
+func (r *LoginThrottleRepo) BeginAttempt(ctx context.Context, attempt models.LoginAttempt, phonePolicy, ipPolicy models.ThrottlePolicy) error {
+	return r.begin(ctx, throttleSubjects(attempt, phonePolicy, ipPolicy))
+}
+
+// CountCodeRequest counts a request for a one-time code against its IP like a failed login, so
+// one client cannot have codes sent to every phone number. The request is rejected while the IP
+// is locked out or has to wait, and the IP is locked out once it reached the maximum.
+func (r *LoginThrottleRepo) CountCodeRequest(ctx context.Context, device models.DeviceInfo, ipPolicy models.ThrottlePolicy) error {
+	subjects := []throttleSubject{
+		{scope: models.ThrottleScopeIP, subject: device.IPAddress, policy: ipPolicy, locked: ErrTooManyAttempts},
+	}
+	if err := r.begin(ctx, subjects); err != nil {
+		return err
+	}
+	return r.lockOut(ctx, models.LoginAttempt{Device: device}, subjects)
+}
+
+// begin rejects an attempt while one of the subjects is locked out or has to wait, otherwise
+// counts it against every subject
+func (r *LoginThrottleRepo) begin(ctx context.Context, subjects []throttleSubject) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, s := range subjects {
+		ensureQuery := `
+			INSERT INTO login_throttles (scope, subject)
+			VALUES ($1, $2)
+			ON CONFLICT (scope, subject) DO NOTHING`
+		if _, err := tx.Exec(ctx, ensureQuery, s.scope, s.subject); err != nil {
+			return err
+		}
+
+		// Start over once a lockout ended or the last failure is older than the window
+		lockQuery := `
+			UPDATE login_throttles
+			SET failed_attempts = CASE
+					WHEN locked_until <= NOW() OR last_failed_at < NOW() - make_interval(secs => $3) THEN 0
+					ELSE failed_attempts
+				END,
+				locked_until = CASE WHEN locked_until <= NOW() THEN NULL ELSE locked_until END
+			WHERE scope = $1 AND subject = $2
+			RETURNING failed_attempts,
+				COALESCE(EXTRACT(EPOCH FROM locked_until - NOW()), 0)::float8,
+				COALESCE(EXTRACT(EPOCH FROM NOW() - last_failed_at), 0)::float8`
+
+		var failures int
+		var lockedFor, sinceLastFailure float64
+		err := tx.QueryRow(ctx, lockQuery, s.scope, s.subject, s.policy.Window.Seconds()).Scan(&failures, &lockedFor, &sinceLastFailure)
+		if err != nil {
+			return err
+		}
+
+		if lockedFor > 0 {
+			return s.locked.WithDetails(models.NewRetryAfter(seconds(lockedFor)))
+		}
+		if wait := s.policy.Delay(failures) - seconds(sinceLastFailure); wait > 0 {
+			return ErrTooManyAttempts.WithDetails(models.NewRetryAfter(wait))
+		}
+
+		countQuery := `
+			UPDATE login_throttles
+			SET failed_attempts = failed_attempts + 1, last_failed_at = NOW()
+			WHERE scope = $1 AND subject = $2`
+		if _, err := tx.Exec(ctx, countQuery, s.scope, s.subject); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RecordFailure locks out the phone number or IP of a failed attempt once it reached the
+// maximum number of failures, records the lockout and returns the error to answer with
+func (r *LoginThrottleRepo) RecordFailure(ctx context.Context, attempt models.LoginAttempt, phonePolicy, ipPolicy models.ThrottlePolicy) error {
+	return r.lockOut(ctx, attempt, throttleSubjects(attempt, phonePolicy, ipPolicy))
+}
+
+// lockOut locks out the subjects that reached their maximum number of failures
+func (r *LoginThrottleRepo) lockOut(ctx context.Context, attempt models.LoginAttempt, subjects []throttleSubject) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var lockErr error
+	for _, s := range subjects {
+		lockQuery := `
+			UPDATE login_throttles
+			SET locked_until = NOW() + make_interval(secs => $4)
+			WHERE scope = $1 AND subject = $2 AND failed_attempts >= $3
+				AND (locked_until IS NULL OR locked_until <= NOW())
+			RETURNING failed_attempts, locked_until`
+
+		var failures int
+		var lockedUntil time.Time
+		err := tx.QueryRow(ctx, lockQuery, s.scope, s.subject, s.policy.MaxFailures, s.policy.Lockout.Seconds()).Scan(&failures, &lockedUntil)
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Only the phone lockout belongs to the user, an IP is shared by every account tried from it
+		var userID *string
+		if s.scope == models.ThrottleScopePhone {
+			userID = attempt.UserID
+		}
+		eventQuery := `
+			INSERT INTO lockout_events (scope, subject, user_id, failed_attempts, ip_address, user_agent, locked_until)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		_, err = tx.Exec(ctx, eventQuery, s.scope, s.subject, userID, failures,
+			attempt.Device.IPAddress, attempt.Device.UserAgent, lockedUntil)
+		if err != nil {
+			return err
+		}
+
+		if lockErr == nil {
+			lockErr = s.locked.WithDetails(models.NewRetryAfter(s.policy.Lockout))
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return lockErr
+}
+
+// RecordSuccess forgets the failures of the phone number and takes back the attempt counted
+// against the IP. A lockout set by a concurrent failed attempt in the meantime is kept.
+func (r *LoginThrottleRepo) RecordSuccess(ctx context.Context, attempt models.LoginAttempt) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	deleteQuery := `
+		DELETE FROM login_throttles
+		WHERE scope = $1 AND subject = $2 AND (locked_until IS NULL OR locked_until <= NOW())`
+	if _, err := tx.Exec(ctx, deleteQuery, models.ThrottleScopePhone, attempt.Phone); err != nil {
+		return err
+	}
+
+	forgiveQuery := `
+		UPDATE login_throttles
+		SET failed_attempts = GREATEST(failed_attempts - 1, 0)
+		WHERE scope = $1 AND subject = $2`
+	if _, err := tx.Exec(ctx, forgiveQuery, models.ThrottleScopeIP, attempt.Device.IPAddress); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// IsLocked reports whether the phone number is locked out right now
+func (r *LoginThrottleRepo) IsLocked(ctx context.Context, phone string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM login_throttles
+			WHERE scope = $1 AND subject = $2 AND locked_until > NOW()
+		)`
+
+	var locked bool
+	if err := r.db.QueryRow(ctx, query, models.ThrottleScopePhone, phone).Scan(&locked); err != nil {
+		return false, err
+	}
+	return locked, nil
+}
+
+// Unlock lifts the lockout of the phone number and closes its lockout events
+func (r *LoginThrottleRepo) Unlock(ctx context.Context, phone string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	deleteQuery := `DELETE FROM login_throttles WHERE scope = $1 AND subject = $2`
+	if _, err := tx.Exec(ctx, deleteQuery, models.ThrottleScopePhone, phone); err != nil {
+		return err
+	}
+
+	closeQuery := `
+		UPDATE lockout_events
+		SET unlocked_at = NOW()
+		WHERE scope = $1 AND subject = $2 AND unlocked_at IS NULL AND locked_until > NOW()`
+	if _, err := tx.Exec(ctx, closeQuery, models.ThrottleScopePhone, phone); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PurgeStale removes counters that are not locked and whose last failure is older than window
+func (r *LoginThrottleRepo) PurgeStale(ctx context.Context, window time.Duration) (int64, error) {
+	query := `
+		DELETE FROM login_throttles
+		WHERE (locked_until IS NULL OR locked_until <= NOW())
+			AND (last_failed_at IS NULL OR last_failed_at < NOW() - make_interval(secs => $1))`
+
+	result, err := r.db.Exec(ctx, query, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
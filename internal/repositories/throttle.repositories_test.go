@@ -0,0 +1,241 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+)
+
+// noDelayPolicy locks out after maxFailures and never asks to wait before that
+func noDelayPolicy(maxFailures int) models.ThrottlePolicy {
+	return models.ThrottlePolicy{
+		MaxFailures:  maxFailures,
+		FreeAttempts: maxFailures,
+		Window:       time.Hour,
+		Lockout:      time.Hour,
+	}
+}
+
+// newLoginAttempt returns an attempt from a phone number and IP no other test uses
+func newLoginAttempt() models.LoginAttempt {
+	return models.LoginAttempt{
+		Phone:  uuid.NewString(),
+		Device: models.DeviceInfo{UserAgent: "throttle test", IPAddress: uuid.NewString()},
+	}
+}
+
+// failLogin counts a failed login the way the login handler does and returns the error it answers with
+func failLogin(t *testing.T, repo *LoginThrottleRepo, attempt models.LoginAttempt, phonePolicy, ipPolicy models.ThrottlePolicy) error {
+	t.Helper()
+	ctx := context.Background()
+	if err := repo.BeginAttempt(ctx, attempt, phonePolicy, ipPolicy); err != nil {
+		return err
+	}
+	return repo.RecordFailure(ctx, attempt, phonePolicy, ipPolicy)
+}
+
+func throttleFailures(t *testing.T, pool *pgxpool.Pool, scope models.ThrottleScope, subject string) int {
+	t.Helper()
+	var failures int
+	query := `SELECT COALESCE((SELECT failed_attempts FROM login_throttles WHERE scope = $1 AND subject = $2), 0)`
+	if err := pool.QueryRow(context.Background(), query, scope, subject).Scan(&failures); err != nil {
+		t.Fatalf("read failed attempts: %v", err)
+	}
+	return failures
+}
+
+func TestLoginThrottleLocksOutAfterMaxFailures(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewLoginThrottleRepo(pool)
+	ctx := context.Background()
+
+	phonePolicy, ipPolicy := noDelayPolicy(3), noDelayPolicy(100)
+	attempt := newLoginAttempt()
+
+	for i := 1; i < phonePolicy.MaxFailures; i++ {
+		if err := failLogin(t, repo, attempt, phonePolicy, ipPolicy); err != nil {
+			t.Fatalf("failure %d returned %v, want nil", i, err)
+		}
+	}
+	if err := failLogin(t, repo, attempt, phonePolicy, ipPolicy); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("last failure returned %v, want ErrAccountLocked", err)
+	}
+
+	// The next attempt is refused before the PIN is checked
+	if err := repo.BeginAttempt(ctx, attempt, phonePolicy, ipPolicy); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("attempt while locked returned %v, want ErrAccountLocked", err)
+	}
+	if locked, err := repo.IsLocked(ctx, attempt.Phone); err != nil || !locked {
+		t.Errorf("IsLocked = %v, %v, want true", locked, err)
+	}
+
+	var events int
+	eventQuery := `SELECT COUNT(*) FROM lockout_events WHERE scope = $1 AND subject = $2`
+	if err := pool.QueryRow(ctx, eventQuery, models.ThrottleScopePhone, attempt.Phone).Scan(&events); err != nil {
+		t.Fatalf("count lockout events: %v", err)
+	}
+	if events != 1 {
+		t.Errorf("%d lockout events recorded, want 1", events)
+	}
+}
+
+func TestLoginThrottleRefusesAttemptsDuringTheDelay(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewLoginThrottleRepo(pool)
+
+	phonePolicy := models.ThrottlePolicy{
+		MaxFailures:  100,
+		FreeAttempts: 1,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+		Lockout:      time.Hour,
+	}
+	attempt := newLoginAttempt()
+
+	if err := failLogin(t, repo, attempt, phonePolicy, noDelayPolicy(100)); err != nil {
+		t.Fatalf("free failure returned %v, want nil", err)
+	}
+
+	err := repo.BeginAttempt(context.Background(), attempt, phonePolicy, noDelayPolicy(100))
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("attempt during the delay returned %v, want ErrTooManyAttempts", err)
+	}
+
+	// The refused attempt is not counted
+	if failures := throttleFailures(t, pool, models.ThrottleScopePhone, attempt.Phone); failures != 1 {
+		t.Errorf("phone has %d failures, want 1", failures)
+	}
+}
+
+func TestLoginThrottleUnlockClearsTheLockout(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewLoginThrottleRepo(pool)
+	ctx := context.Background()
+
+	phonePolicy, ipPolicy := noDelayPolicy(1), noDelayPolicy(100)
+	attempt := newLoginAttempt()
+
+	if err := failLogin(t, repo, attempt, phonePolicy, ipPolicy); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("failure returned %v, want ErrAccountLocked", err)
+	}
+
+	if err := repo.Unlock(ctx, attempt.Phone); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	var rows int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM login_throttles WHERE scope = $1 AND subject = $2`,
+		models.ThrottleScopePhone, attempt.Phone).Scan(&rows); err != nil {
+		t.Fatalf("count throttle rows: %v", err)
+	}
+	if rows != 0 {
+		t.Errorf("%d throttle rows left for the phone, want 0", rows)
+	}
+
+	var open int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM lockout_events WHERE scope = $1 AND subject = $2 AND unlocked_at IS NULL`,
+		models.ThrottleScopePhone, attempt.Phone).Scan(&open); err != nil {
+		t.Fatalf("count open lockout events: %v", err)
+	}
+	if open != 0 {
+		t.Errorf("%d lockout events still open, want 0", open)
+	}
+
+	if err := repo.BeginAttempt(ctx, attempt, phonePolicy, ipPolicy); err != nil {
+		t.Errorf("attempt after unlock returned %v, want nil", err)
+	}
+}
+
+func TestLoginThrottleSuccessResetsThePhone(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewLoginThrottleRepo(pool)
+	ctx := context.Background()
+
+	phonePolicy, ipPolicy := noDelayPolicy(3), noDelayPolicy(100)
+	attempt := newLoginAttempt()
+
+	for i := 0; i < 2; i++ {
+		if err := failLogin(t, repo, attempt, phonePolicy, ipPolicy); err != nil {
+			t.Fatalf("failure %d returned %v, want nil", i+1, err)
+		}
+	}
+
+	// A successful login is counted like a failure until it is recorded as a success
+	if err := repo.BeginAttempt(ctx, attempt, phonePolicy, ipPolicy); err != nil {
+		t.Fatalf("begin successful attempt: %v", err)
+	}
+	if err := repo.RecordSuccess(ctx, attempt); err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+
+	if failures := throttleFailures(t, pool, models.ThrottleScopePhone, attempt.Phone); failures != 0 {
+		t.Errorf("phone has %d failures after the success, want 0", failures)
+	}
+	// The IP keeps its two failures, only the successful attempt is taken back
+	if failures := throttleFailures(t, pool, models.ThrottleScopeIP, attempt.Device.IPAddress); failures != 2 {
+		t.Errorf("IP has %d failures after the success, want 2", failures)
+	}
+
+	// Two more failures stay below the lockout
+	for i := 0; i < 2; i++ {
+		if err := failLogin(t, repo, attempt, phonePolicy, ipPolicy); err != nil {
+			t.Errorf("failure %d after the success returned %v, want nil", i+1, err)
+		}
+	}
+}
+
+func TestLoginThrottleSuccessKeepsAConcurrentLockout(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewLoginThrottleRepo(pool)
+	ctx := context.Background()
+
+	phonePolicy, ipPolicy := noDelayPolicy(2), noDelayPolicy(100)
+	attempt := newLoginAttempt()
+
+	// The correct PIN is still being checked when a guess from elsewhere locks the account
+	if err := repo.BeginAttempt(ctx, attempt, phonePolicy, ipPolicy); err != nil {
+		t.Fatalf("begin successful attempt: %v", err)
+	}
+	if err := failLogin(t, repo, attempt, phonePolicy, ipPolicy); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("failure returned %v, want ErrAccountLocked", err)
+	}
+	if err := repo.RecordSuccess(ctx, attempt); err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+
+	if locked, err := repo.IsLocked(ctx, attempt.Phone); err != nil || !locked {
+		t.Errorf("IsLocked after the success = %v, %v, want true", locked, err)
+	}
+	if err := repo.BeginAttempt(ctx, attempt, phonePolicy, ipPolicy); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("attempt after the success returned %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestCountCodeRequestBlocksTheIP(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewLoginThrottleRepo(pool)
+	ctx := context.Background()
+
+	ipPolicy := noDelayPolicy(2)
+	device := newLoginAttempt().Device
+
+	if err := repo.CountCodeRequest(ctx, device, ipPolicy); err != nil {
+		t.Fatalf("first code request returned %v, want nil", err)
+	}
+	if err := repo.CountCodeRequest(ctx, device, ipPolicy); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("code request reaching the maximum returned %v, want ErrTooManyAttempts", err)
+	}
+	if err := repo.CountCodeRequest(ctx, device, ipPolicy); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("code request while blocked returned %v, want ErrTooManyAttempts", err)
+	}
+	if failures := throttleFailures(t, pool, models.ThrottleScopeIP, device.IPAddress); failures != 2 {
+		t.Errorf("IP has %d counted requests, want 2", failures)
+	}
+}
@@ -2,26 +2,53 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
 	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/pkg"
 )
 
 var (
-	ErrInsufficientBalance = errors.New("saldo tidak cukup")
-	ErrWalletNotFound      = errors.New("wallet not found")
+	ErrInsufficientBalance = apperrors.New(http.StatusUnprocessableEntity, apperrors.CodeInsufficientBalance, "Insufficient balance")
+	ErrRecipientNotFound   = apperrors.New(http.StatusUnprocessableEntity, apperrors.CodeRecipientNotFound, "Recipient user not found")
+	ErrWalletNotFound      = apperrors.New(http.StatusNotFound, apperrors.CodeWalletNotFound, "Wallet not found")
+	ErrTransferNotFound    = apperrors.New(http.StatusNotFound, apperrors.CodeTransferNotFound, "Transfer not found")
+	ErrTransactionNotFound = apperrors.New(http.StatusNotFound, apperrors.CodeTransactionNotFound, "Transaction not found")
+	// ErrTransferAlreadyProcessed is returned when a transfer left PENDING before, e.g. on a redelivered message
+	ErrTransferAlreadyProcessed = errors.New("transfer already processed")
+)
+
+const (
+	// walletBalanceConstraint is the CHECK constraint that keeps wallets.balance non-negative
+	walletBalanceConstraint = "wallets_balance_non_negative"
+	// pgCheckViolation is the Postgres SQLSTATE for check_violation
+	pgCheckViolation = "23514"
 )
 
 type TransactionRepoInterface interface {
-	TopUp(ctx context.Context, userID string, amount float64) (*models.TopUpResponse, error)
-	Payment(ctx context.Context, userID string, amount float64, remarks string) (*models.PaymentResponse, error)
-	GetUserTransactions(ctx context.Context, userID string) ([]models.TransactionResponse, error)
-	GetWalletByUserID(ctx context.Context, userID string) (string, float64, error)
-	Transfer(ctx context.Context, senderID, recipientID string, amount float64, remarks string) (*models.TransferResponse, error)
-	ProcessTransfer(ctx context.Context, transferID, senderID, recipientID string, amount float64, remarks string) error
+	TopUp(ctx context.Context, userID string, amount pkg.Money, idempotency *models.IdempotencyClaim) (*models.TopUpResponse, error)
+	Payment(ctx context.Context, userID string, amount pkg.Money, remarks string, idempotency *models.IdempotencyClaim, stepUp *models.StepUpClaim) (*models.PaymentResponse, error)
+	GetUserTransactions(ctx context.Context, userID string, filter models.TransactionFilter) ([]models.TransactionResponse, string, error)
+	StreamStatement(ctx context.Context, userID string, filter models.TransactionFilter, header func(*models.StatementHeader) error, row func(models.TransactionResponse) error) error
+	GetWalletByUserID(ctx context.Context, userID string) (string, pkg.Money, error)
+	GetWalletSummary(ctx context.Context, userID string) (*models.WalletSummaryResponse, error)
+	Transfer(ctx context.Context, senderID, recipientID string, amount pkg.Money, remarks string, idempotency *models.IdempotencyClaim, stepUp *models.StepUpClaim) (*models.TransferResponse, error)
+	ProcessTransfer(ctx context.Context, transferID string) error
+	FailTransfer(ctx context.Context, transferID, reason string) error
+	FailStuckTransfers(ctx context.Context, olderThan time.Duration) (int64, error)
+	ReopenTransfer(ctx context.Context, transferID string) (models.TransactionStatus, error)
+	GetTransfer(ctx context.Context, userID, transferID string) (*models.TransferStatusResponse, error)
+	GetTransactionDetail(ctx context.Context, userID, transactionID string) (*models.TransactionDetailResponse, error)
 	GetUserByID(ctx context.Context, userID string) (*models.User, error)
 }
 
@@ -33,12 +60,11 @@ func NewTransactionRepo(db *pgxpool.Pool) *TransactionRepo {
 	return &TransactionRepo{db: db}
 }
 
-func (t *TransactionRepo) GetWalletByUserID(ctx context.Context, userID string) (string, float64, error) {
+func (t *TransactionRepo) GetWalletByUserID(ctx context.Context, userID string) (string, pkg.Money, error) {
 	var walletID string
-	var balance float64
+	var balance pkg.Money
 
-	// Use numeric cast to properly convert MONEY to a numeric value Go can handle
-	query := `SELECT id, balance::numeric FROM wallets WHERE user_id = $1`
+	query := `SELECT id, balance FROM wallets WHERE user_id = $1`
 	err := t.db.QueryRow(ctx, query, userID).Scan(&walletID, &balance)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -50,7 +76,111 @@ func (t *TransactionRepo) GetWalletByUserID(ctx context.Context, userID string)
 	return walletID, balance, nil
 }
 
-func (t *TransactionRepo) TopUp(ctx context.Context, userID string, amount float64) (*models.TopUpResponse, error) {
+// GetWalletSummary returns the balance of the user's wallet, the part reserved by PENDING
+// transfers and the successful totals per transaction type since the start of the month.
+// Everything is read from one snapshot so the figures always add up.
+func (t *TransactionRepo) GetWalletSummary(ctx context.Context, userID string) (*models.WalletSummaryResponse, error) {
+	tx, err := t.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	summary := &models.WalletSummaryResponse{MonthToDate: []models.TransactionTotal{}}
+	walletQuery := `SELECT id, balance, updated_at, date_trunc('month', NOW())::TIMESTAMP FROM wallets WHERE user_id = $1`
+	err = tx.QueryRow(ctx, walletQuery, userID).Scan(&summary.WalletID, &summary.LedgerBalance, &summary.UpdatedAt, &summary.MonthStart)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrWalletNotFound
+		}
+		return nil, err
+	}
+
+	if summary.PendingOutgoing, err = t.pendingOutgoing(ctx, tx, summary.WalletID); err != nil {
+		return nil, err
+	}
+	summary.AvailableBalance = summary.LedgerBalance - summary.PendingOutgoing
+
+	totalsQuery := `
+		SELECT h.transaction_type, h.direction, COUNT(*), SUM(h.amount)
+		FROM transaction_history h
+		WHERE h.wallet_id = $1 AND h.status = $2 AND h.created_at >= $3
+		GROUP BY h.transaction_type, h.direction
+		ORDER BY h.transaction_type, h.direction`
+
+	rows, err := tx.Query(ctx, totalsQuery, summary.WalletID, models.TransactionStatusSuccess, summary.MonthStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total models.TransactionTotal
+		if err := rows.Scan(&total.TransactionType, &total.Direction, &total.Count, &total.Amount); err != nil {
+			return nil, err
+		}
+		summary.MonthToDate = append(summary.MonthToDate, total)
+	}
+
+	return summary, rows.Err()
+}
+
+// lockedWallet is a wallet row read with SELECT ... FOR UPDATE inside a DB transaction
+type lockedWallet struct {
+	ID      string
+	Balance pkg.Money
+}
+
+// lockWallets locks the wallets of the given users inside tx and returns them keyed by user ID.
+// Rows are always locked in wallet ID order so two transactions touching the same
+// pair of wallets cannot deadlock on each other.
+func (t *TransactionRepo) lockWallets(ctx context.Context, tx pgx.Tx, userIDs ...string) (map[string]lockedWallet, error) {
+	query := `
+		SELECT id, user_id, balance
+		FROM wallets
+		WHERE user_id = ANY($1)
+		ORDER BY id
+		FOR UPDATE`
+
+	rows, err := tx.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := make(map[string]lockedWallet, len(userIDs))
+	for rows.Next() {
+		var wallet lockedWallet
+		var userID string
+		if err := rows.Scan(&wallet.ID, &userID, &wallet.Balance); err != nil {
+			return nil, err
+		}
+		wallets[userID] = wallet
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range userIDs {
+		if _, ok := wallets[userID]; !ok {
+			return nil, ErrWalletNotFound
+		}
+	}
+
+	return wallets, nil
+}
+
+// mapBalanceError translates a violation of the non-negative balance constraint into ErrInsufficientBalance
+func mapBalanceError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgCheckViolation && pgErr.ConstraintName == walletBalanceConstraint {
+		return ErrInsufficientBalance
+	}
+	return err
+}
+
+// TopUp credits the wallet. idempotency is linked to the top-up like in Payment.
+func (t *TransactionRepo) TopUp(ctx context.Context, userID string, amount pkg.Money, idempotency *models.IdempotencyClaim) (*models.TopUpResponse, error) {
 	// Begin transaction
 	tx, err := t.db.Begin(ctx)
 	if err != nil {
@@ -58,35 +188,54 @@ func (t *TransactionRepo) TopUp(ctx context.Context, userID string, amount float
 	}
 	defer tx.Rollback(ctx)
 
-	// Get wallet ID and current balance
-	walletID, balance, err := t.GetWalletByUserID(ctx, userID)
+	// Lock the wallet so concurrent balance changes are serialized
+	wallets, err := t.lockWallets(ctx, tx, userID)
 	if err != nil {
 		return nil, err
 	}
+	walletID := wallets[userID].ID
+
+	// The wallet must stay under the maximum balance of the user's KYC level
+	if err := checkIncomingLimits(ctx, tx, userID, wallets[userID].Balance, amount); err != nil {
+		return nil, err
+	}
 
 	// Calculate new balance
-	balanceBefore := balance
-	balanceAfter := balance + amount
+	balanceBefore := wallets[userID].Balance
+	balanceAfter := balanceBefore + amount
 
 	// Create transaction record with the top-up transaction type (ID 1)
 	txID := models.NewTransaction().ID
 	txQuery := `
 		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
 	_, err = tx.Exec(ctx, txQuery, txID, walletID, models.TransactionTypeTopUp, amount, balanceBefore, balanceAfter)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update wallet balance - cast amount to money type for proper calculation with PostgreSQL MONEY type
+	// Fund the wallet from the top-up account
+	journal := models.NewJournal(txID, models.JournalKindTopUp, "Top-up").
+		Debit(models.LedgerAccountTopUpFunding, amount).
+		Credit(walletID, amount)
+	if err = PostJournal(ctx, tx, journal); err != nil {
+		return nil, err
+	}
+
+	// Update wallet balance
 	updateQuery := `
 		UPDATE wallets 
-		SET balance = balance + $1::money, updated_at = NOW()
+		SET balance = balance + $1, updated_at = NOW()
 		WHERE id = $2`
 
 	_, err = tx.Exec(ctx, updateQuery, amount, walletID)
 	if err != nil {
+		return nil, mapBalanceError(err)
+	}
+
+	// A retry with the same Idempotency-Key must find this movement
+	if err = recordIdempotentOutcome(ctx, tx, idempotency, txID); err != nil {
 		return nil, err
 	}
 
@@ -107,7 +256,11 @@ func (t *TransactionRepo) TopUp(ctx context.Context, userID string, amount float
 	return response, nil
 }
 
-func (t *TransactionRepo) Payment(ctx context.Context, userID string, amount float64, remarks string) (*models.PaymentResponse, error) {
+// Payment debits the wallet at once. idempotency is the Idempotency-Key reserved for the request,
+// linked to the payment in the same DB transaction, nil without a key. stepUp is the step-up token
+// confirming the payment, spent in the same DB transaction, nil when it was confirmed otherwise or
+// needs no confirmation.
+func (t *TransactionRepo) Payment(ctx context.Context, userID string, amount pkg.Money, remarks string, idempotency *models.IdempotencyClaim, stepUp *models.StepUpClaim) (*models.PaymentResponse, error) {
 	// Begin transaction
 	tx, err := t.db.Begin(ctx)
 	if err != nil {
@@ -115,28 +268,40 @@ func (t *TransactionRepo) Payment(ctx context.Context, userID string, amount flo
 	}
 	defer tx.Rollback(ctx)
 
-	// Get wallet ID and current balance
-	walletID, balance, err := t.GetWalletByUserID(ctx, userID)
+	// Lock the wallet so the balance check below cannot race with another payment
+	wallets, err := t.lockWallets(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	walletID := wallets[userID].ID
+
+	// Funds reserved by PENDING transfers are not available for payments
+	pendingOutgoing, err := t.pendingOutgoing(ctx, tx, walletID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if balance is sufficient
-	if balance < amount {
+	if wallets[userID].Balance-pendingOutgoing < amount {
 		return nil, ErrInsufficientBalance
 	}
 
+	// Enforce the outgoing limits of the user's KYC level
+	if err := checkOutgoingLimits(ctx, tx, userID, walletID, amount, false); err != nil {
+		return nil, err
+	}
+
 	// Calculate new balance
-	balanceBefore := balance
-	balanceAfter := balance - amount
+	balanceBefore := wallets[userID].Balance
+	balanceAfter := balanceBefore - amount
 
-	// Create transaction - cast to money type for PostgreSQL
+	// Create transaction record with the payment transaction type (ID 2)
 	txID := models.NewTransaction().ID
 	txQuery := `
-		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
-	_, err = tx.Exec(ctx, txQuery, txID, walletID, models.TransactionTypePayment, amount, balanceBefore, balanceAfter)
+	_, err = tx.Exec(ctx, txQuery, txID, walletID, models.TransactionTypePayment, amount, balanceBefore, balanceAfter, remarks)
 	if err != nil {
 		return nil, err
 	}
@@ -146,20 +311,37 @@ func (t *TransactionRepo) Payment(ctx context.Context, userID string, amount flo
 		INSERT INTO payments (transaction_id, user_id, amount, remarks)
 		VALUES ($1, $2, $3, $4)`
 
-	// Use int value for amount in payments table if it's defined as INT in the schema
-	_, err = tx.Exec(ctx, paymentQuery, txID, userID, int(amount), remarks)
+	_, err = tx.Exec(ctx, paymentQuery, txID, userID, amount, remarks)
 	if err != nil {
 		return nil, err
 	}
 
+	// Settle the payment to the merchant account
+	journal := models.NewJournal(txID, models.JournalKindPayment, remarks).
+		Debit(walletID, amount).
+		Credit(models.LedgerAccountMerchantSettlement, amount)
+	if err = PostJournal(ctx, tx, journal); err != nil {
+		return nil, err
+	}
+
 	// Update wallet balance
 	updateQuery := `
 		UPDATE wallets 
-		SET balance = balance - $1::money, updated_at = NOW()
+		SET balance = balance - $1, updated_at = NOW()
 		WHERE id = $2`
 
 	_, err = tx.Exec(ctx, updateQuery, amount, walletID)
 	if err != nil {
+		return nil, mapBalanceError(err)
+	}
+
+	// A retry with the same Idempotency-Key must find this movement
+	if err = recordIdempotentOutcome(ctx, tx, idempotency, txID); err != nil {
+		return nil, err
+	}
+
+	// The step-up token confirming the payment is only used up if it commits
+	if err = spendStepUpToken(ctx, tx, stepUp); err != nil {
 		return nil, err
 	}
 
@@ -181,79 +363,223 @@ func (t *TransactionRepo) Payment(ctx context.Context, userID string, amount flo
 	return response, nil
 }
 
-func (t *TransactionRepo) GetUserTransactions(ctx context.Context, userID string) ([]models.TransactionResponse, error) {
+// historyQuery builds the wallet history query shared by the paginated history and the statements.
+// The (wallet_id, created_at, id) index serves the ordering in both directions.
+func historyQuery(walletID string, filter models.TransactionFilter, ascending bool) (string, []any) {
+	args := []any{walletID}
+	conditions := []string{"h.wallet_id = $1"}
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.TypeID != 0 {
+		addCondition("h.transaction_type_id = $%d", filter.TypeID)
+	}
+	if filter.Direction != "" {
+		addCondition("h.direction = $%d", filter.Direction)
+	}
+	if filter.From != nil {
+		addCondition("h.created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("h.created_at < $%d", *filter.To)
+	}
+	if filter.MinAmount != nil {
+		addCondition("h.amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		addCondition("h.amount <= $%d", *filter.MaxAmount)
+	}
+	if filter.Query != "" {
+		addCondition(`h.remarks ILIKE $%d ESCAPE '\'`, "%"+escapeLike(filter.Query)+"%")
+	}
+
+	order, compare := "DESC", "<"
+	if ascending {
+		order, compare = "ASC", ">"
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(h.created_at, h.id) %s ($%d, $%d)", compare, len(args)-1, len(args)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			h.id,
+			h.status,
+			h.user_id,
+			h.transaction_type,
+			h.direction,
+			h.amount,
+			h.remarks,
+			h.balance_before,
+			h.balance_after,
+			h.created_at
+		FROM transaction_history h
+		WHERE %s
+		ORDER BY h.created_at %s, h.id %s`, strings.Join(conditions, " AND "), order, order)
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return query, args
+}
+
+func scanHistoryRow(rows pgx.Rows) (models.TransactionResponse, error) {
+	var tx models.TransactionResponse
+	err := rows.Scan(
+		&tx.ID,
+		&tx.Status,
+		&tx.Userid,
+		&tx.TransactionType,
+		&tx.Direction,
+		&tx.Amount,
+		&tx.Remarks,
+		&tx.BalanceBefore,
+		&tx.BalanceAfter,
+		&tx.CreatedAt,
+	)
+	return tx, err
+}
+
+// GetUserTransactions returns one page of the wallet history, newest first, and the cursor of
+// the next page. The cursor is empty on the last page.
+func (t *TransactionRepo) GetUserTransactions(ctx context.Context, userID string, filter models.TransactionFilter) ([]models.TransactionResponse, string, error) {
 	// Get wallet ID
 	walletID, _, err := t.GetWalletByUserID(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// Query to get all transactions with their balance history
-	// Use transaction type names directly from transaction_types table
-	query := `
-		SELECT 
-			t.id,
-			'SUCCESS' as status,
-			$2 as user_id,
-			CASE 
-				WHEN t.transaction_type_id = 1 THEN 'Top-Up'
-				WHEN t.transaction_type_id = 2 THEN 'Payment'
-				WHEN t.transaction_type_id = 3 THEN 'Transfer'
-				ELSE 'Unknown'
-			END as transaction_type,
-			t.amount::numeric,
-			CASE 
-				WHEN t.transaction_type_id = 2 THEN p.remarks
-				WHEN t.transaction_type_id = 3 THEN tr.remarks
-				ELSE ''
-			END as remarks,
-			t.balance_before::numeric,
-			t.balance_after::numeric,
-			t.created_at
-		FROM 
-			transactions t
-			JOIN transaction_types tt ON t.transaction_type_id = tt.id
-			LEFT JOIN payments p ON t.id = p.transaction_id
-			LEFT JOIN transfer tr ON t.id = tr.transaction_id
-		WHERE 
-			t.wallet_id = $1
-		ORDER BY 
-			t.created_at DESC
-	`
-
-	rows, err := t.db.Query(ctx, query, walletID, userID)
+	// Fetch one extra row to know whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	query, args := historyQuery(walletID, filter, false)
+
+	rows, err := t.db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var transactions []models.TransactionResponse
+	transactions := []models.TransactionResponse{}
 	for rows.Next() {
-		var tx models.TransactionResponse
-		if err := rows.Scan(
-			&tx.ID,
-			&tx.Status,
-			&tx.Userid,
-			&tx.TransactionType,
-			&tx.Amount,
-			&tx.Remarks,
-			&tx.BalanceBefore,
-			&tx.BalanceAfter,
-			&tx.CreatedAt,
-		); err != nil {
-			return nil, err
+		tx, err := scanHistoryRow(rows)
+		if err != nil {
+			return nil, "", err
 		}
 		transactions = append(transactions, tx)
 	}
 
 	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[len(transactions)-1]
+		nextCursor = models.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return transactions, nextCursor, nil
+}
+
+// StreamStatement reads the statement of the period from one snapshot, so the opening balance
+// and the rows always add up. header gets the profile and opening balance first, then row is
+// called for every transaction matching the filter, oldest first. Rows are handed over as they
+// are read so a long history is never held in memory.
+func (t *TransactionRepo) StreamStatement(
+	ctx context.Context,
+	userID string,
+	filter models.TransactionFilter,
+	header func(*models.StatementHeader) error,
+	row func(models.TransactionResponse) error,
+) error {
+	tx, err := t.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	statementHeader, err := t.statementHeader(ctx, tx, userID, *filter.From)
+	if err != nil {
+		return err
+	}
+	if err := header(statementHeader); err != nil {
+		return err
+	}
+
+	query, args := historyQuery(statementHeader.WalletID, filter, true)
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := scanHistoryRow(rows)
+		if err != nil {
+			return err
+		}
+		if err := row(transaction); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// statementHeader returns the profile and wallet of the user together with the balance
+// of the wallet at the start of the period, computed from its successful transactions
+func (t *TransactionRepo) statementHeader(ctx context.Context, tx pgx.Tx, userID string, from time.Time) (*models.StatementHeader, error) {
+	query := `
+		SELECT
+			u.id,
+			COALESCE(u.firstname, '') || ' ' || COALESCE(u.lastname, ''),
+			COALESCE(u.phone, ''),
+			COALESCE(u.address, ''),
+			w.id,
+			COALESCE((
+				SELECT SUM(CASE WHEN h.direction = $3 THEN h.amount ELSE -h.amount END)
+				FROM transaction_history h
+				WHERE h.wallet_id = w.id AND h.status = $4 AND h.created_at < $2
+			), 0)::NUMERIC(20,2)
+		FROM users u
+			JOIN wallets w ON w.user_id = u.id
+		WHERE u.id = $1`
+
+	header := &models.StatementHeader{From: from}
+	err := tx.QueryRow(ctx, query, userID, from, models.TransactionDirectionIn, models.TransactionStatusSuccess).Scan(
+		&header.UserID,
+		&header.Name,
+		&header.Phone,
+		&header.Address,
+		&header.WalletID,
+		&header.OpeningBalance,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrWalletNotFound
+		}
 		return nil, err
 	}
 
-	return transactions, nil
+	header.Name = strings.TrimSpace(header.Name)
+	return header, nil
 }
 
-func (t *TransactionRepo) Transfer(ctx context.Context, senderID, recipientID string, amount float64, remarks string) (*models.TransferResponse, error) {
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Transfer records a PENDING transfer and queues it through the outbox. idempotency and stepUp
+// are handled like in Payment.
+func (t *TransactionRepo) Transfer(ctx context.Context, senderID, recipientID string, amount pkg.Money, remarks string, idempotency *models.IdempotencyClaim, stepUp *models.StepUpClaim) (*models.TransferResponse, error) {
 	// Begin transaction
 	tx, err := t.db.Begin(ctx)
 	if err != nil {
@@ -261,33 +587,53 @@ func (t *TransactionRepo) Transfer(ctx context.Context, senderID, recipientID st
 	}
 	defer tx.Rollback(ctx)
 
-	// Get sender wallet ID and current balance
-	senderWalletID, senderBalance, err := t.GetWalletByUserID(ctx, senderID)
+	// Lock the sender wallet so concurrent transfers check the balance one at a time
+	wallets, err := t.lockWallets(ctx, tx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	senderWalletID := wallets[senderID].ID
+	senderBalance := wallets[senderID].Balance
+
+	// Transfers that are still PENDING have not been debited yet, so reserve their amount too
+	pendingOutgoing, err := t.pendingOutgoing(ctx, tx, senderWalletID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if balance is sufficient
-	if senderBalance < amount {
+	if senderBalance-pendingOutgoing < amount {
 		return nil, ErrInsufficientBalance
 	}
 
+	// Enforce the outgoing limits and the hourly transfer count of the sender's KYC level
+	if err := checkOutgoingLimits(ctx, tx, senderID, senderWalletID, amount, true); err != nil {
+		return nil, err
+	}
+
 	// Calculate new balance
 	balanceBefore := senderBalance
 	balanceAfter := senderBalance - amount
 
-	// Check if recipient exists
-	if _, err := t.GetUserByID(ctx, recipientID); err != nil {
+	// Check if recipient exists inside the transaction, the share lock keeps the user from being
+	// deleted before the transfer commits without holding up other transfers to them
+	var recipientExists bool
+	recipientQuery := `SELECT TRUE FROM users WHERE id = $1 FOR SHARE`
+	if err := tx.QueryRow(ctx, recipientQuery, recipientID).Scan(&recipientExists); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRecipientNotFound
+		}
 		return nil, err
 	}
 
-	// Create transaction record with the transfer transaction type
+	// Create a PENDING transaction record with the transfer transaction type
 	txID := models.NewTransaction().ID
 	txQuery := `
-		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after, status, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
-	_, err = tx.Exec(ctx, txQuery, txID, senderWalletID, models.TransactionTypeTransfer, amount, balanceBefore, balanceAfter)
+	_, err = tx.Exec(ctx, txQuery, txID, senderWalletID, models.TransactionTypeTransfer, amount, balanceBefore, balanceAfter,
+		models.TransactionStatusPending, remarks)
 	if err != nil {
 		return nil, err
 	}
@@ -302,8 +648,29 @@ func (t *TransactionRepo) Transfer(ctx context.Context, senderID, recipientID st
 		return nil, err
 	}
 
+	// Queue the transfer for processing in the same DB transaction
+	if err = t.queueTransfer(ctx, tx, pkg.TransferMessage{
+		TransferID:  txID,
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+		Remarks:     remarks,
+	}); err != nil {
+		return nil, err
+	}
+
 	// Important: We don't update wallet balances here - that's done by ProcessTransfer
-	// This function just creates the transaction records
+	// This function just creates the transaction records, which stay PENDING until then
+
+	// A retry with the same Idempotency-Key must find this transfer
+	if err = recordIdempotentOutcome(ctx, tx, idempotency, txID); err != nil {
+		return nil, err
+	}
+
+	// The step-up token confirming the transfer is only used up if it commits
+	if err = spendStepUpToken(ctx, tx, stepUp); err != nil {
+		return nil, err
+	}
 
 	// Commit transaction to save the transaction record
 	if err = tx.Commit(ctx); err != nil {
@@ -313,6 +680,7 @@ func (t *TransactionRepo) Transfer(ctx context.Context, senderID, recipientID st
 	// Return response
 	response := &models.TransferResponse{
 		ID:            txID,
+		Status:        models.TransactionStatusPending,
 		Amount:        amount,
 		Remarks:       remarks,
 		BalanceBefore: balanceBefore,
@@ -323,7 +691,7 @@ func (t *TransactionRepo) Transfer(ctx context.Context, senderID, recipientID st
 	return response, nil
 }
 
-func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID, senderID, recipientID string, amount float64, remarks string) error {
+func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID string) error {
 	// Begin transaction
 	tx, err := t.db.Begin(ctx)
 	if err != nil {
@@ -331,19 +699,58 @@ func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID, sende
 	}
 	defer tx.Rollback(ctx)
 
-	log.Printf("Processing transfer: ID=%s, Sender=%s, Recipient=%s, Amount=%.2f",
+	// Lock the transfer row first and only apply it while it is still PENDING, so a
+	// redelivered message can never debit the sender twice. The parties and the amount come
+	// from the locked row, never from the message which may be a replayed or edited copy.
+	query := `
+		SELECT t.status, tr.sender_user, tr.target_user, t.amount, COALESCE(tr.remarks, '')
+		FROM transactions t
+			JOIN transfer tr ON t.id = tr.transaction_id
+		WHERE t.id = $1
+		FOR UPDATE OF t`
+
+	var status models.TransactionStatus
+	var senderID, recipientID, remarks string
+	var amount pkg.Money
+	err = tx.QueryRow(ctx, query, transferID).Scan(&status, &senderID, &recipientID, &amount, &remarks)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrTransferNotFound
+		}
+		return err
+	}
+
+	log.Printf("Processing transfer: ID=%s, Sender=%s, Recipient=%s, Amount=%s",
 		transferID, senderID, recipientID, amount)
 
+	if status != models.TransactionStatusPending {
+		log.Printf("Transfer %s is already %s, skipping", transferID, status)
+		return ErrTransferAlreadyProcessed
+	}
+
+	// Lock both wallets (in wallet ID order) before touching either balance
+	wallets, err := t.lockWallets(ctx, tx, senderID, recipientID)
+	if err != nil {
+		log.Printf("Error locking wallets: %v", err)
+		return err
+	}
+
+	// Re-check the sender balance under the lock, it may have changed since Transfer was accepted
+	if wallets[senderID].Balance < amount {
+		log.Printf("Insufficient balance for transfer %s", transferID)
+		return ErrInsufficientBalance
+	}
+
 	// Update sender's wallet (deduct amount)
 	updateSenderQuery := `
 		UPDATE wallets 
-		SET balance = balance - $1::money, updated_at = NOW()
+		SET balance = balance - $1, updated_at = NOW()
 		WHERE user_id = $2`
 
 	senderResult, err := tx.Exec(ctx, updateSenderQuery, amount, senderID)
 	if err != nil {
 		log.Printf("Error updating sender wallet: %v", err)
-		return err
+		return mapBalanceError(err)
 	}
 
 	// Check if sender's wallet was updated
@@ -355,23 +762,26 @@ func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID, sende
 
 	log.Printf("Updated sender wallet for user ID: %s", senderID)
 
-	// Get recipient wallet ID
-	recipientWalletID, recipientBalance, err := t.GetWalletByUserID(ctx, recipientID)
-	if err != nil {
-		log.Printf("Error getting recipient wallet: %v", err)
+	// Recipient wallet was locked above
+	recipientWalletID := wallets[recipientID].ID
+	recipientBalance := wallets[recipientID].Balance
+
+	// The credit must keep the recipient under the maximum balance of their KYC level
+	if err := checkIncomingLimits(ctx, tx, recipientID, recipientBalance, amount); err != nil {
+		log.Printf("Recipient limit exceeded for transfer %s: %v", transferID, err)
 		return err
 	}
 
-	log.Printf("Found recipient wallet: %s with balance %.2f", recipientWalletID, recipientBalance)
+	log.Printf("Found recipient wallet: %s with balance %s", recipientWalletID, recipientBalance)
 
 	// Create a credit transaction for the recipient
 	recipientTxID := models.NewTransaction().ID
 	recipientTxQuery := `
-		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	_, err = tx.Exec(ctx, recipientTxQuery, recipientTxID, recipientWalletID, models.TransactionTypeTransfer,
-		amount, recipientBalance, recipientBalance+amount)
+		amount, recipientBalance, recipientBalance+amount, remarks)
 	if err != nil {
 		log.Printf("Error creating recipient transaction: %v", err)
 		return err
@@ -380,7 +790,7 @@ func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID, sende
 	// Update recipient's wallet (add amount)
 	updateRecipientQuery := `
 		UPDATE wallets 
-		SET balance = balance + $1::money, updated_at = NOW()
+		SET balance = balance + $1, updated_at = NOW()
 		WHERE user_id = $2`
 
 	recipientResult, err := tx.Exec(ctx, updateRecipientQuery, amount, recipientID)
@@ -398,6 +808,39 @@ func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID, sende
 
 	log.Printf("Updated recipient wallet for user ID: %s", recipientID)
 
+	// Settle the sender leg with the balances that were actually applied
+	senderBalance := wallets[senderID].Balance
+	settleQuery := `
+		UPDATE transactions
+		SET status = $2, balance_before = $3, balance_after = $4, updated_at = NOW()
+		WHERE id = $1`
+
+	if _, err = tx.Exec(ctx, settleQuery, transferID, models.TransactionStatusSuccess,
+		senderBalance, senderBalance-amount); err != nil {
+		log.Printf("Error settling sender transaction: %v", err)
+		return err
+	}
+
+	// Link the recipient leg back to the transfer
+	transferQuery := `
+		UPDATE transfer
+		SET credit_transaction_id = $2, processed_at = NOW(), updated_at = NOW()
+		WHERE transaction_id = $1`
+
+	if _, err = tx.Exec(ctx, transferQuery, transferID, recipientTxID); err != nil {
+		log.Printf("Error updating transfer record: %v", err)
+		return err
+	}
+
+	// Move the amount between the two wallet accounts
+	journal := models.NewJournal(transferID, models.JournalKindTransfer, remarks).
+		Debit(wallets[senderID].ID, amount).
+		Credit(recipientWalletID, amount)
+	if err = PostJournal(ctx, tx, journal); err != nil {
+		log.Printf("Error posting transfer journal: %v", err)
+		return err
+	}
+
 	// Commit transaction
 	if err = tx.Commit(ctx); err != nil {
 		log.Printf("Error committing transaction: %v", err)
@@ -408,6 +851,314 @@ func (t *TransactionRepo) ProcessTransfer(ctx context.Context, transferID, sende
 	return nil
 }
 
+// FailTransfer marks a PENDING transfer as FAILED and records why it could not be processed
+func (t *TransactionRepo) FailTransfer(ctx context.Context, transferID, reason string) error {
+	tx, err := t.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	statusQuery := `
+		UPDATE transactions
+		SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = $3`
+
+	result, err := tx.Exec(ctx, statusQuery, transferID, models.TransactionStatusFailed, models.TransactionStatusPending)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		// Already settled or failed, nothing to do
+		return nil
+	}
+
+	transferQuery := `
+		UPDATE transfer
+		SET failure_reason = $2, processed_at = NOW(), updated_at = NOW()
+		WHERE transaction_id = $1`
+
+	if _, err = tx.Exec(ctx, transferQuery, transferID, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// FailStuckTransfers marks transfers still PENDING after olderThan as FAILED, so a message lost
+// by the broker, e.g. dead-lettered over the delivery limit, stops holding the sender's funds.
+// cmd/dlq replay reopens them if their message is still in the dead-letter queue. A transfer whose
+// outbox message was never published is left alone, the relay still delivers it once the broker
+// is back and the worker would drop it as already processed.
+func (t *TransactionRepo) FailStuckTransfers(ctx context.Context, olderThan time.Duration) (int64, error) {
+	query := `
+		WITH stuck AS (
+			UPDATE transactions t
+			SET status = $1, updated_at = NOW()
+			FROM transfer tr
+			WHERE tr.transaction_id = t.id
+				AND t.status = $2
+				AND t.created_at < NOW() - make_interval(secs => $3)
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox o
+					WHERE o.aggregate_id = t.id AND o.status = $5
+				)
+			RETURNING t.id
+		)
+		UPDATE transfer
+		SET failure_reason = $4, processed_at = NOW(), updated_at = NOW()
+		WHERE transaction_id IN (SELECT id FROM stuck)`
+
+	result, err := t.db.Exec(ctx, query, models.TransactionStatusFailed, models.TransactionStatusPending,
+		olderThan.Seconds(), "transfer was not processed in time", models.OutboxStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ReopenTransfer puts a FAILED transfer back to PENDING and queues it again through the outbox.
+// A transfer that is still PENDING is only queued again, a settled one is left untouched.
+// It returns the status the transfer had before.
+func (t *TransactionRepo) ReopenTransfer(ctx context.Context, transferID string) (models.TransactionStatus, error) {
+	tx, err := t.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT t.status, tr.sender_user, tr.target_user, t.amount, COALESCE(tr.remarks, '')
+		FROM transactions t
+			JOIN transfer tr ON t.id = tr.transaction_id
+		WHERE t.id = $1
+		FOR UPDATE OF t`
+
+	var status models.TransactionStatus
+	msg := pkg.TransferMessage{TransferID: transferID}
+	err = tx.QueryRow(ctx, query, transferID).Scan(&status, &msg.SenderID, &msg.RecipientID, &msg.Amount, &msg.Remarks)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrTransferNotFound
+		}
+		return "", err
+	}
+
+	if status == models.TransactionStatusSuccess {
+		return status, nil
+	}
+
+	if status == models.TransactionStatusFailed {
+		reopenQuery := `UPDATE transactions SET status = $2, updated_at = NOW() WHERE id = $1`
+		if _, err = tx.Exec(ctx, reopenQuery, transferID, models.TransactionStatusPending); err != nil {
+			return "", err
+		}
+
+		transferQuery := `
+			UPDATE transfer
+			SET failure_reason = NULL, processed_at = NULL, updated_at = NOW()
+			WHERE transaction_id = $1`
+		if _, err = tx.Exec(ctx, transferQuery, transferID); err != nil {
+			return "", err
+		}
+	}
+
+	if err = t.queueTransfer(ctx, tx, msg); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// queueTransfer writes the transfer message to the outbox inside tx, the outbox relay
+// publishes it once committed so a crash can never lose an accepted transfer
+func (t *TransactionRepo) queueTransfer(ctx context.Context, tx pgx.Tx, msg pkg.TransferMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return insertOutbox(ctx, tx, models.NewOutboxMessage(msg.TransferID, pkg.TransferRoutingKey, payload))
+}
+
+// GetTransfer returns the current state of a transfer sent or received by the user
+func (t *TransactionRepo) GetTransfer(ctx context.Context, userID, transferID string) (*models.TransferStatusResponse, error) {
+	query := `
+		SELECT
+			t.id,
+			t.status,
+			tr.sender_user,
+			tr.target_user,
+			t.amount,
+			COALESCE(tr.remarks, ''),
+			COALESCE(tr.failure_reason, ''),
+			t.created_at,
+			t.updated_at,
+			tr.processed_at
+		FROM transactions t
+			JOIN transfer tr ON t.id = tr.transaction_id
+		WHERE t.id = $1 AND (tr.sender_user = $2 OR tr.target_user = $2)`
+
+	var transfer models.TransferStatusResponse
+	err := t.db.QueryRow(ctx, query, transferID, userID).Scan(
+		&transfer.ID,
+		&transfer.Status,
+		&transfer.SenderID,
+		&transfer.RecipientID,
+		&transfer.Amount,
+		&transfer.Remarks,
+		&transfer.FailureReason,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+		&transfer.ProcessedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+// GetTransactionDetail returns a transaction seen from the user, who must own it or be the other
+// side of the transfer it belongs to. Balances are only shown to the owner of the wallet.
+func (t *TransactionRepo) GetTransactionDetail(ctx context.Context, userID, transactionID string) (*models.TransactionDetailResponse, error) {
+	query := `
+		SELECT
+			h.id,
+			h.user_id = $2,
+			h.status,
+			h.transaction_type,
+			h.direction,
+			h.amount,
+			h.remarks,
+			h.balance_before,
+			h.balance_after,
+			h.transfer_id,
+			tr.transaction_id,
+			tr.credit_transaction_id,
+			COALESCE(tr.failure_reason, ''),
+			u.id,
+			COALESCE(u.firstname, '') || ' ' || COALESCE(u.lastname, ''),
+			COALESCE(u.phone, ''),
+			h.created_at,
+			h.updated_at
+		FROM transaction_history h
+			LEFT JOIN transfer tr ON tr.transaction_id = h.transfer_id
+			LEFT JOIN users u ON u.id = CASE WHEN h.user_id = $2 THEN h.counterparty_user_id ELSE h.user_id END
+		WHERE h.id = $1 AND (h.user_id = $2 OR h.counterparty_user_id = $2)`
+
+	var detail models.TransactionDetailResponse
+	var owner bool
+	var balanceBefore, balanceAfter pkg.Money
+	var counterpartyID *string
+	var counterpartyName, counterpartyPhone string
+	err := t.db.QueryRow(ctx, query, transactionID, userID).Scan(
+		&detail.ID,
+		&owner,
+		&detail.Status,
+		&detail.TransactionType,
+		&detail.Direction,
+		&detail.Amount,
+		&detail.Remarks,
+		&balanceBefore,
+		&balanceAfter,
+		&detail.TransferID,
+		&detail.DebitTransactionID,
+		&detail.CreditTransactionID,
+		&detail.FailureReason,
+		&counterpartyID,
+		&counterpartyName,
+		&counterpartyPhone,
+		&detail.CreatedAt,
+		&detail.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+
+	if owner {
+		detail.BalanceBefore = &balanceBefore
+		detail.BalanceAfter = &balanceAfter
+	} else if detail.Direction == models.TransactionDirectionOut {
+		// The caller is on the receiving side of this leg
+		detail.Direction = models.TransactionDirectionIn
+	} else {
+		detail.Direction = models.TransactionDirectionOut
+	}
+
+	if counterpartyID != nil {
+		detail.Counterparty = &models.CounterpartyResponse{
+			UserID: *counterpartyID,
+			Name:   pkg.MaskName(counterpartyName),
+			Phone:  pkg.MaskPhone(counterpartyPhone),
+		}
+	}
+
+	historyQuery := `
+		SELECT status, created_at
+		FROM transaction_status_history
+		WHERE transaction_id = $1
+		ORDER BY id`
+
+	rows, err := t.db.Query(ctx, historyQuery, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	detail.StatusHistory = []models.StatusChangeResponse{}
+	for rows.Next() {
+		var change models.StatusChangeResponse
+		if err := rows.Scan(&change.Status, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		detail.StatusHistory = append(detail.StatusHistory, change)
+	}
+
+	return &detail, rows.Err()
+}
+
+// TransferFailureReason turns a processing error into a reason that is safe to show to the client
+func TransferFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInsufficientBalance):
+		return "insufficient balance"
+	case errors.Is(err, ErrWalletNotFound):
+		return "wallet not found"
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrRecipientNotFound):
+		return "recipient not found"
+	case errors.Is(err, ErrLimitExceeded):
+		return "recipient balance limit exceeded"
+	case errors.Is(err, ErrTransferNotFound):
+		return "transfer not found"
+	default:
+		return "transfer could not be processed"
+	}
+}
+
+// pendingOutgoing sums the transfers from a wallet that were accepted but not yet debited
+func (t *TransactionRepo) pendingOutgoing(ctx context.Context, tx pgx.Tx, walletID string) (pkg.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(t.amount), 0)
+		FROM transactions t
+			JOIN transfer tr ON t.id = tr.transaction_id
+		WHERE t.wallet_id = $1 AND t.status = $2`
+
+	var pending pkg.Money
+	if err := tx.QueryRow(ctx, query, walletID, models.TransactionStatusPending).Scan(&pending); err != nil {
+		return 0, err
+	}
+	return pending, nil
+}
+
 func (t *TransactionRepo) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
 	var user models.User
 	query := `SELECT id, firstname, lastname, phone, address, created_at, updated_at 
@@ -419,7 +1170,7 @@ func (t *TransactionRepo) GetUserByID(ctx context.Context, userID string) (*mode
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
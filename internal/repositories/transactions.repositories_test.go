@@ -0,0 +1,419 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+	"github.com/redha28/foomlet/pkg"
+)
+
+const parallelRequests = 20
+
+// fundedUser creates a user whose wallet holds balance
+func fundedUser(t *testing.T, repo *TransactionRepo, pool *pgxpool.Pool, balance pkg.Money) string {
+	t.Helper()
+	userID := testdb.CreateUser(t, pool)
+	if balance > 0 {
+		if _, err := repo.TopUp(context.Background(), userID, balance, nil); err != nil {
+			t.Fatalf("top up: %v", err)
+		}
+	}
+	return userID
+}
+
+func walletBalance(t *testing.T, repo *TransactionRepo, userID string) pkg.Money {
+	t.Helper()
+	_, balance, err := repo.GetWalletByUserID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("get wallet: %v", err)
+	}
+	return balance
+}
+
+// runParallel starts every call at the same time and counts the ones that succeeded. Any error
+// other than ErrInsufficientBalance fails the test.
+func runParallel(t *testing.T, n int, call func() error) int {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	start := make(chan struct{})
+	succeeded := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			err := call()
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrInsufficientBalance):
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return succeeded
+}
+
+func TestPaymentsInParallelNeverOverdraw(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	initial := pkg.NewMoney(1000, 0)
+	amount := pkg.NewMoney(150, 0)
+	userID := fundedUser(t, repo, pool, initial)
+
+	succeeded := runParallel(t, parallelRequests, func() error {
+		_, err := repo.Payment(ctx, userID, amount, "parallel payment", nil, nil)
+		return err
+	})
+
+	affordable := int(initial / amount)
+	if succeeded != affordable {
+		t.Errorf("%d payments succeeded, want %d", succeeded, affordable)
+	}
+
+	balance := walletBalance(t, repo, userID)
+	if balance < 0 {
+		t.Fatalf("balance %s is negative", balance)
+	}
+	if want := initial - pkg.Money(succeeded)*amount; balance != want {
+		t.Errorf("balance is %s, want %s", balance, want)
+	}
+}
+
+func TestTransfersInParallelNeverOverdraw(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	initial := pkg.NewMoney(1000, 0)
+	amount := pkg.NewMoney(150, 0)
+	senderID := fundedUser(t, repo, pool, initial)
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	var mu sync.Mutex
+	var accepted []string
+	succeeded := runParallel(t, parallelRequests, func() error {
+		transfer, err := repo.Transfer(ctx, senderID, recipientID, amount, "parallel transfer", nil, nil)
+		if err == nil {
+			mu.Lock()
+			accepted = append(accepted, transfer.ID)
+			mu.Unlock()
+		}
+		return err
+	})
+
+	affordable := int(initial / amount)
+	if succeeded != affordable {
+		t.Errorf("%d transfers were accepted, want %d", succeeded, affordable)
+	}
+
+	// Settle the accepted transfers in parallel as the workers would
+	processed := 0
+	var wg sync.WaitGroup
+	for _, transferID := range accepted {
+		wg.Add(1)
+		go func(transferID string) {
+			defer wg.Done()
+			err := repo.ProcessTransfer(ctx, transferID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				t.Errorf("process transfer %s: %v", transferID, err)
+				return
+			}
+			processed++
+		}(transferID)
+	}
+	wg.Wait()
+
+	senderBalance := walletBalance(t, repo, senderID)
+	recipientBalance := walletBalance(t, repo, recipientID)
+	if senderBalance < 0 {
+		t.Fatalf("sender balance %s is negative", senderBalance)
+	}
+	if total := senderBalance + recipientBalance; total != initial {
+		t.Errorf("wallets hold %s together, want %s", total, initial)
+	}
+	if want := pkg.Money(processed) * amount; recipientBalance != want {
+		t.Errorf("recipient balance is %s, want %s", recipientBalance, want)
+	}
+}
+
+func TestPaymentsAndTransfersShareTheBalance(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	initial := pkg.NewMoney(1000, 0)
+	amount := pkg.NewMoney(100, 0)
+	senderID := fundedUser(t, repo, pool, initial)
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	// Half the requests pay, half transfer; PENDING transfers reserve their amount
+	var mu sync.Mutex
+	next := 0
+	succeeded := runParallel(t, parallelRequests, func() error {
+		mu.Lock()
+		next++
+		payment := next%2 == 0
+		mu.Unlock()
+
+		if payment {
+			_, err := repo.Payment(ctx, senderID, amount, "mixed payment", nil, nil)
+			return err
+		}
+		_, err := repo.Transfer(ctx, senderID, recipientID, amount, "mixed transfer", nil, nil)
+		return err
+	})
+
+	if affordable := int(initial / amount); succeeded != affordable {
+		t.Errorf("%d requests succeeded, want %d", succeeded, affordable)
+	}
+	if balance := walletBalance(t, repo, senderID); balance < 0 {
+		t.Fatalf("sender balance %s is negative", balance)
+	}
+}
+
+// backdateTransfer moves the creation of a transfer two hours into the past
+func backdateTransfer(t *testing.T, pool *pgxpool.Pool, transferID string) {
+	t.Helper()
+	query := `UPDATE transactions SET created_at = NOW() - INTERVAL '2 hours' WHERE id = $1`
+	if _, err := pool.Exec(context.Background(), query, transferID); err != nil {
+		t.Fatalf("backdate transfer: %v", err)
+	}
+}
+
+func TestFailStuckTransfersReleasesTheSendersFunds(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	stuck, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(100, 0), "lost by the broker", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	backdateTransfer(t, pool, stuck.ID)
+
+	// The message reached the broker, which then lost it
+	relayAll(t, NewOutboxRepo(pool))
+
+	// The whole balance is held by the stuck transfer
+	if _, err := repo.Payment(ctx, senderID, pkg.NewMoney(1, 0), "held", nil, nil); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("payment while the transfer is pending returned %v, want ErrInsufficientBalance", err)
+	}
+
+	if _, err := repo.FailStuckTransfers(ctx, time.Hour); err != nil {
+		t.Fatalf("fail stuck transfers: %v", err)
+	}
+
+	status, err := repo.GetTransfer(ctx, senderID, stuck.ID)
+	if err != nil {
+		t.Fatalf("get transfer: %v", err)
+	}
+	if status.Status != models.TransactionStatusFailed {
+		t.Errorf("stuck transfer is %s, want %s", status.Status, models.TransactionStatusFailed)
+	}
+	if _, err := repo.Payment(ctx, senderID, pkg.NewMoney(1, 0), "released", nil, nil); err != nil {
+		t.Errorf("payment after failing the stuck transfer: %v", err)
+	}
+}
+
+func TestFailStuckTransfersKeepsUnpublishedTransfers(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+
+	// The broker was down the whole time, the message is still waiting in the outbox
+	unsent, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(100, 0), "broker outage", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	backdateTransfer(t, pool, unsent.ID)
+
+	if _, err := repo.FailStuckTransfers(ctx, time.Hour); err != nil {
+		t.Fatalf("fail stuck transfers: %v", err)
+	}
+
+	status, err := repo.GetTransfer(ctx, senderID, unsent.ID)
+	if err != nil {
+		t.Fatalf("get transfer: %v", err)
+	}
+	if status.Status != models.TransactionStatusPending {
+		t.Fatalf("unpublished transfer is %s, want %s", status.Status, models.TransactionStatusPending)
+	}
+
+	// Once the broker is back the message is delivered and settles the transfer
+	if published := relayAll(t, NewOutboxRepo(pool)); published[unsent.ID] != 1 {
+		t.Fatalf("transfer was published %d times, want 1", published[unsent.ID])
+	}
+	if err := repo.ProcessTransfer(ctx, unsent.ID); err != nil {
+		t.Fatalf("process transfer: %v", err)
+	}
+	if balance := walletBalance(t, repo, recipientID); balance != pkg.NewMoney(100, 0) {
+		t.Errorf("recipient balance is %s, want %s", balance, pkg.NewMoney(100, 0))
+	}
+}
+
+func TestTransactionsAreHiddenFromOtherUsers(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+	strangerID := fundedUser(t, repo, pool, 0)
+
+	transfer, err := repo.Transfer(ctx, senderID, recipientID, pkg.NewMoney(40, 0), "private", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if err := repo.ProcessTransfer(ctx, transfer.ID); err != nil {
+		t.Fatalf("process transfer: %v", err)
+	}
+	payment, err := repo.Payment(ctx, senderID, pkg.NewMoney(10, 0), "private", nil, nil)
+	if err != nil {
+		t.Fatalf("payment: %v", err)
+	}
+
+	debit, err := repo.GetTransactionDetail(ctx, senderID, transfer.ID)
+	if err != nil {
+		t.Fatalf("sender reads the debit leg: %v", err)
+	}
+	if debit.CreditTransactionID == nil {
+		t.Fatal("settled transfer has no credit leg")
+	}
+	creditID := *debit.CreditTransactionID
+
+	// Both sides of the transfer see both legs, only the owner of a leg sees its balances
+	for _, userID := range []string{senderID, recipientID} {
+		for _, transactionID := range []string{transfer.ID, creditID} {
+			detail, err := repo.GetTransactionDetail(ctx, userID, transactionID)
+			if err != nil {
+				t.Errorf("party %s reads %s: %v", userID, transactionID, err)
+				continue
+			}
+			owner := (userID == senderID) == (transactionID == transfer.ID)
+			if (detail.BalanceAfter != nil) != owner {
+				t.Errorf("party %s sees balances of %s: %v, want %v", userID, transactionID, detail.BalanceAfter != nil, owner)
+			}
+		}
+		if _, err := repo.GetTransfer(ctx, userID, transfer.ID); err != nil {
+			t.Errorf("party %s reads the transfer: %v", userID, err)
+		}
+	}
+
+	for _, transactionID := range []string{transfer.ID, creditID, payment.ID} {
+		if _, err := repo.GetTransactionDetail(ctx, strangerID, transactionID); !errors.Is(err, ErrTransactionNotFound) {
+			t.Errorf("third user reads %s: %v, want ErrTransactionNotFound", transactionID, err)
+		}
+	}
+	if _, err := repo.GetTransfer(ctx, strangerID, transfer.ID); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("third user reads the transfer: %v, want ErrTransferNotFound", err)
+	}
+
+	// The recipient has no part in the sender's payment
+	if _, err := repo.GetTransactionDetail(ctx, recipientID, payment.ID); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("recipient reads the sender's payment: %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestTransferStatusLifecycle(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := NewTransactionRepo(pool)
+	ctx := context.Background()
+
+	senderID := fundedUser(t, repo, pool, pkg.NewMoney(100, 0))
+	recipientID := fundedUser(t, repo, pool, 0)
+	amount := pkg.NewMoney(60, 0)
+
+	settled, err := repo.Transfer(ctx, senderID, recipientID, amount, "settled", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	// This recipient cannot hold what the second transfer sends
+	maxBalance := pkg.NewMoney(10, 0)
+	limitedID := limitedUser(t, repo, pool, models.TransactionLimits{MaxBalance: &maxBalance}, 0)
+	failed, err := repo.Transfer(ctx, senderID, limitedID, pkg.NewMoney(30, 0), "failed", nil, nil)
+	if err != nil {
+		t.Fatalf("second transfer: %v", err)
+	}
+
+	status, err := repo.GetTransfer(ctx, recipientID, settled.ID)
+	if err != nil {
+		t.Fatalf("get transfer: %v", err)
+	}
+	if status.Status != models.TransactionStatusPending || status.ProcessedAt != nil {
+		t.Errorf("new transfer is %s processed at %v, want PENDING and unprocessed", status.Status, status.ProcessedAt)
+	}
+
+	if err := repo.ProcessTransfer(ctx, settled.ID); err != nil {
+		t.Fatalf("process transfer: %v", err)
+	}
+	status, err = repo.GetTransfer(ctx, senderID, settled.ID)
+	if err != nil {
+		t.Fatalf("get transfer: %v", err)
+	}
+	if status.Status != models.TransactionStatusSuccess || status.ProcessedAt == nil {
+		t.Errorf("processed transfer is %s processed at %v, want SUCCESS with a time", status.Status, status.ProcessedAt)
+	}
+
+	// A redelivered message does not move the money again
+	if err := repo.ProcessTransfer(ctx, settled.ID); !errors.Is(err, ErrTransferAlreadyProcessed) {
+		t.Errorf("second processing returned %v, want ErrTransferAlreadyProcessed", err)
+	}
+
+	// The second transfer cannot be credited, the worker marks it FAILED
+	err = repo.ProcessTransfer(ctx, failed.ID)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("processing a transfer over the recipient's limit returned %v, want ErrLimitExceeded", err)
+	}
+	if err := repo.FailTransfer(ctx, failed.ID, TransferFailureReason(err)); err != nil {
+		t.Fatalf("fail transfer: %v", err)
+	}
+	status, err = repo.GetTransfer(ctx, senderID, failed.ID)
+	if err != nil {
+		t.Fatalf("get transfer: %v", err)
+	}
+	if status.Status != models.TransactionStatusFailed || status.FailureReason == "" || status.ProcessedAt == nil {
+		t.Errorf("failed transfer is %s (%q) processed at %v, want FAILED with a reason", status.Status, status.FailureReason, status.ProcessedAt)
+	}
+
+	// A settled transfer cannot be failed afterwards
+	if err := repo.FailTransfer(ctx, settled.ID, "late failure"); err != nil {
+		t.Fatalf("fail settled transfer: %v", err)
+	}
+	if status, err := repo.GetTransfer(ctx, senderID, settled.ID); err != nil || status.Status != models.TransactionStatusSuccess {
+		t.Errorf("settled transfer after FailTransfer = %v, %v, want SUCCESS", status, err)
+	}
+
+	if balance := walletBalance(t, repo, senderID); balance != pkg.NewMoney(40, 0) {
+		t.Errorf("sender balance is %s, want 40.00", balance)
+	}
+	if balance := walletBalance(t, repo, recipientID); balance != amount {
+		t.Errorf("recipient balance is %s, want %s", balance, amount)
+	}
+	if balance := walletBalance(t, repo, limitedID); balance != 0 {
+		t.Errorf("limited recipient balance is %s, want 0.00", balance)
+	}
+}
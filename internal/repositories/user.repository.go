@@ -2,22 +2,26 @@ package repositories
 
 import (
 	"context"
-	"errors"
+	"net/http"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/apperrors"
 	"github.com/redha28/foomlet/internal/models"
 )
 
 // Common errors
 var (
-	ErrUserAlreadyExists = errors.New("user already exists")
-	ErrUserNotFound      = errors.New("user not found")
+	ErrUserAlreadyExists = apperrors.New(http.StatusConflict, apperrors.CodeUserAlreadyExists, "User already exists")
+	ErrUserNotFound      = apperrors.New(http.StatusNotFound, apperrors.CodeUserNotFound, "User not found")
 )
 
 type UserRepoInterface interface {
 	UseRegister(ctx context.Context, user models.UserRegist, hashedPin string) (*models.UserResponse, error)
 	GetUserByPhone(ctx context.Context, phone string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
+	UpdatePin(ctx context.Context, userID, hashedPin string, reason models.SessionRevokedReason) error
+	RehashPin(ctx context.Context, userID, oldHash, newHash string) error
 	UpdateUserProfile(ctx context.Context, userID string, profile models.UpdateProfileRequest) (*models.UpdateProfileResponse, error)
 }
 
@@ -105,6 +109,59 @@ func (u *UserRepo) GetUserByPhone(ctx context.Context, phone string) (*models.Us
 	return &user, nil
 }
 
+func (u *UserRepo) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	query := `SELECT id, firstname, lastname, phone, address, pin, created_at, updated_at 
+			  FROM users WHERE id = $1`
+
+	err := u.db.QueryRow(ctx, query, userID).Scan(
+		&user.ID, &user.Firstname, &user.Lastname, &user.Phone,
+		&user.Address, &user.Pin, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdatePin stores a new PIN and revokes every session of the user in the same transaction,
+// so tokens obtained with the old PIN stop working
+func (u *UserRepo) UpdatePin(ctx context.Context, userID, hashedPin string, reason models.SessionRevokedReason) error {
+	tx, err := u.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `UPDATE users SET pin = $1, updated_at = NOW() WHERE id = $2`, hashedPin, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RehashPin swaps the hash of an unchanged PIN, it does nothing if the PIN was changed meanwhile
+func (u *UserRepo) RehashPin(ctx context.Context, userID, oldHash, newHash string) error {
+	_, err := u.db.Exec(ctx, `UPDATE users SET pin = $1 WHERE id = $2 AND pin = $3`, newHash, userID, oldHash)
+	return err
+}
+
 func (u *UserRepo) UpdateUserProfile(ctx context.Context, userID string, profile models.UpdateProfileRequest) (*models.UpdateProfileResponse, error) {
 	query := `
 		UPDATE users 
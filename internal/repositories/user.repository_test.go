@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/testdb"
+)
+
+func TestUpdatePinRevokesEverySession(t *testing.T) {
+	pool := testdb.Connect(t)
+	users := NewUserRepo(pool)
+	sessions := NewSessionRepo(pool)
+	ctx := context.Background()
+
+	userID := testdb.CreateUser(t, pool)
+	otherUserID := testdb.CreateUser(t, pool)
+
+	var revoked []string
+	for i := 0; i < 3; i++ {
+		session, err := sessions.Create(ctx, userID, uuid.NewString(), time.Now().Add(time.Hour), testDevice)
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		revoked = append(revoked, session.ID)
+	}
+	untouched, err := sessions.Create(ctx, otherUserID, uuid.NewString(), time.Now().Add(time.Hour), testDevice)
+	if err != nil {
+		t.Fatalf("create session of another user: %v", err)
+	}
+
+	if err := users.UpdatePin(ctx, userID, "new-pin-hash", models.SessionRevokedPinReset); err != nil {
+		t.Fatalf("update pin: %v", err)
+	}
+
+	for _, sessionID := range revoked {
+		if active, err := sessions.Touch(ctx, sessionID); err != nil || active {
+			t.Errorf("session %s after the PIN reset: active = %v, %v, want false", sessionID, active, err)
+		}
+	}
+	if active, err := sessions.Touch(ctx, untouched.ID); err != nil || !active {
+		t.Errorf("session of another user: active = %v, %v, want true", active, err)
+	}
+
+	user, err := users.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.Pin != "new-pin-hash" {
+		t.Errorf("stored PIN is %q, want the new hash", user.Pin)
+	}
+}
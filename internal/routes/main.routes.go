@@ -1,14 +1,63 @@
 package routes
 
 import (
+	"log"
+	"reflect"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/config"
+	"github.com/redha28/foomlet/internal/handlers"
+	"github.com/redha28/foomlet/internal/i18n"
+	"github.com/redha28/foomlet/internal/middlewares"
+	"github.com/redha28/foomlet/pkg"
 )
 
-func InitRouter(pg *pgxpool.Pool) *gin.Engine {
-	router := gin.Default()
+func InitRouter(pg *pgxpool.Pool, notifier pkg.Notifier, hasher *pkg.Hasher, tokens *pkg.JwtUtil) *gin.Engine {
+	setupValidator()
+
+	router := gin.New()
+	// Client IPs are taken from X-Forwarded-For only behind the proxies listed in TRUSTED_PROXIES,
+	// otherwise anyone could pick the IP their failed logins are counted against
+	if err := router.SetTrustedProxies(config.GetConfig().Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(gin.Logger(), middlewares.LanguageMiddleware(), gin.CustomRecovery(middlewares.Recover), middlewares.ErrorMiddleware())
+	router.NoRoute(middlewares.NotFound)
+
+	// Public keys for other services verifying our tokens, outside /api as the path is standard
+	router.GET("/.well-known/jwks.json", handlers.NewJwksHandler(tokens).GetJwks)
+
 	rg := router.Group("/api")
-	userRoute(rg, pg)
-	transactionRoute(rg, pg)
+	userRoute(rg, pg, notifier, hasher, tokens)
+	transactionRoute(rg, pg, hasher, tokens)
+	sessionRoute(rg, pg, tokens)
 	return router
 }
+
+// setupValidator makes validation errors report the JSON, query or path name of a field in the
+// language of the request
+func setupValidator() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	if err := i18n.RegisterValidator(v); err != nil {
+		log.Fatalf("Failed to register validation messages: %v", err)
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form", "uri"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/handlers"
+	"github.com/redha28/foomlet/internal/middlewares"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+func sessionRoute(r *gin.RouterGroup, db *pgxpool.Pool, tokens *pkg.JwtUtil) {
+	repo := repositories.NewSessionRepo(db)
+	handlers := handlers.NewSessionHandler(repo)
+
+	sessions := r.Group("/sessions")
+	sessions.Use(middlewares.AuthMiddleware(repo, tokens))
+	{
+		sessions.GET("", handlers.GetSessions)
+		sessions.DELETE("/:id", handlers.DeleteSession)
+	}
+}
@@ -6,14 +6,22 @@ import (
 	"github.com/redha28/foomlet/internal/handlers"
 	"github.com/redha28/foomlet/internal/middlewares"
 	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
 )
 
-func transactionRoute(r *gin.RouterGroup, db *pgxpool.Pool) {
+func transactionRoute(r *gin.RouterGroup, db *pgxpool.Pool, hasher *pkg.Hasher, tokens *pkg.JwtUtil) {
 	repo := repositories.NewTransactionRepo(db)
-	handlers := handlers.NewTransactionHandler(repo)
+	stepUp := handlers.NewStepUpHandler(repositories.NewUserRepo(db), repositories.NewLoginThrottleRepo(db), hasher, tokens)
+	handlers := handlers.NewTransactionHandler(repo, stepUp)
+	idempotency := middlewares.IdempotencyMiddleware(repositories.NewIdempotencyRepo(db))
+	authMiddleware := middlewares.AuthMiddleware(repositories.NewSessionRepo(db), tokens)
 
-	r.POST("/topup", middlewares.AuthMiddleware(), handlers.TopUp)
-	r.POST("/payments", middlewares.AuthMiddleware(), handlers.Payment)
-	r.POST("/transfers", middlewares.AuthMiddleware(), handlers.Transfer)
-	r.GET("/transactions", middlewares.AuthMiddleware(), handlers.GetAllTransactions)
+	r.GET("/wallet", authMiddleware, handlers.GetWallet)
+	r.POST("/topup", authMiddleware, idempotency, handlers.TopUp)
+	r.POST("/payments", authMiddleware, idempotency, handlers.Payment)
+	r.POST("/transfers", authMiddleware, idempotency, handlers.Transfer)
+	r.GET("/transfers/:id", authMiddleware, handlers.GetTransfer)
+	r.GET("/transactions", authMiddleware, handlers.GetAllTransactions)
+	r.GET("/transactions/:id", authMiddleware, handlers.GetTransaction)
+	r.GET("/statements", authMiddleware, handlers.GetStatement)
 }
@@ -6,22 +6,36 @@ import (
 	"github.com/redha28/foomlet/internal/handlers"
 	"github.com/redha28/foomlet/internal/middlewares"
 	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
 )
 
-func userRoute(r *gin.RouterGroup, db *pgxpool.Pool) {
+func userRoute(r *gin.RouterGroup, db *pgxpool.Pool, notifier pkg.Notifier, hasher *pkg.Hasher, tokens *pkg.JwtUtil) {
 	repo := repositories.NewUserRepo(db)
-	handlers := handlers.NewUserHandler(repo)
+	sessions := repositories.NewSessionRepo(db)
+	throttle := repositories.NewLoginThrottleRepo(db)
+	codes := repositories.NewOneTimeCodeRepo(db)
+	stepUp := handlers.NewStepUpHandler(repo, throttle, hasher, tokens)
+	handlers := handlers.NewUserHandler(repo, sessions, throttle, codes, notifier, hasher, tokens)
+	authMiddleware := middlewares.AuthMiddleware(sessions, tokens)
 
 	auth := r.Group("/auth")
 	{
 		auth.POST("", handlers.Login)
 		auth.POST("/new", handlers.Register)
 		auth.POST("/refresh", handlers.RefreshToken)
+		auth.POST("/logout", authMiddleware, handlers.Logout)
+		auth.POST("/logout/all", authMiddleware, handlers.LogoutAll)
+		auth.POST("/step-up", authMiddleware, stepUp.Verify)
+		auth.POST("/unlock/code", handlers.RequestUnlockCode)
+		auth.POST("/unlock", handlers.Unlock)
+		auth.POST("/pin/reset/code", handlers.RequestPinResetCode)
+		auth.POST("/pin/reset", handlers.ResetPin)
 	}
 
 	profile := r.Group("/profile")
-	profile.Use(middlewares.AuthMiddleware())
+	profile.Use(authMiddleware)
 	{
 		profile.PATCH("", handlers.UpdateProfile)
+		profile.POST("/pin", handlers.ChangePin)
 	}
 }
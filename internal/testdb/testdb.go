@@ -0,0 +1,85 @@
+// Package testdb connects tests to a disposable Postgres database with every migration applied,
+// given in TEST_DATABASE_URL. Tests using it are skipped when the variable is not set.
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EnvURL names the variable holding the connection string of the test database
+const EnvURL = "TEST_DATABASE_URL"
+
+// UnlimitedKYCLevel has no transaction limits, so tests only run into the balance checks
+const UnlimitedKYCLevel = "TEST_UNLIMITED"
+
+// Connect opens a pool to the test database, closed when the test ends
+func Connect(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv(EnvURL)
+	if url == "" {
+		t.Skipf("%s is not set, skipping database test", EnvURL)
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	// A level with every limit NULL
+	query := `INSERT INTO transaction_limits (kyc_level) VALUES ($1) ON CONFLICT (kyc_level) DO NOTHING`
+	if _, err := pool.Exec(ctx, query, UnlimitedKYCLevel); err != nil {
+		t.Fatalf("create unlimited KYC level: %v", err)
+	}
+
+	return pool
+}
+
+// CreateUser inserts a user on the unlimited KYC level with an empty wallet and returns its ID
+func CreateUser(t testing.TB, pool *pgxpool.Pool) string {
+	t.Helper()
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	userQuery := `
+		INSERT INTO users (firstname, lastname, phone, address, pin, kyc_level)
+		VALUES ('Test', 'User', $1, 'Test address', '', $2)
+		RETURNING id`
+	if err := tx.QueryRow(ctx, userQuery, randomPhone(t), UnlimitedKYCLevel).Scan(&userID); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// The wallet trigger opens its ledger account
+	if _, err := tx.Exec(ctx, `INSERT INTO wallets (user_id) VALUES ($1)`, userID); err != nil {
+		t.Fatalf("create wallet: %v", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit user: %v", err)
+	}
+	return userID
+}
+
+// randomPhone returns a phone number unlikely to exist already, within the 20 characters of users.phone
+func randomPhone(t testing.TB) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1e12))
+	if err != nil {
+		t.Fatalf("random phone: %v", err)
+	}
+	return fmt.Sprintf("0899%012d", n.Int64())
+}
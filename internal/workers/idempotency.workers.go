@@ -0,0 +1,31 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+// RunIdempotencyJanitor removes expired idempotency keys once an hour
+func RunIdempotencyJanitor(ctx context.Context, repo repositories.IdempotencyRepoInterface) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := repo.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("Failed to purge expired idempotency keys: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Purged %d expired idempotency keys", purged)
+			}
+		}
+	}
+}
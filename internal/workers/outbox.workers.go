@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// OutboxRelay publishes the messages written to the outbox table to a TransferQueue
+type OutboxRelay struct {
+	outbox       repositories.OutboxRepoInterface
+	queue        pkg.TransferQueue
+	pollInterval time.Duration
+	batchSize    int
+}
+
+func NewOutboxRelay(outbox repositories.OutboxRepoInterface, queue pkg.TransferQueue, pollInterval time.Duration, batchSize int) *OutboxRelay {
+	return &OutboxRelay{
+		outbox:       outbox,
+		queue:        queue,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+	}
+}
+
+// Run publishes pending outbox messages until ctx is cancelled. Messages stay in the outbox
+// until the queue accepts them, so transfers survive restarts and broker outages.
+func (o *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	log.Println("Outbox relay started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopping due to context cancellation")
+			return
+		case <-ticker.C:
+			if !o.queue.IsReady() {
+				// Leave the messages in the outbox until the broker is back
+				continue
+			}
+
+			// Keep draining while full batches are being sent
+			for {
+				sent, err := o.outbox.RelayPending(ctx, o.batchSize, o.publish)
+				if err != nil {
+					log.Printf("Outbox relay error: %v", err)
+				}
+				if sent > 0 {
+					log.Printf("Outbox relay published %d messages", sent)
+				}
+				if err != nil || sent < o.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (o *OutboxRelay) publish(ctx context.Context, msg models.OutboxMessage) error {
+	var transferMsg pkg.TransferMessage
+	if err := json.Unmarshal(msg.Payload, &transferMsg); err != nil {
+		return err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return o.queue.PublishTransfer(publishCtx, transferMsg)
+}
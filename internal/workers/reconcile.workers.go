@@ -0,0 +1,38 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+// RunReconciliation reconciles wallet balances every interval and logs the discrepancies it finds
+func RunReconciliation(ctx context.Context, repo repositories.ReconcileRepoInterface, interval, stuckAfter time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Println("Reconciliation job started, running every", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := repo.Reconcile(ctx, stuckAfter)
+			if err != nil {
+				log.Printf("Reconciliation failed: %v", err)
+				continue
+			}
+			if report.Clean() {
+				log.Printf("Reconciliation clean: %d wallets, %d transfers checked",
+					report.WalletsChecked, report.TransfersChecked)
+				continue
+			}
+
+			body, _ := json.Marshal(report)
+			log.Printf("Reconciliation found %d discrepancies: %s", len(report.Discrepancies), body)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+// RunSessionJanitor removes expired sessions and their refresh tokens, and spent step-up tokens
+// past their expiry, once an hour
+func RunSessionJanitor(ctx context.Context, repo repositories.SessionRepoInterface, stepUp repositories.StepUpTokenRepoInterface) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := repo.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("Failed to purge expired sessions: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired sessions", purged)
+			}
+
+			purged, err = stepUp.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("Failed to purge spent step-up tokens: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d spent step-up tokens", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redha28/foomlet/internal/repositories"
+)
+
+// RunLoginThrottleJanitor removes failed-login counters older than window and expired one-time
+// codes once an hour
+func RunLoginThrottleJanitor(ctx context.Context, throttle repositories.LoginThrottleRepoInterface, codes repositories.OneTimeCodeRepoInterface, window time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := throttle.PurgeStale(ctx, window)
+			if err != nil {
+				log.Printf("Failed to purge stale login throttles: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d stale login throttles", purged)
+			}
+
+			purged, err = codes.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("Failed to purge expired one-time codes: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired one-time codes", purged)
+			}
+		}
+	}
+}
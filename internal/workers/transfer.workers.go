@@ -0,0 +1,144 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// TransferWorker applies the transfers delivered by a TransferQueue
+type TransferWorker struct {
+	repo  repositories.TransactionRepoInterface
+	queue pkg.TransferQueue
+}
+
+func NewTransferWorker(repo repositories.TransactionRepoInterface, queue pkg.TransferQueue) *TransferWorker {
+	return &TransferWorker{repo: repo, queue: queue}
+}
+
+// Run processes transfers until ctx is cancelled or the queue is closed
+func (w *TransferWorker) Run(ctx context.Context) {
+	log.Println("Starting transfer worker...")
+
+	msgs, err := w.queue.ConsumeTransfers(ctx)
+	if err != nil {
+		log.Printf("Failed to consume transfers: %v", err)
+		return
+	}
+
+	log.Println("Transfer worker started, processing messages from queue")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Transfer worker stopping due to context cancellation")
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				log.Println("Transfer worker stopping - queue closed")
+				return
+			}
+			w.handle(ctx, msg)
+		}
+	}
+}
+
+// handle processes one delivery and settles it
+func (w *TransferWorker) handle(ctx context.Context, msg pkg.TransferDelivery) {
+	log.Printf("Received transfer message: %s", msg.Body())
+
+	var transferMsg pkg.TransferMessage
+	if err := json.Unmarshal(msg.Body(), &transferMsg); err != nil {
+		log.Printf("Error unmarshalling message: %v", err)
+		msg.DeadLetter(ctx, "malformed message: "+err.Error()) // Don't requeue malformed messages
+		return
+	}
+
+	log.Printf("Processing transfer: %s from %s to %s for %s",
+		transferMsg.TransferID,
+		transferMsg.SenderID,
+		transferMsg.RecipientID,
+		transferMsg.Amount)
+
+	// Process the transfer, the repository takes the parties and amount from the stored transfer
+	processCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	err := w.repo.ProcessTransfer(processCtx, transferMsg.TransferID)
+	cancel()
+
+	// A redelivery of a transfer that was already applied is acknowledged without side effects
+	if errors.Is(err, repositories.ErrTransferAlreadyProcessed) {
+		msg.Ack()
+		log.Printf("Transfer %s already processed, acknowledged duplicate delivery", transferMsg.TransferID)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error processing transfer %s: %v", transferMsg.TransferID, err)
+		w.handleFailure(ctx, msg, transferMsg, err)
+		return
+	}
+
+	// Acknowledge successful processing
+	msg.Ack()
+	log.Printf("Successfully processed transfer %s", transferMsg.TransferID)
+}
+
+// handleFailure retries a failed transfer with backoff when the error is transient.
+// Permanent failures and transfers out of retries are marked FAILED and dead-lettered.
+func (w *TransferWorker) handleFailure(ctx context.Context, msg pkg.TransferDelivery, transferMsg pkg.TransferMessage, err error) {
+	class := repositories.ClassifyError(err)
+
+	if class == repositories.ErrorClassRetryable {
+		retried, retryErr := msg.Retry(ctx, err.Error())
+		if retryErr != nil {
+			log.Printf("Failed to schedule retry for transfer %s: %v", transferMsg.TransferID, retryErr)
+			msg.Nack(true) // Requeue, the broker delivery limit still applies
+			return
+		}
+		if retried {
+			log.Printf("Retrying transfer %s (attempt %d)", transferMsg.TransferID, msg.RetryCount()+1)
+			return
+		}
+		log.Printf("Transfer %s ran out of retries", transferMsg.TransferID)
+	} else {
+		log.Printf("Permanent failure for transfer %s", transferMsg.TransferID)
+	}
+
+	if err := w.repo.FailTransfer(ctx, transferMsg.TransferID, repositories.TransferFailureReason(err)); err != nil {
+		log.Printf("Error marking transfer %s as failed: %v", transferMsg.TransferID, err)
+		msg.Nack(true) // Keep the message until the failure is recorded
+		return
+	}
+
+	if err := msg.DeadLetter(ctx, fmt.Sprintf("%s: %v", class, err)); err != nil {
+		log.Printf("Failed to dead-letter transfer %s: %v", transferMsg.TransferID, err)
+	}
+}
+
+// RunStuckTransferJanitor fails transfers still PENDING after failAfter once an hour, their message
+// was published and then dead-lettered by the broker or otherwise lost, and they would hold the
+// sender's funds forever
+func RunStuckTransferJanitor(ctx context.Context, repo repositories.TransactionRepoInterface, failAfter time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			failed, err := repo.FailStuckTransfers(ctx, failAfter)
+			if err != nil {
+				log.Printf("Failed to fail stuck transfers: %v", err)
+			} else if failed > 0 {
+				log.Printf("WARNING: failed %d transfers stuck in PENDING for more than %s", failed, failAfter)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redha28/foomlet/internal/repositories"
+	"github.com/redha28/foomlet/internal/testdb"
+	"github.com/redha28/foomlet/pkg"
+)
+
+// pendingTransfer creates a sender holding balance, a recipient with an empty wallet and a
+// PENDING transfer of amount between them
+func pendingTransfer(t *testing.T, repo *repositories.TransactionRepo, pool *pgxpool.Pool, balance, amount pkg.Money) (string, string, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	senderID := testdb.CreateUser(t, pool)
+	recipientID := testdb.CreateUser(t, pool)
+	if _, err := repo.TopUp(ctx, senderID, balance, nil); err != nil {
+		t.Fatalf("top up: %v", err)
+	}
+
+	transfer, err := repo.Transfer(ctx, senderID, recipientID, amount, "worker transfer", nil, nil)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	return transfer.ID, senderID, recipientID
+}
+
+// deliver publishes every message to a MemoryQueue and hands the deliveries to the worker one
+// after the other
+func deliver(t *testing.T, worker *TransferWorker, queue *pkg.MemoryQueue, msgs ...pkg.TransferMessage) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, msg := range msgs {
+		if err := queue.PublishTransfer(ctx, msg); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	deliveries, err := queue.ConsumeTransfers(ctx)
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	for range msgs {
+		select {
+		case d := <-deliveries:
+			worker.handle(ctx, d)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for a delivery")
+		}
+	}
+}
+
+// walletState returns the balance of the user's wallet and how many transactions it has
+func walletState(t *testing.T, repo *repositories.TransactionRepo, pool *pgxpool.Pool, userID string) (pkg.Money, int) {
+	t.Helper()
+	ctx := context.Background()
+
+	walletID, balance, err := repo.GetWalletByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("get wallet: %v", err)
+	}
+	var count int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM transactions WHERE wallet_id = $1`, walletID).Scan(&count); err != nil {
+		t.Fatalf("count transactions: %v", err)
+	}
+	return balance, count
+}
+
+func TestTransferWorkerAppliesDuplicateDeliveryOnce(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := repositories.NewTransactionRepo(pool)
+	queue := pkg.NewMemoryQueue(10)
+	defer queue.Close()
+	worker := NewTransferWorker(repo, queue)
+
+	initial := pkg.NewMoney(1000, 0)
+	amount := pkg.NewMoney(250, 0)
+	transferID, senderID, recipientID := pendingTransfer(t, repo, pool, initial, amount)
+
+	msg := pkg.TransferMessage{
+		TransferID:  transferID,
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+		Remarks:     "worker transfer",
+	}
+	deliver(t, worker, queue, msg, msg)
+
+	// The sender has the top-up and the transfer, the recipient only the credit
+	senderBalance, senderTransactions := walletState(t, repo, pool, senderID)
+	if want := initial - amount; senderBalance != want {
+		t.Errorf("sender balance is %s, want %s", senderBalance, want)
+	}
+	if senderTransactions != 2 {
+		t.Errorf("sender has %d transactions, want 2", senderTransactions)
+	}
+
+	recipientBalance, recipientTransactions := walletState(t, repo, pool, recipientID)
+	if recipientBalance != amount {
+		t.Errorf("recipient balance is %s, want %s", recipientBalance, amount)
+	}
+	if recipientTransactions != 1 {
+		t.Errorf("recipient has %d transactions, want 1", recipientTransactions)
+	}
+
+	if letters := queue.DeadLetters(); len(letters) != 0 {
+		t.Errorf("%d messages were dead-lettered, want none", len(letters))
+	}
+}
+
+func TestTransferWorkerIgnoresTamperedPayload(t *testing.T) {
+	pool := testdb.Connect(t)
+	repo := repositories.NewTransactionRepo(pool)
+	queue := pkg.NewMemoryQueue(10)
+	defer queue.Close()
+	worker := NewTransferWorker(repo, queue)
+
+	initial := pkg.NewMoney(1000, 0)
+	amount := pkg.NewMoney(100, 0)
+	transferID, senderID, recipientID := pendingTransfer(t, repo, pool, initial, amount)
+	otherID := testdb.CreateUser(t, pool)
+
+	// A replayed message claiming a larger amount to another recipient
+	deliver(t, worker, queue, pkg.TransferMessage{
+		TransferID:  transferID,
+		SenderID:    senderID,
+		RecipientID: otherID,
+		Amount:      initial,
+		Remarks:     "tampered",
+	})
+
+	if balance, _ := walletState(t, repo, pool, senderID); balance != initial-amount {
+		t.Errorf("sender balance is %s, want %s", balance, initial-amount)
+	}
+	if balance, _ := walletState(t, repo, pool, recipientID); balance != amount {
+		t.Errorf("recipient balance is %s, want %s", balance, amount)
+	}
+	if balance, _ := walletState(t, repo, pool, otherID); balance != 0 {
+		t.Errorf("other user balance is %s, want 0", balance)
+	}
+}
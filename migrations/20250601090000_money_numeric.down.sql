@@ -0,0 +1,13 @@
+ALTER TABLE payments
+  ALTER COLUMN amount TYPE INT USING amount::int;
+
+ALTER TABLE transactions
+  ALTER COLUMN amount TYPE MONEY USING amount::money,
+  ALTER COLUMN balance_before TYPE MONEY USING balance_before::money,
+  ALTER COLUMN balance_after TYPE MONEY USING balance_after::money;
+
+ALTER TABLE wallets
+  ALTER COLUMN balance DROP NOT NULL,
+  ALTER COLUMN balance DROP DEFAULT,
+  ALTER COLUMN balance TYPE MONEY USING balance::money,
+  ALTER COLUMN balance SET DEFAULT 0;
@@ -0,0 +1,20 @@
+-- Store every amount as an exact NUMERIC(20,2) instead of the locale dependent MONEY type
+ALTER TABLE wallets
+  ALTER COLUMN balance DROP DEFAULT,
+  ALTER COLUMN balance TYPE NUMERIC(20,2) USING balance::numeric,
+  ALTER COLUMN balance SET DEFAULT 0,
+  ALTER COLUMN balance SET NOT NULL;
+
+ALTER TABLE transactions
+  ALTER COLUMN amount TYPE NUMERIC(20,2) USING amount::numeric,
+  ALTER COLUMN balance_before TYPE NUMERIC(20,2) USING balance_before::numeric,
+  ALTER COLUMN balance_after TYPE NUMERIC(20,2) USING balance_after::numeric;
+
+-- payments.amount used to be truncated to an INT, restore it from the parent transaction
+ALTER TABLE payments
+  ALTER COLUMN amount TYPE NUMERIC(20,2) USING amount::numeric;
+
+UPDATE payments p
+SET amount = t.amount
+FROM transactions t
+WHERE t.id = p.transaction_id;
@@ -0,0 +1,3 @@
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_user_id_key;
+
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_balance_non_negative;
@@ -0,0 +1,7 @@
+-- A wallet balance can never go below zero, even if application checks are bypassed
+ALTER TABLE wallets
+  ADD CONSTRAINT wallets_balance_non_negative CHECK (balance >= 0);
+
+-- One wallet per user, required for deterministic row locking by user_id
+ALTER TABLE wallets
+  ADD CONSTRAINT wallets_user_id_key UNIQUE (user_id);
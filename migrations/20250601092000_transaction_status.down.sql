@@ -0,0 +1,7 @@
+ALTER TABLE transfer
+  DROP COLUMN IF EXISTS processed_at,
+  DROP COLUMN IF EXISTS failure_reason;
+
+ALTER TABLE transactions
+  DROP CONSTRAINT IF EXISTS transactions_status_check,
+  DROP COLUMN IF EXISTS status;
@@ -0,0 +1,12 @@
+-- Persist the lifecycle of every transaction instead of reporting everything as SUCCESS
+ALTER TABLE transactions
+  ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'SUCCESS',
+  ADD CONSTRAINT transactions_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED'));
+
+-- Transfers are settled asynchronously, keep why and when the worker finished them
+ALTER TABLE transfer
+  ADD COLUMN failure_reason VARCHAR,
+  ADD COLUMN processed_at TIMESTAMP;
+
+-- Transfers that already exist were settled synchronously
+UPDATE transfer SET processed_at = created_at;
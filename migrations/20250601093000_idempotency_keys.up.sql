@@ -0,0 +1,13 @@
+-- Remembers the outcome of money-moving requests so client retries do not move money twice
+CREATE TABLE idempotency_keys (
+  user_id UUID NOT NULL REFERENCES users(id),
+  idempotency_key VARCHAR(255) NOT NULL,
+  request_hash VARCHAR(64) NOT NULL,
+  response_status INT,
+  response_body BYTEA,
+  created_at TIMESTAMP DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,16 @@
+-- Messages written in the same DB transaction as the change they announce,
+-- published to RabbitMQ afterwards by the outbox relay
+CREATE TABLE outbox (
+  id UUID PRIMARY KEY,
+  aggregate_id UUID NOT NULL,
+  routing_key VARCHAR(255) NOT NULL,
+  payload JSONB NOT NULL,
+  status VARCHAR(10) NOT NULL DEFAULT 'PENDING',
+  attempts INT NOT NULL DEFAULT 0,
+  last_error VARCHAR,
+  created_at TIMESTAMP DEFAULT NOW(),
+  sent_at TIMESTAMP,
+  CONSTRAINT outbox_status_check CHECK (status IN ('PENDING', 'SENT'))
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (created_at) WHERE status = 'PENDING';
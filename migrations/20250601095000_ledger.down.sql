@@ -0,0 +1,12 @@
+ALTER TABLE transfer DROP COLUMN IF EXISTS credit_transaction_id;
+
+DROP TRIGGER IF EXISTS wallets_ledger_account ON wallets;
+DROP VIEW IF EXISTS ledger_account_balances;
+DROP TABLE IF EXISTS ledger_entries CASCADE;
+DROP TABLE IF EXISTS ledger_journals CASCADE;
+DROP TABLE IF EXISTS ledger_accounts CASCADE;
+
+DROP FUNCTION IF EXISTS ledger_reject_change();
+DROP FUNCTION IF EXISTS ledger_check_journal_has_entries();
+DROP FUNCTION IF EXISTS ledger_check_journal_balanced();
+DROP FUNCTION IF EXISTS ledger_create_wallet_account();
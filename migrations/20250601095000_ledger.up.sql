@@ -0,0 +1,156 @@
+-- Double-entry ledger. Every balance change is a journal of DEBIT and CREDIT entries whose
+-- totals match. Accounts are credit-normal: a wallet balance is its credits minus its debits.
+CREATE TABLE ledger_accounts (
+  id UUID PRIMARY KEY,
+  code VARCHAR(50) UNIQUE,
+  wallet_id UUID UNIQUE REFERENCES wallets(id),
+  kind VARCHAR(10) NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  CONSTRAINT ledger_accounts_kind_check CHECK (kind IN ('WALLET', 'SYSTEM')),
+  CONSTRAINT ledger_accounts_owner_check CHECK (
+    (kind = 'WALLET' AND wallet_id IS NOT NULL AND code IS NULL) OR
+    (kind = 'SYSTEM' AND wallet_id IS NULL AND code IS NOT NULL)
+  )
+);
+
+-- System accounts on the other side of money entering and leaving the wallets
+INSERT INTO ledger_accounts (id, code, kind, name) VALUES
+  ('00000000-0000-0000-0000-000000000001', 'TOPUP_FUNDING', 'SYSTEM', 'Top-up funding'),
+  ('00000000-0000-0000-0000-000000000002', 'MERCHANT_SETTLEMENT', 'SYSTEM', 'Merchant settlement');
+
+-- Wallet accounts share the ID of their wallet
+INSERT INTO ledger_accounts (id, wallet_id, kind, name)
+SELECT id, id, 'WALLET', 'Wallet ' || id FROM wallets;
+
+CREATE FUNCTION ledger_create_wallet_account() RETURNS TRIGGER AS $$
+BEGIN
+  INSERT INTO ledger_accounts (id, wallet_id, kind, name)
+  VALUES (NEW.id, NEW.id, 'WALLET', 'Wallet ' || NEW.id);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER wallets_ledger_account
+  AFTER INSERT ON wallets
+  FOR EACH ROW EXECUTE FUNCTION ledger_create_wallet_account();
+
+CREATE TABLE ledger_journals (
+  id UUID PRIMARY KEY,
+  transaction_id UUID REFERENCES transactions(id),
+  kind VARCHAR(20) NOT NULL,
+  description VARCHAR,
+  created_at TIMESTAMP DEFAULT NOW(),
+  CONSTRAINT ledger_journals_kind_check CHECK (kind IN ('OPENING_BALANCE', 'TOPUP', 'PAYMENT', 'TRANSFER'))
+);
+
+CREATE INDEX ledger_journals_transaction_id_idx ON ledger_journals (transaction_id);
+
+CREATE TABLE ledger_entries (
+  id BIGSERIAL PRIMARY KEY,
+  journal_id UUID NOT NULL REFERENCES ledger_journals(id),
+  account_id UUID NOT NULL REFERENCES ledger_accounts(id),
+  direction VARCHAR(6) NOT NULL,
+  amount NUMERIC(20,2) NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  CONSTRAINT ledger_entries_direction_check CHECK (direction IN ('DEBIT', 'CREDIT')),
+  CONSTRAINT ledger_entries_amount_positive CHECK (amount > 0)
+);
+
+CREATE INDEX ledger_entries_journal_id_idx ON ledger_entries (journal_id);
+CREATE INDEX ledger_entries_account_id_idx ON ledger_entries (account_id);
+
+-- Balances derived from the entries alone
+CREATE VIEW ledger_account_balances AS
+SELECT
+  a.id AS account_id,
+  a.wallet_id,
+  a.code,
+  COALESCE(SUM(CASE WHEN e.direction = 'CREDIT' THEN e.amount ELSE -e.amount END), 0)::NUMERIC(20,2) AS balance
+FROM ledger_accounts a
+  LEFT JOIN ledger_entries e ON e.account_id = a.id
+GROUP BY a.id, a.wallet_id, a.code;
+
+-- Opening balances for the wallets that already hold money, funded by the top-up account
+WITH opening AS (
+  SELECT gen_random_uuid() AS journal_id, id AS wallet_id, balance FROM wallets WHERE balance > 0
+), journals AS (
+  INSERT INTO ledger_journals (id, kind, description)
+  SELECT journal_id, 'OPENING_BALANCE', 'Opening balance' FROM opening
+)
+INSERT INTO ledger_entries (journal_id, account_id, direction, amount)
+SELECT journal_id, '00000000-0000-0000-0000-000000000001', 'DEBIT', balance FROM opening
+UNION ALL
+SELECT journal_id, wallet_id, 'CREDIT', balance FROM opening;
+
+-- A journal must have entries and its debits must equal its credits once the DB transaction commits
+CREATE FUNCTION ledger_check_journal_balanced() RETURNS TRIGGER AS $$
+DECLARE
+  debits NUMERIC(20,2);
+  credits NUMERIC(20,2);
+  entries INT;
+BEGIN
+  SELECT
+    COALESCE(SUM(amount) FILTER (WHERE direction = 'DEBIT'), 0),
+    COALESCE(SUM(amount) FILTER (WHERE direction = 'CREDIT'), 0),
+    COUNT(*)
+  INTO debits, credits, entries
+  FROM ledger_entries
+  WHERE journal_id = NEW.journal_id;
+
+  IF entries < 2 OR debits <> credits THEN
+    RAISE EXCEPTION 'ledger journal % is unbalanced: debits %, credits %', NEW.journal_id, debits, credits
+      USING ERRCODE = '23514', CONSTRAINT = 'ledger_journal_balanced';
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+  AFTER INSERT ON ledger_entries
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION ledger_check_journal_balanced();
+
+-- A journal without entries never fires the check above
+CREATE FUNCTION ledger_check_journal_has_entries() RETURNS TRIGGER AS $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM ledger_entries WHERE journal_id = NEW.id) THEN
+    RAISE EXCEPTION 'ledger journal % has no entries', NEW.id
+      USING ERRCODE = '23514', CONSTRAINT = 'ledger_journal_balanced';
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_journals_has_entries
+  AFTER INSERT ON ledger_journals
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION ledger_check_journal_has_entries();
+
+-- The ledger is append-only, corrections are posted as new journals
+CREATE FUNCTION ledger_reject_change() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION '% is append-only, % is not allowed', TG_TABLE_NAME, TG_OP
+    USING ERRCODE = '42501';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_journals_append_only
+  BEFORE UPDATE OR DELETE ON ledger_journals
+  FOR EACH ROW EXECUTE FUNCTION ledger_reject_change();
+
+CREATE TRIGGER ledger_journals_no_truncate
+  BEFORE TRUNCATE ON ledger_journals
+  FOR EACH STATEMENT EXECUTE FUNCTION ledger_reject_change();
+
+CREATE TRIGGER ledger_entries_append_only
+  BEFORE UPDATE OR DELETE ON ledger_entries
+  FOR EACH ROW EXECUTE FUNCTION ledger_reject_change();
+
+CREATE TRIGGER ledger_entries_no_truncate
+  BEFORE TRUNCATE ON ledger_entries
+  FOR EACH STATEMENT EXECUTE FUNCTION ledger_reject_change();
+
+-- Link the recipient leg of a transfer back to the transfer it belongs to
+ALTER TABLE transfer
+  ADD COLUMN credit_transaction_id UUID REFERENCES transactions(id);
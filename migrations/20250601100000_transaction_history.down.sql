@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS transactions_remarks_trgm_idx;
+DROP INDEX IF EXISTS transfer_credit_transaction_id_idx;
+DROP INDEX IF EXISTS transactions_wallet_type_created_idx;
+DROP INDEX IF EXISTS transactions_wallet_created_idx;
+DROP VIEW IF EXISTS transaction_history;
+ALTER TABLE transactions DROP COLUMN IF EXISTS remarks;
+DROP EXTENSION IF EXISTS pg_trgm;
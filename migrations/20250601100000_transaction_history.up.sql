@@ -0,0 +1,54 @@
+-- Remarks are copied onto every transaction row, both legs of a transfer included, so remark search
+-- filters one column that a trigram index can serve
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE transactions ADD COLUMN remarks VARCHAR NOT NULL DEFAULT '';
+
+UPDATE transactions t SET remarks = COALESCE(p.remarks, '') FROM payments p WHERE p.transaction_id = t.id;
+UPDATE transactions t SET remarks = COALESCE(tr.remarks, '') FROM transfer tr WHERE tr.transaction_id = t.id;
+UPDATE transactions t SET remarks = COALESCE(tr.remarks, '') FROM transfer tr WHERE tr.credit_transaction_id = t.id;
+
+-- One row per transaction as its wallet owner sees it, shared by the history, detail and statement queries.
+-- The sender leg of a transfer is the row referenced by transfer.transaction_id, the recipient leg is
+-- the row referenced by transfer.credit_transaction_id.
+CREATE VIEW transaction_history AS
+SELECT
+  t.id,
+  t.wallet_id,
+  w.user_id,
+  t.transaction_type_id,
+  CASE
+    WHEN t.transaction_type_id = 1 THEN 'Top-Up'
+    WHEN t.transaction_type_id = 2 THEN 'Payment'
+    WHEN t.transaction_type_id = 3 THEN 'Transfer'
+    ELSE 'Unknown'
+  END AS transaction_type,
+  CASE
+    WHEN t.transaction_type_id = 1 THEN 'IN'
+    WHEN t.transaction_type_id = 2 THEN 'OUT'
+    WHEN ts.transaction_id IS NOT NULL THEN 'OUT'
+    ELSE 'IN'
+  END AS direction,
+  t.status,
+  t.amount,
+  t.remarks,
+  t.balance_before,
+  t.balance_after,
+  COALESCE(ts.transaction_id, tc.transaction_id) AS transfer_id,
+  COALESCE(ts.target_user, tc.sender_user) AS counterparty_user_id,
+  t.created_at,
+  t.updated_at
+FROM transactions t
+  JOIN wallets w ON w.id = t.wallet_id
+  LEFT JOIN transfer ts ON ts.transaction_id = t.id
+  LEFT JOIN transfer tc ON tc.credit_transaction_id = t.id;
+
+-- Keyset pagination walks (created_at, id) backwards inside one wallet
+CREATE INDEX transactions_wallet_created_idx ON transactions (wallet_id, created_at DESC, id DESC);
+CREATE INDEX transactions_wallet_type_created_idx ON transactions (wallet_id, transaction_type_id, created_at DESC, id DESC);
+
+-- Recipient legs are joined back to their transfer
+CREATE INDEX transfer_credit_transaction_id_idx ON transfer (credit_transaction_id);
+
+-- Remark search uses ILIKE '%text%', combined with the wallet index above
+CREATE INDEX transactions_remarks_trgm_idx ON transactions USING GIN (remarks gin_trgm_ops);
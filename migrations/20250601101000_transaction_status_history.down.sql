@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS transactions_status_history ON transactions;
+DROP FUNCTION IF EXISTS transactions_record_status();
+DROP TABLE IF EXISTS transaction_status_history CASCADE;
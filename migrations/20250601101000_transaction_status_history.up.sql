@@ -0,0 +1,26 @@
+-- Every status a transaction went through, written by a trigger so no code path can skip it
+CREATE TABLE transaction_status_history (
+  id BIGSERIAL PRIMARY KEY,
+  transaction_id UUID NOT NULL REFERENCES transactions(id),
+  status VARCHAR(10) NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX transaction_status_history_transaction_id_idx ON transaction_status_history (transaction_id, id);
+
+CREATE FUNCTION transactions_record_status() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' OR NEW.status IS DISTINCT FROM OLD.status THEN
+    INSERT INTO transaction_status_history (transaction_id, status) VALUES (NEW.id, NEW.status);
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transactions_status_history
+  AFTER INSERT OR UPDATE OF status ON transactions
+  FOR EACH ROW EXECUTE FUNCTION transactions_record_status();
+
+-- Existing transactions only have their current status
+INSERT INTO transaction_status_history (transaction_id, status, created_at)
+SELECT id, status, COALESCE(updated_at, created_at) FROM transactions;
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS kyc_level;
+DROP TABLE IF EXISTS transaction_limits CASCADE;
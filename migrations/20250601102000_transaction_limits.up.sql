@@ -0,0 +1,18 @@
+-- Transaction limits per KYC level, NULL means no limit
+CREATE TABLE transaction_limits (
+  kyc_level VARCHAR(20) PRIMARY KEY,
+  max_balance NUMERIC(20,2),
+  max_transaction NUMERIC(20,2),
+  daily_outgoing NUMERIC(20,2),
+  monthly_outgoing NUMERIC(20,2),
+  hourly_transfers INT,
+  created_at TIMESTAMP DEFAULT NOW(),
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO transaction_limits (kyc_level, max_balance, max_transaction, daily_outgoing, monthly_outgoing, hourly_transfers) VALUES
+  ('BASIC', 2000000, 1000000, 2000000, 20000000, 10),
+  ('VERIFIED', 20000000, 10000000, 20000000, 40000000, 30);
+
+ALTER TABLE users
+  ADD COLUMN kyc_level VARCHAR(20) NOT NULL DEFAULT 'BASIC' REFERENCES transaction_limits(kyc_level);
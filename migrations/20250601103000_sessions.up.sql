@@ -0,0 +1,25 @@
+-- A session is one login. Its refresh tokens form a family: each refresh uses up the current
+-- token and issues the next one, presenting a used token again revokes the whole session.
+CREATE TABLE sessions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  revoked_reason VARCHAR(32)
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id) WHERE revoked_at IS NULL;
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
+
+CREATE TABLE refresh_tokens (
+  jti UUID PRIMARY KEY,
+  session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+  issued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  replaced_by UUID
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
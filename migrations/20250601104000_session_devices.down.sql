@@ -0,0 +1,3 @@
+ALTER TABLE sessions
+  DROP COLUMN IF EXISTS user_agent,
+  DROP COLUMN IF EXISTS ip_address;
@@ -0,0 +1,4 @@
+-- Device a session was last used from, shown to the user when listing their sessions
+ALTER TABLE sessions
+  ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+  ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS one_time_codes CASCADE;
+DROP TABLE IF EXISTS lockout_events CASCADE;
+DROP TABLE IF EXISTS login_throttles CASCADE;
@@ -0,0 +1,43 @@
+-- Failed login attempts per phone number and per client IP, shared by every API instance.
+-- An attempt is counted before the PIN is checked and forgiven when it succeeds, so parallel
+-- requests cannot get around the limits.
+CREATE TABLE login_throttles (
+  scope VARCHAR(10) NOT NULL CHECK (scope IN ('PHONE', 'IP')),
+  subject VARCHAR(64) NOT NULL,
+  failed_attempts INT NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMP,
+  locked_until TIMESTAMP,
+  PRIMARY KEY (scope, subject)
+);
+
+CREATE INDEX login_throttles_last_failed_at_idx ON login_throttles (last_failed_at);
+
+-- Every lockout, kept for auditing and closed when it is lifted with an unlock code
+CREATE TABLE lockout_events (
+  id BIGSERIAL PRIMARY KEY,
+  scope VARCHAR(10) NOT NULL,
+  subject VARCHAR(64) NOT NULL,
+  user_id UUID REFERENCES users(id),
+  failed_attempts INT NOT NULL,
+  ip_address VARCHAR(45) NOT NULL DEFAULT '',
+  user_agent VARCHAR(512) NOT NULL DEFAULT '',
+  locked_until TIMESTAMP NOT NULL,
+  unlocked_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX lockout_events_subject_idx ON lockout_events (scope, subject, created_at DESC);
+
+-- Short-lived codes sent to the user's phone, only their hash is stored
+CREATE TABLE one_time_codes (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id),
+  purpose VARCHAR(20) NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP NOT NULL,
+  consumed_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX one_time_codes_user_purpose_idx ON one_time_codes (user_id, purpose, created_at DESC);
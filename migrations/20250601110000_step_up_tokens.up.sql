@@ -0,0 +1,9 @@
+-- Step-up tokens that confirmed a payment or transfer, a token is only good for one
+CREATE TABLE used_step_up_tokens (
+  jti UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id),
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX used_step_up_tokens_expires_at_idx ON used_step_up_tokens (expires_at);
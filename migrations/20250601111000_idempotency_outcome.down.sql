@@ -0,0 +1,3 @@
+ALTER TABLE idempotency_keys
+  DROP COLUMN IF EXISTS transaction_id,
+  DROP COLUMN IF EXISTS reservation_id;
@@ -0,0 +1,5 @@
+-- reservation_id identifies the request holding a key, transaction_id is set in the same DB
+-- transaction that moves the money, so a key without it is known to have moved nothing
+ALTER TABLE idempotency_keys
+  ADD COLUMN reservation_id UUID,
+  ADD COLUMN transaction_id UUID;
@@ -6,6 +6,7 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redha28/foomlet/internal/models"
+	"github.com/redha28/foomlet/internal/repositories"
 	"github.com/redha28/foomlet/pkg"
 )
 
@@ -47,8 +48,8 @@ func SeedInitialData(ctx context.Context, db *pgxpool.Pool) error {
 
 	// Create wallet for User 1
 	wallet1ID := models.NewTransaction().ID
-	wallet1Query := `INSERT INTO wallets (id, user_id, balance) VALUES ($1, $2, $3::money)`
-	_, err = tx.Exec(ctx, wallet1Query, wallet1ID, user1ID, 0)
+	wallet1Query := `INSERT INTO wallets (id, user_id, balance) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(ctx, wallet1Query, wallet1ID, user1ID, pkg.Money(0))
 	if err != nil {
 		log.Printf("Error creating wallet for user 1: %v", err)
 		return err
@@ -69,8 +70,8 @@ func SeedInitialData(ctx context.Context, db *pgxpool.Pool) error {
 
 	// Create wallet for User 2
 	wallet2ID := models.NewTransaction().ID
-	wallet2Query := `INSERT INTO wallets (id, user_id, balance) VALUES ($1, $2, $3::money)`
-	_, err = tx.Exec(ctx, wallet2Query, wallet2ID, user2ID, 0)
+	wallet2Query := `INSERT INTO wallets (id, user_id, balance) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(ctx, wallet2Query, wallet2ID, user2ID, pkg.Money(0))
 	if err != nil {
 		log.Printf("Error creating wallet for user 2: %v", err)
 		return err
@@ -78,40 +79,49 @@ func SeedInitialData(ctx context.Context, db *pgxpool.Pool) error {
 	log.Printf("Created wallet for user 2: %s", wallet2ID)
 
 	// 3. User 1 Top-Up Transaction (500,000)
-	topupAmount := 500000.0
+	topupAmount := pkg.NewMoney(500000, 0)
 	topupTxID := models.NewTransaction().ID
 	topupQuery := `
 		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		VALUES ($1, $2, $3, $4, $5, $6)`
 
 	_, err = tx.Exec(ctx, topupQuery, topupTxID, wallet1ID, models.TransactionTypeTopUp,
-		topupAmount, 0, topupAmount)
+		topupAmount, pkg.Money(0), topupAmount)
 	if err != nil {
 		log.Printf("Error creating top-up transaction: %v", err)
 		return err
 	}
 
+	// Wallet ledger accounts are created by the wallets trigger
+	topupJournal := models.NewJournal(topupTxID, models.JournalKindTopUp, "Top-up").
+		Debit(models.LedgerAccountTopUpFunding, topupAmount).
+		Credit(wallet1ID, topupAmount)
+	if err = repositories.PostJournal(ctx, tx, topupJournal); err != nil {
+		log.Printf("Error posting top-up journal: %v", err)
+		return err
+	}
+
 	// Update User 1 wallet balance after top-up
-	updateWallet1Query := `UPDATE wallets SET balance = $1::money, updated_at = NOW() WHERE id = $2`
+	updateWallet1Query := `UPDATE wallets SET balance = $1, updated_at = NOW() WHERE id = $2`
 	_, err = tx.Exec(ctx, updateWallet1Query, topupAmount, wallet1ID)
 	if err != nil {
 		log.Printf("Error updating wallet 1 balance: %v", err)
 		return err
 	}
-	log.Printf("Created top-up transaction: %s (Amount: %.2f)", topupTxID, topupAmount)
+	log.Printf("Created top-up transaction: %s (Amount: %s)", topupTxID, topupAmount)
 
 	// 4. User 1 Payment Transaction (50,000)
-	paymentAmount := 50000.0
+	paymentAmount := pkg.NewMoney(50000, 0)
 	balanceAfterTopup := topupAmount
 	balanceAfterPayment := balanceAfterTopup - paymentAmount
 
 	paymentTxID := models.NewTransaction().ID
 	paymentQuery := `
-		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	_, err = tx.Exec(ctx, paymentQuery, paymentTxID, wallet1ID, models.TransactionTypePayment,
-		paymentAmount, balanceAfterTopup, balanceAfterPayment)
+		paymentAmount, balanceAfterTopup, balanceAfterPayment, "Bayar listrik bulanan")
 	if err != nil {
 		log.Printf("Error creating payment transaction: %v", err)
 		return err
@@ -122,51 +132,48 @@ func SeedInitialData(ctx context.Context, db *pgxpool.Pool) error {
 		INSERT INTO payments (transaction_id, user_id, amount, remarks)
 		VALUES ($1, $2, $3, $4)`
 
-	_, err = tx.Exec(ctx, paymentRecordQuery, paymentTxID, user1ID, int(paymentAmount), "Bayar listrik bulanan")
+	_, err = tx.Exec(ctx, paymentRecordQuery, paymentTxID, user1ID, paymentAmount, "Bayar listrik bulanan")
 	if err != nil {
 		log.Printf("Error creating payment record: %v", err)
 		return err
 	}
 
+	paymentJournal := models.NewJournal(paymentTxID, models.JournalKindPayment, "Bayar listrik bulanan").
+		Debit(wallet1ID, paymentAmount).
+		Credit(models.LedgerAccountMerchantSettlement, paymentAmount)
+	if err = repositories.PostJournal(ctx, tx, paymentJournal); err != nil {
+		log.Printf("Error posting payment journal: %v", err)
+		return err
+	}
+
 	// Update User 1 wallet balance after payment
-	updateWallet1AfterPaymentQuery := `UPDATE wallets SET balance = $1::money, updated_at = NOW() WHERE id = $2`
+	updateWallet1AfterPaymentQuery := `UPDATE wallets SET balance = $1, updated_at = NOW() WHERE id = $2`
 	_, err = tx.Exec(ctx, updateWallet1AfterPaymentQuery, balanceAfterPayment, wallet1ID)
 	if err != nil {
 		log.Printf("Error updating wallet 1 balance after payment: %v", err)
 		return err
 	}
-	log.Printf("Created payment transaction: %s (Amount: %.2f)", paymentTxID, paymentAmount)
+	log.Printf("Created payment transaction: %s (Amount: %s)", paymentTxID, paymentAmount)
 
 	// 5. User 1 Transfer to User 2 (100,000)
-	transferAmount := 100000.0
+	transferAmount := pkg.NewMoney(100000, 0)
 	balanceBeforeTransfer := balanceAfterPayment
 	balanceAfterTransfer := balanceBeforeTransfer - transferAmount
 
 	transferTxID := models.NewTransaction().ID
 	transferQuery := `
-		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	_, err = tx.Exec(ctx, transferQuery, transferTxID, wallet1ID, models.TransactionTypeTransfer,
-		transferAmount, balanceBeforeTransfer, balanceAfterTransfer)
+		transferAmount, balanceBeforeTransfer, balanceAfterTransfer, "Hadiah Ultah")
 	if err != nil {
 		log.Printf("Error creating transfer transaction: %v", err)
 		return err
 	}
 
-	// Create transfer record
-	transferRecordQuery := `
-		INSERT INTO transfer (transaction_id, target_user, sender_user, remarks)
-		VALUES ($1, $2, $3, $4)`
-
-	_, err = tx.Exec(ctx, transferRecordQuery, transferTxID, user2ID, user1ID, "Hadiah Ultah")
-	if err != nil {
-		log.Printf("Error creating transfer record: %v", err)
-		return err
-	}
-
 	// Update User 1 wallet balance after transfer (deduct)
-	updateWallet1AfterTransferQuery := `UPDATE wallets SET balance = $1::money, updated_at = NOW() WHERE id = $2`
+	updateWallet1AfterTransferQuery := `UPDATE wallets SET balance = $1, updated_at = NOW() WHERE id = $2`
 	_, err = tx.Exec(ctx, updateWallet1AfterTransferQuery, balanceAfterTransfer, wallet1ID)
 	if err != nil {
 		log.Printf("Error updating wallet 1 balance after transfer: %v", err)
@@ -176,25 +183,44 @@ func SeedInitialData(ctx context.Context, db *pgxpool.Pool) error {
 	// Create recipient transaction for User 2
 	recipientTxID := models.NewTransaction().ID
 	recipientTxQuery := `
-		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after)
-		VALUES ($1, $2, $3, $4::money, $5::money, $6::money)`
+		INSERT INTO transactions (id, wallet_id, transaction_type_id, amount, balance_before, balance_after, remarks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	_, err = tx.Exec(ctx, recipientTxQuery, recipientTxID, wallet2ID, models.TransactionTypeTransfer,
-		transferAmount, 0, transferAmount)
+		transferAmount, pkg.Money(0), transferAmount, "Hadiah Ultah")
 	if err != nil {
 		log.Printf("Error creating recipient transaction: %v", err)
 		return err
 	}
 
+	// Create transfer record linked to both legs
+	transferRecordQuery := `
+		INSERT INTO transfer (transaction_id, target_user, sender_user, remarks, credit_transaction_id)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.Exec(ctx, transferRecordQuery, transferTxID, user2ID, user1ID, "Hadiah Ultah", recipientTxID)
+	if err != nil {
+		log.Printf("Error creating transfer record: %v", err)
+		return err
+	}
+
+	transferJournal := models.NewJournal(transferTxID, models.JournalKindTransfer, "Hadiah Ultah").
+		Debit(wallet1ID, transferAmount).
+		Credit(wallet2ID, transferAmount)
+	if err = repositories.PostJournal(ctx, tx, transferJournal); err != nil {
+		log.Printf("Error posting transfer journal: %v", err)
+		return err
+	}
+
 	// Update User 2 wallet balance after receiving transfer
-	updateWallet2Query := `UPDATE wallets SET balance = $1::money, updated_at = NOW() WHERE id = $2`
+	updateWallet2Query := `UPDATE wallets SET balance = $1, updated_at = NOW() WHERE id = $2`
 	_, err = tx.Exec(ctx, updateWallet2Query, transferAmount, wallet2ID)
 	if err != nil {
 		log.Printf("Error updating wallet 2 balance: %v", err)
 		return err
 	}
 
-	log.Printf("Created transfer transaction: %s (Amount: %.2f)", transferTxID, transferAmount)
+	log.Printf("Created transfer transaction: %s (Amount: %s)", transferTxID, transferAmount)
 
 	// Commit all changes
 	if err = tx.Commit(ctx); err != nil {
@@ -203,8 +229,8 @@ func SeedInitialData(ctx context.Context, db *pgxpool.Pool) error {
 	}
 
 	log.Println("Initial data seeding completed successfully!")
-	log.Printf("User 1 ID: %s (08123456789) final balance: %.2f", user1ID, balanceAfterTransfer)
-	log.Printf("User 2 ID: %s (08987654321) final balance: %.2f", user2ID, transferAmount)
+	log.Printf("User 1 ID: %s (08123456789) final balance: %s", user1ID, balanceAfterTransfer)
+	log.Printf("User 2 ID: %s (08987654321) final balance: %s", user2ID, transferAmount)
 	log.Println("PIN for both users: 123456")
 
 	return nil
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetter is a transfer message parked in the dead-letter queue
+type DeadLetter struct {
+	MessageID      string           `json:"message_id"`
+	Transfer       *TransferMessage `json:"transfer,omitempty"`
+	Body           string           `json:"body,omitempty"`
+	Reason         string           `json:"reason"`
+	RetryCount     int              `json:"retry_count"`
+	DeadLetteredAt string           `json:"dead_lettered_at,omitempty"`
+}
+
+// TransferID returns the ID of the dead-lettered transfer, or the message ID for malformed messages
+func (d DeadLetter) TransferID() string {
+	if d.Transfer != nil {
+		return d.Transfer.TransferID
+	}
+	return d.MessageID
+}
+
+// DeadLetterAction tells drainDeadLetters what to do with a message
+type DeadLetterAction int
+
+const (
+	// DeadLetterKeep leaves the message in the dead-letter queue
+	DeadLetterKeep DeadLetterAction = iota
+	// DeadLetterRemove acknowledges the message so it leaves the dead-letter queue
+	DeadLetterRemove
+)
+
+// ListDeadLetters returns every message in the dead-letter queue without removing any
+func (r *RabbitMQ) ListDeadLetters() ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := r.DrainDeadLetters(func(letter DeadLetter) (DeadLetterAction, error) {
+		letters = append(letters, letter)
+		return DeadLetterKeep, nil
+	})
+	return letters, err
+}
+
+// DrainDeadLetters fetches every message of the dead-letter queue and lets fn decide whether it
+// is removed. All messages are fetched before any is requeued, so each is visited exactly once.
+// If fn returns an error the remaining messages are kept.
+func (r *RabbitMQ) DrainDeadLetters(fn func(DeadLetter) (DeadLetterAction, error)) error {
+	if !r.IsReady() {
+		return ErrRabbitMQNotReady
+	}
+
+	r.mu.RLock()
+	channel := r.channel
+	r.mu.RUnlock()
+
+	var deliveries []amqp.Delivery
+	for {
+		d, ok, err := channel.Get(TransferDeadLetterQueue, false)
+		if err != nil {
+			requeueAll(deliveries)
+			return err
+		}
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	var fnErr error
+	for _, d := range deliveries {
+		action := DeadLetterKeep
+		if fnErr == nil {
+			action, fnErr = fn(newDeadLetter(d))
+		}
+
+		if action == DeadLetterRemove && fnErr == nil {
+			d.Ack(false)
+		} else {
+			d.Nack(false, true)
+		}
+	}
+
+	return fnErr
+}
+
+func requeueAll(deliveries []amqp.Delivery) {
+	for _, d := range deliveries {
+		d.Nack(false, true)
+	}
+}
+
+func newDeadLetter(d amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID:  d.MessageId,
+		RetryCount: RetryCount(d),
+	}
+
+	var transfer TransferMessage
+	if err := json.Unmarshal(d.Body, &transfer); err == nil && transfer.TransferID != "" {
+		letter.Transfer = &transfer
+	} else {
+		letter.Body = string(d.Body)
+	}
+
+	if reason, ok := d.Headers[HeaderFailureReason].(string); ok {
+		letter.Reason = reason
+	} else if reason, ok := d.Headers["x-first-death-reason"].(string); ok {
+		// Dead-lettered by the broker itself, e.g. over the delivery limit
+		letter.Reason = "broker: " + reason
+	}
+
+	if at, ok := d.Headers[HeaderDeadLettered].(string); ok {
+		letter.DeadLetteredAt = at
+	}
+
+	return letter
+}
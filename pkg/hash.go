@@ -1,11 +1,16 @@
 package pkg
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/argon2"
 )
@@ -16,6 +21,22 @@ type HashConfig struct {
 	KeyLen  uint32
 	SaltLen uint32
 	Threads uint8
+	// Pepper is an optional server-side secret mixed into every new hash, hashes record the
+	// PepperID they were made with so older ones keep working
+	Pepper   []byte
+	PepperID uint32
+	// PreviousPeppers keeps verifying hashes made before the pepper was rotated, by pepper ID
+	PreviousPeppers map[uint32][]byte
+}
+
+// hashParams are the argon2 parameters a stored hash was made with, PepperID is 0 for hashes
+// made without a pepper
+type hashParams struct {
+	Time     uint32
+	Memory   uint32
+	KeyLen   uint32
+	Threads  uint8
+	PepperID uint32
 }
 
 func InitHashConfig() *HashConfig {
@@ -38,6 +59,32 @@ func (h *HashConfig) UseDefaultConfig() {
 	h.SaltLen = 16
 }
 
+// UsePepper sets the server-side secret and the ID recorded in new hashes, an empty pepper
+// disables it
+func (h *HashConfig) UsePepper(id uint32, pepper string) {
+	h.Pepper, h.PepperID = nil, 0
+	if pepper != "" {
+		h.Pepper, h.PepperID = []byte(pepper), id
+	}
+}
+
+// AddPreviousPepper keeps hashes made with a retired pepper verifying until they are rehashed
+func (h *HashConfig) AddPreviousPepper(id uint32, pepper string) {
+	if h.PreviousPeppers == nil {
+		h.PreviousPeppers = map[uint32][]byte{}
+	}
+	h.PreviousPeppers[id] = []byte(pepper)
+}
+
+// pepper returns the secret a hash with the given pepper ID was made with
+func (h *HashConfig) pepper(id uint32) ([]byte, bool) {
+	if len(h.Pepper) > 0 && id == h.PepperID {
+		return h.Pepper, true
+	}
+	pepper, ok := h.PreviousPeppers[id]
+	return pepper, ok
+}
+
 func (h *HashConfig) genSalt() ([]byte, error) {
 	salt := make([]byte, h.SaltLen)
 	if _, err := rand.Read(salt); err != nil {
@@ -51,53 +98,208 @@ func (h *HashConfig) GenHashedPassword(password string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	hash := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
-	// $jenisKey$versiKey$konfigurasi(memory, time, thread)$salt$hash
+	hash := argon2.IDKey(input(password, h.Pepper), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	// $jenisKey$versiKey$konfigurasi(memory, time, thread[, pepper id])$salt$hash
 	version := argon2.Version
 	bash64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	base64Hash := base64.RawStdEncoding.EncodeToString(hash)
-	hashedPwd := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", version, h.Memory, h.Time, h.Threads, bash64Salt, base64Hash)
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.Memory, h.Time, h.Threads)
+	if len(h.Pepper) > 0 {
+		params += fmt.Sprintf(",k=%d", h.PepperID)
+	}
+	hashedPwd := fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", version, params, bash64Salt, base64Hash)
 	return hashedPwd, nil
 }
 
+// CompareHashAndPassword checks password against a stored hash using the parameters recorded
+// in the hash, so hashes made with older parameters still verify
 func (h *HashConfig) CompareHashAndPassword(hadhedPass string, password string) (bool, error) {
-	salt, hash, err := h.decodeHash(hadhedPass)
+	params, salt, hash, err := decodeHash(hadhedPass)
 	if err != nil {
 		return false, err
 	}
-	newHash := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	var pepper []byte
+	if params.PepperID != 0 {
+		var ok bool
+		if pepper, ok = h.pepper(params.PepperID); !ok {
+			return false, fmt.Errorf("hash needs pepper %d but it is not configured", params.PepperID)
+		}
+	}
+	newHash := argon2.IDKey(input(password, pepper), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
 	if subtle.ConstantTimeCompare(hash, newHash) == 0 {
-		return false, err
+		return false, nil
 	}
 	return true, nil
 }
 
-func (h *HashConfig) decodeHash(hashedPass string) (salt []byte, hash []byte, err error) {
-	// $jenisKey$versiKey$konfigurasi(memory, time, thread)$salt$hash
+// NeedsRehash reports whether a stored hash was made with other parameters or another pepper
+// than the current ones, an unreadable hash always needs one
+func (h *HashConfig) NeedsRehash(hashedPass string) bool {
+	params, salt, _, err := decodeHash(hashedPass)
+	if err != nil {
+		return true
+	}
+	return params.Time != h.Time ||
+		params.Memory != h.Memory ||
+		params.Threads != h.Threads ||
+		params.KeyLen != h.KeyLen ||
+		uint32(len(salt)) != h.SaltLen ||
+		params.PepperID != h.PepperID
+}
+
+// input is what argon2 hashes: the password itself, or its HMAC keyed with the pepper
+func input(password string, pepper []byte) []byte {
+	if len(pepper) == 0 {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+func decodeHash(hashedPass string) (params hashParams, salt []byte, hash []byte, err error) {
+	// $jenisKey$versiKey$konfigurasi(memory, time, thread[, pepper id])$salt$hash
 	values := strings.Split(hashedPass, "$")
 	if len(values) != 6 {
-		return nil, nil, fmt.Errorf("invalid length format")
+		return params, nil, nil, fmt.Errorf("invalid length format")
 	}
 	if values[1] != "argon2id" {
-		return nil, nil, fmt.Errorf("invalid hash type")
+		return params, nil, nil, fmt.Errorf("invalid hash type")
 	}
 	var version int
 	if _, err := fmt.Sscanf(values[2], "v=%d", &version); err != nil {
-		return nil, nil, err
+		return params, nil, nil, err
 	}
 	if version != argon2.Version {
-		return nil, nil, fmt.Errorf("invalid hash version")
+		return params, nil, nil, fmt.Errorf("invalid hash version")
 	}
-	if _, err := fmt.Sscanf(values[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Time, &h.Threads); err != nil {
-		return nil, nil, err
+	if params, err = decodeParams(values[3]); err != nil {
+		return params, nil, nil, err
 	}
 	salt, err = base64.RawStdEncoding.DecodeString(values[4])
 	if err != nil {
-		return nil, nil, err
+		return params, nil, nil, err
 	}
 	hash, err = base64.RawStdEncoding.DecodeString(values[5])
 	if err != nil {
-		return nil, nil, err
+		return params, nil, nil, err
+	}
+	if len(hash) == 0 {
+		return params, nil, nil, fmt.Errorf("empty hash")
+	}
+	params.KeyLen = uint32(len(hash))
+	return params, salt, hash, nil
+}
+
+// decodeParams reads "m=..,t=..,p=..", followed by "k=<pepper id>" for peppered hashes
+func decodeParams(value string) (hashParams, error) {
+	var params hashParams
+	seen := map[string]bool{}
+	for _, field := range strings.Split(value, ",") {
+		key, raw, ok := strings.Cut(field, "=")
+		if !ok || seen[key] {
+			return params, fmt.Errorf("invalid hash parameters")
+		}
+		seen[key] = true
+
+		switch key {
+		case "m", "t", "p":
+			bits := 32
+			if key == "p" {
+				bits = 8
+			}
+			number, err := strconv.ParseUint(raw, 10, bits)
+			if err != nil || number == 0 {
+				return params, fmt.Errorf("invalid hash parameter %s", key)
+			}
+			switch key {
+			case "m":
+				params.Memory = uint32(number)
+			case "t":
+				params.Time = uint32(number)
+			case "p":
+				params.Threads = uint8(number)
+			}
+		case "k":
+			id, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || id == 0 {
+				return params, fmt.Errorf("invalid hash parameter k")
+			}
+			params.PepperID = uint32(id)
+		default:
+			return params, fmt.Errorf("unknown hash parameter %s", key)
+		}
 	}
-	return salt, hash, nil
+	if !seen["m"] || !seen["t"] || !seen["p"] {
+		return params, fmt.Errorf("missing hash parameters")
+	}
+	return params, nil
+}
+
+// Hasher runs argon2 on at most a fixed number of goroutines at once. Every call holds Memory
+// KiB while it runs, so a flood of logins waits for a slot instead of exhausting memory.
+type Hasher struct {
+	config *HashConfig
+	slots  chan struct{}
+
+	dummyOnce sync.Once
+	dummy     string
+	dummyErr  error
+}
+
+func NewHasher(config *HashConfig, workers int) *Hasher {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Hasher{config: config, slots: make(chan struct{}, workers)}
+}
+
+// Hash hashes password with the current parameters once a slot is free
+func (h *Hasher) Hash(ctx context.Context, password string) (string, error) {
+	if err := h.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer h.release()
+	return h.config.GenHashedPassword(password)
+}
+
+// Compare checks password against a stored hash once a slot is free
+func (h *Hasher) Compare(ctx context.Context, hashedPass, password string) (bool, error) {
+	if err := h.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer h.release()
+	return h.config.CompareHashAndPassword(hashedPass, password)
+}
+
+// CompareDummy checks password against a fixed hash made with the current parameters, so a
+// login for an unknown account costs as much as one with a wrong PIN
+func (h *Hasher) CompareDummy(ctx context.Context, password string) error {
+	h.dummyOnce.Do(func() {
+		h.dummy, h.dummyErr = h.config.GenHashedPassword("dummy-pin")
+	})
+	if h.dummyErr != nil {
+		return h.dummyErr
+	}
+	_, err := h.Compare(ctx, h.dummy, password)
+	return err
+}
+
+// NeedsRehash reports whether a stored hash should be replaced with one made with the current parameters
+func (h *Hasher) NeedsRehash(hashedPass string) bool {
+	return h.config.NeedsRehash(hashedPass)
+}
+
+// acquire waits for a free slot, giving up when the request is cancelled
+func (h *Hasher) acquire(ctx context.Context) error {
+	select {
+	case h.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hasher) release() {
+	<-h.slots
 }
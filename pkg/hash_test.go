@@ -0,0 +1,150 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+// testHashConfig uses tiny argon2 parameters so the tests stay fast, the pepper gets ID 1
+func testHashConfig(pepper string) *HashConfig {
+	return testHashConfigWithID(1, pepper)
+}
+
+func testHashConfigWithID(id uint32, pepper string) *HashConfig {
+	config := InitHashConfig()
+	config.UseConfig(1, 64, 16, 8, 1)
+	config.UsePepper(id, pepper)
+	return config
+}
+
+// rotatedHashConfig uses pepper "new" with ID 2 and still knows pepper "old" with ID 1
+func rotatedHashConfig() *HashConfig {
+	config := testHashConfigWithID(2, "new")
+	config.AddPreviousPepper(1, "old")
+	return config
+}
+
+func mustHash(t *testing.T, config *HashConfig, password string) string {
+	t.Helper()
+	hashed, err := config.GenHashedPassword(password)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	return hashed
+}
+
+func TestCompareHashAndPassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		hashedBy  *HashConfig
+		checkedBy *HashConfig
+		password  string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "plain match", hashedBy: testHashConfig(""), checkedBy: testHashConfig(""), password: "123456", want: true},
+		{name: "plain mismatch", hashedBy: testHashConfig(""), checkedBy: testHashConfig(""), password: "654321"},
+		{name: "peppered match", hashedBy: testHashConfig("pepper"), checkedBy: testHashConfig("pepper"), password: "123456", want: true},
+		{name: "peppered mismatch", hashedBy: testHashConfig("pepper"), checkedBy: testHashConfig("pepper"), password: "654321"},
+		{name: "plain hash after adding a pepper", hashedBy: testHashConfig(""), checkedBy: testHashConfig("pepper"), password: "123456", want: true},
+		{name: "peppered hash with another pepper", hashedBy: testHashConfig("pepper"), checkedBy: testHashConfig("other"), password: "123456"},
+		{name: "peppered hash without a pepper", hashedBy: testHashConfig("pepper"), checkedBy: testHashConfig(""), password: "123456", wantErr: true},
+		{name: "previous pepper after rotation", hashedBy: testHashConfig("old"), checkedBy: rotatedHashConfig(), password: "123456", want: true},
+		{name: "previous pepper mismatch", hashedBy: testHashConfig("old"), checkedBy: rotatedHashConfig(), password: "654321"},
+		{name: "current pepper after rotation", hashedBy: rotatedHashConfig(), checkedBy: rotatedHashConfig(), password: "123456", want: true},
+		{name: "unknown pepper ID", hashedBy: testHashConfigWithID(3, "other"), checkedBy: rotatedHashConfig(), password: "123456", wantErr: true},
+		{name: "retired pepper that was dropped", hashedBy: testHashConfig("old"), checkedBy: testHashConfigWithID(2, "new"), password: "123456", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed := mustHash(t, tt.hashedBy, "123456")
+			got, err := tt.checkedBy.CompareHashAndPassword(hashed, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compare error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("compare = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashRecordsPepper(t *testing.T) {
+	if hashed := mustHash(t, testHashConfig(""), "123456"); strings.Contains(hashed, "k=") {
+		t.Errorf("plain hash %q records a pepper", hashed)
+	}
+	if hashed := mustHash(t, testHashConfig("pepper"), "123456"); !strings.Contains(hashed, ",k=1$") {
+		t.Errorf("peppered hash %q does not record its pepper", hashed)
+	}
+	if hashed := mustHash(t, rotatedHashConfig(), "123456"); !strings.Contains(hashed, ",k=2$") {
+		t.Errorf("hash %q does not record the current pepper ID", hashed)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current := testHashConfig("pepper")
+
+	otherTime := testHashConfig("pepper")
+	otherTime.Time = 2
+	moreMemory := testHashConfig("pepper")
+	moreMemory.Memory = 128
+	longerKey := testHashConfig("pepper")
+	longerKey.KeyLen = 32
+	longerSalt := testHashConfig("pepper")
+	longerSalt.SaltLen = 16
+
+	tests := []struct {
+		name   string
+		hashed string
+		want   bool
+	}{
+		{name: "current parameters", hashed: mustHash(t, current, "123456"), want: false},
+		{name: "same parameters with another pepper", hashed: mustHash(t, testHashConfig("other"), "123456"), want: false},
+		{name: "other time cost", hashed: mustHash(t, otherTime, "123456"), want: true},
+		{name: "other memory cost", hashed: mustHash(t, moreMemory, "123456"), want: true},
+		{name: "other key length", hashed: mustHash(t, longerKey, "123456"), want: true},
+		{name: "other salt length", hashed: mustHash(t, longerSalt, "123456"), want: true},
+		{name: "made without a pepper", hashed: mustHash(t, testHashConfig(""), "123456"), want: true},
+		{name: "made with a previous pepper", hashed: mustHash(t, testHashConfigWithID(2, "old"), "123456"), want: true},
+		{name: "unreadable", hashed: "not-a-hash", want: true},
+		{name: "unknown parameter", hashed: "$argon2id$v=19$m=64,t=1,p=1,x=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := current.NeedsRehash(tt.hashed); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.hashed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    hashParams
+		wantErr bool
+	}{
+		{value: "m=65536,t=3,p=2", want: hashParams{Memory: 65536, Time: 3, Threads: 2}},
+		{value: "m=65536,t=3,p=2,k=1", want: hashParams{Memory: 65536, Time: 3, Threads: 2, PepperID: 1}},
+		{value: "m=65536,t=3,p=2,k=7", want: hashParams{Memory: 65536, Time: 3, Threads: 2, PepperID: 7}},
+		{value: "m=65536,t=3", wantErr: true},
+		{value: "m=65536,t=3,p=2,k=0", wantErr: true},
+		{value: "m=65536,t=3,p=2,k=x", wantErr: true},
+		{value: "m=65536,t=3,p=2,m=1", wantErr: true},
+		{value: "m=0,t=3,p=2", wantErr: true},
+		{value: "m=65536,t=3,p=256", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeParams(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("decodeParams(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("decodeParams(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	activeKeyID  = "2025-active"
+	retiredKeyID = "2024-retired"
+)
+
+// writeKey stores key in dir as kid.pem, private keys as PKCS#8 and public keys as PKIX
+func writeKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+
+	var block *pem.Block
+	switch key.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal private key: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("marshal public key: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+}
+
+func generateRSAKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	return key
+}
+
+func generateEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	return key
+}
+
+// rotatedKeys sets up a rotation from an RS256 key to an EdDSA key: the returned directory holds
+// the new private key and only the public part of the retired one
+func rotatedKeys(t *testing.T) (dir string, retired *rsa.PrivateKey, active ed25519.PrivateKey) {
+	t.Helper()
+	retired, active = generateRSAKey(t, minRSAKeyBits), generateEd25519Key(t)
+
+	dir = t.TempDir()
+	writeKey(t, dir, activeKeyID, active)
+	writeKey(t, dir, retiredKeyID, &retired.PublicKey)
+	return dir, retired, active
+}
+
+func TestLoadKeySetVerifiesRetiredKeys(t *testing.T) {
+	dir, retired, _ := rotatedKeys(t)
+
+	// A token issued before the rotation, signed with the retired key
+	oldDir := t.TempDir()
+	writeKey(t, oldDir, retiredKeyID, retired)
+	oldKeys, err := LoadKeySet(oldDir, retiredKeyID, JwtAlgorithmRS256)
+	if err != nil {
+		t.Fatalf("load keys before the rotation: %v", err)
+	}
+	oldToken, err := NewJwtUtil("", "refresh-secret", time.Minute, time.Hour).UseKeys(oldKeys).GenerateAccessToken("user", "session")
+	if err != nil {
+		t.Fatalf("token before the rotation: %v", err)
+	}
+
+	keys, err := LoadKeySet(dir, activeKeyID, JwtAlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	util := NewJwtUtil("", "refresh-secret", time.Minute, time.Hour).UseKeys(keys)
+
+	claims, err := util.ValidateAccessToken(oldToken)
+	if err != nil {
+		t.Fatalf("token signed with the retired key: %v", err)
+	}
+	if claims.UserID != "user" {
+		t.Errorf("user = %q, want %q", claims.UserID, "user")
+	}
+
+	// New tokens are signed with the active key
+	newToken, err := util.GenerateAccessToken("user", "session")
+	if err != nil {
+		t.Fatalf("token after the rotation: %v", err)
+	}
+	parsed, err := util.ValidateAccessToken(newToken)
+	if err != nil {
+		t.Fatalf("token signed with the active key: %v", err)
+	}
+	if parsed.UserID != "user" {
+		t.Errorf("user = %q, want %q", parsed.UserID, "user")
+	}
+	header, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("parse header: %v", err)
+	}
+	if kid := header.Header["kid"]; kid != activeKeyID {
+		t.Errorf("new token kid = %v, want %s", kid, activeKeyID)
+	}
+}
+
+func TestLoadKeySetRefusesUnusableSigningKeys(t *testing.T) {
+	dir, _, _ := rotatedKeys(t)
+
+	tests := []struct {
+		name      string
+		kid       string
+		algorithm string
+	}{
+		{name: "missing key", kid: "missing", algorithm: JwtAlgorithmEdDSA},
+		{name: "public key only", kid: retiredKeyID, algorithm: JwtAlgorithmRS256},
+		{name: "other algorithm", kid: activeKeyID, algorithm: JwtAlgorithmRS256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeySet(dir, tt.kid, tt.algorithm); err == nil {
+				t.Errorf("LoadKeySet(%s, %s) succeeded, want an error", tt.kid, tt.algorithm)
+			}
+		})
+	}
+}
+
+func TestLoadKeySetRefusesShortRSAKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, activeKeyID, generateEd25519Key(t))
+	writeKey(t, dir, "weak", &generateRSAKey(t, 1024).PublicKey)
+
+	if _, err := LoadKeySet(dir, activeKeyID, JwtAlgorithmEdDSA); err == nil {
+		t.Error("key set with a 1024 bit RSA key was loaded")
+	}
+}
+
+func TestVerificationKeyRejectsUnknownAndMismatchedKeys(t *testing.T) {
+	dir, _, active := rotatedKeys(t)
+	keys, err := LoadKeySet(dir, activeKeyID, JwtAlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, jwt.RegisteredClaims{Subject: "user"})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "active key", token: sign(jwt.SigningMethodEdDSA, activeKeyID, active), valid: true},
+		{name: "unknown kid", token: sign(jwt.SigningMethodEdDSA, "unknown", generateEd25519Key(t))},
+		{name: "no kid", token: sign(jwt.SigningMethodEdDSA, "", active)},
+		{name: "EdDSA token naming the RSA key", token: sign(jwt.SigningMethodEdDSA, retiredKeyID, active)},
+		{name: "HS256 token naming the active key", token: sign(jwt.SigningMethodHS256, activeKeyID, []byte("secret"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, keys.VerificationKey)
+			if (err == nil) != tt.valid {
+				t.Errorf("parse error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestJWKSEncodesPublicKeys(t *testing.T) {
+	dir, retired, active := rotatedKeys(t)
+	keys, err := LoadKeySet(dir, activeKeyID, JwtAlgorithmEdDSA)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks.Keys))
+	}
+
+	// Ordered by kid
+	want := []JWK{
+		{
+			Kty: "RSA",
+			Kid: retiredKeyID,
+			Use: "sig",
+			Alg: JwtAlgorithmRS256,
+			N:   base64.RawURLEncoding.EncodeToString(retired.N.Bytes()),
+			E:   "AQAB",
+		},
+		{
+			Kty: "OKP",
+			Kid: activeKeyID,
+			Use: "sig",
+			Alg: JwtAlgorithmEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(active.Public().(ed25519.PublicKey)),
+		},
+	}
+	for i := range want {
+		if jwks.Keys[i] != want[i] {
+			t.Errorf("key %d = %+v, want %+v", i, jwks.Keys[i], want[i])
+		}
+	}
+}
+
+func TestJWKSOfNilKeySet(t *testing.T) {
+	var keys *KeySet
+	if jwks := keys.JWKS(); jwks.Keys == nil || len(jwks.Keys) != 0 {
+		t.Errorf("JWKS of a nil set = %+v, want an empty key list", jwks)
+	}
+}
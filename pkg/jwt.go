@@ -8,15 +8,29 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// StepUpAudience marks the tokens that confirm a transaction, they are not access tokens
+const StepUpAudience = "step-up"
+
 type JwtUtil struct {
 	AccessTokenSecret  string
 	RefreshTokenSecret string
 	AccessExpiry       time.Duration
 	RefreshExpiry      time.Duration
+	// Keys signs access and step-up tokens when set, otherwise they use HS256 with AccessTokenSecret.
+	// Refresh tokens are only ever read by this service and always use RefreshTokenSecret.
+	Keys *KeySet
+	// LegacyHS256Until keeps HS256 tokens signed with AccessTokenSecret valid after switching to
+	// Keys, until the tokens issued before the switch have expired
+	LegacyHS256Until time.Time
 }
 
+// JwtClaim carries the session of the token in sid, refresh tokens are identified by the jti claim.
+// Step-up tokens also carry the amount and recipient of the payment or transfer they confirm.
 type JwtClaim struct {
-	UserID string `json:"user_id"`
+	UserID      string `json:"user_id"`
+	SessionID   string `json:"sid"`
+	Amount      Money  `json:"amount,omitempty"`
+	RecipientID string `json:"recipient_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -29,25 +43,64 @@ func NewJwtUtil(accessSecret, refreshSecret string, accessExpiry, refreshExpiry
 	}
 }
 
-// GenerateAccessToken creates a new access token for the given user ID
-func (j *JwtUtil) GenerateAccessToken(userID string) (string, error) {
+// UseKeys switches access and step-up tokens to the asymmetric keys of the set
+func (j *JwtUtil) UseKeys(keys *KeySet) *JwtUtil {
+	j.Keys = keys
+	return j
+}
+
+// AcceptHS256Until keeps verifying HS256 tokens with the access secret until t while Keys sign
+// new ones
+func (j *JwtUtil) AcceptHS256Until(t time.Time) *JwtUtil {
+	j.LegacyHS256Until = t
+	return j
+}
+
+// signAccess signs access and step-up tokens
+func (j *JwtUtil) signAccess(claims *JwtClaim) (string, error) {
+	if j.Keys != nil {
+		return j.Keys.Sign(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(j.AccessTokenSecret))
+}
+
+// accessKey returns the key verifying access and step-up tokens
+func (j *JwtUtil) accessKey(token *jwt.Token) (any, error) {
+	if j.Keys != nil {
+		if token.Method == jwt.SigningMethodHS256 && time.Now().Before(j.LegacyHS256Until) {
+			return []byte(j.AccessTokenSecret), nil
+		}
+		return j.Keys.VerificationKey(token)
+	}
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return []byte(j.AccessTokenSecret), nil
+}
+
+// GenerateAccessToken creates a new access token for the given user ID and session
+func (j *JwtUtil) GenerateAccessToken(userID, sessionID string) (string, error) {
 	claims := &JwtClaim{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.AccessExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.AccessTokenSecret))
+	return j.signAccess(claims)
 }
 
-// GenerateRefreshToken creates a new refresh token for the given user ID
-func (j *JwtUtil) GenerateRefreshToken(userID string) (string, error) {
+// GenerateRefreshToken creates a new refresh token for the given user ID and session, jti
+// identifies this token in the session's refresh token family
+func (j *JwtUtil) GenerateRefreshToken(userID, sessionID, jti string) (string, error) {
 	claims := &JwtClaim{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.RefreshExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -59,24 +112,58 @@ func (j *JwtUtil) GenerateRefreshToken(userID string) (string, error) {
 
 // ValidateAccessToken validates the access token and returns the claims
 func (j *JwtUtil) ValidateAccessToken(tokenString string) (*JwtClaim, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JwtClaim{}, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.AccessTokenSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JwtClaim{}, j.accessKey)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*JwtClaim); ok && token.Valid {
+		// Step-up tokens are signed with the same secret but must not open the API
+		if len(claims.Audience) > 0 {
+			return nil, errors.New("not an access token")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
 
+// GenerateStepUpToken creates a token confirming the PIN of the user in the given session for a
+// payment of amount, or a transfer of amount to recipientID. jti identifies it so it can only be
+// spent once.
+func (j *JwtUtil) GenerateStepUpToken(userID, sessionID, jti string, amount Money, recipientID string, expiry time.Duration) (string, error) {
+	claims := &JwtClaim{
+		UserID:      userID,
+		SessionID:   sessionID,
+		Amount:      amount,
+		RecipientID: recipientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{StepUpAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return j.signAccess(claims)
+}
+
+// ValidateStepUpToken validates the step-up token and returns the claims
+func (j *JwtUtil) ValidateStepUpToken(tokenString string) (*JwtClaim, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JwtClaim{}, j.accessKey, jwt.WithAudience(StepUpAudience))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*JwtClaim); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid step-up token")
+}
+
 // ValidateRefreshToken validates the refresh token and returns the claims
 func (j *JwtUtil) ValidateRefreshToken(tokenString string) (*JwtClaim, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JwtClaim{}, func(token *jwt.Token) (any, error) {
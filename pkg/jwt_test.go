@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeySet returns a set with a single EdDSA signing key
+func testKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key := &SigningKey{ID: "test", Method: jwt.SigningMethodEdDSA, Private: private, Public: public}
+	return &KeySet{signing: key, keys: map[string]*SigningKey{key.ID: key}}
+}
+
+func TestTokenAudiencesAreSeparate(t *testing.T) {
+	util := NewJwtUtil("access-secret", "refresh-secret", time.Minute, time.Hour)
+
+	access, err := util.GenerateAccessToken("user", "session")
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	stepUp, err := util.GenerateStepUpToken("user", "session", "jti", NewMoney(100, 0), "", time.Minute)
+	if err != nil {
+		t.Fatalf("step-up token: %v", err)
+	}
+	refresh, err := util.GenerateRefreshToken("user", "session", "jti")
+	if err != nil {
+		t.Fatalf("refresh token: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		validate func(string) (*JwtClaim, error)
+		token    string
+		valid    bool
+	}{
+		{name: "access token as access token", validate: util.ValidateAccessToken, token: access, valid: true},
+		{name: "step-up token as access token", validate: util.ValidateAccessToken, token: stepUp},
+		{name: "refresh token as access token", validate: util.ValidateAccessToken, token: refresh},
+		{name: "step-up token as step-up token", validate: util.ValidateStepUpToken, token: stepUp, valid: true},
+		{name: "access token as step-up token", validate: util.ValidateStepUpToken, token: access},
+		{name: "refresh token as step-up token", validate: util.ValidateStepUpToken, token: refresh},
+		{name: "refresh token as refresh token", validate: util.ValidateRefreshToken, token: refresh, valid: true},
+		{name: "access token as refresh token", validate: util.ValidateRefreshToken, token: access},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.validate(tt.token)
+			if (err == nil) != tt.valid {
+				t.Fatalf("validate error = %v, want valid %v", err, tt.valid)
+			}
+			if tt.valid && (claims.UserID != "user" || claims.SessionID != "session") {
+				t.Errorf("claims = %+v, want user and session", claims)
+			}
+		})
+	}
+}
+
+func TestLegacyHS256GraceWindow(t *testing.T) {
+	legacy, err := NewJwtUtil("access-secret", "refresh-secret", time.Minute, time.Hour).GenerateAccessToken("user", "session")
+	if err != nil {
+		t.Fatalf("legacy token: %v", err)
+	}
+	keys := testKeySet(t)
+
+	tests := []struct {
+		name  string
+		until time.Time
+		valid bool
+	}{
+		{name: "without a grace window", until: time.Time{}},
+		{name: "inside the grace window", until: time.Now().Add(time.Hour), valid: true},
+		{name: "after the grace window", until: time.Now().Add(-time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			util := NewJwtUtil("access-secret", "refresh-secret", time.Minute, time.Hour).UseKeys(keys).AcceptHS256Until(tt.until)
+
+			if _, err := util.ValidateAccessToken(legacy); (err == nil) != tt.valid {
+				t.Errorf("legacy token error = %v, want valid %v", err, tt.valid)
+			}
+
+			// Tokens signed with the keys are accepted either way
+			current, err := util.GenerateAccessToken("user", "session")
+			if err != nil {
+				t.Fatalf("access token: %v", err)
+			}
+			if _, err := util.ValidateAccessToken(current); err != nil {
+				t.Errorf("current token: %v", err)
+			}
+		})
+	}
+}
+
+func TestLegacyHS256NeedsTheAccessSecret(t *testing.T) {
+	forged, err := NewJwtUtil("guessed-secret", "refresh-secret", time.Minute, time.Hour).GenerateAccessToken("user", "session")
+	if err != nil {
+		t.Fatalf("forged token: %v", err)
+	}
+
+	util := NewJwtUtil("access-secret", "refresh-secret", time.Minute, time.Hour).UseKeys(testKeySet(t)).AcceptHS256Until(time.Now().Add(time.Hour))
+	if _, err := util.ValidateAccessToken(forged); err == nil {
+		t.Error("token signed with another secret was accepted during the grace window")
+	}
+}
@@ -0,0 +1,22 @@
+package pkg
+
+import "strings"
+
+// MaskName keeps the first letter of every word, e.g. "John Doe" becomes "J*** D**"
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		runes := []rune(word)
+		words[i] = string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	}
+	return strings.Join(words, " ")
+}
+
+// MaskPhone keeps the first four and last three digits, e.g. "08123456789" becomes "0812****789"
+func MaskPhone(phone string) string {
+	runes := []rune(phone)
+	if len(runes) <= 7 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:4]) + strings.Repeat("*", len(runes)-7) + string(runes[len(runes)-3:])
+}
@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQueueClosed = errors.New("queue is closed")
+
+// MemoryQueue is an in-process TransferQueue backed by a buffered channel. It supports ack,
+// nack, delayed retries and dead-lettering like the RabbitMQ implementation, but messages
+// only live as long as the process. Meant for tests and single-node deployments.
+type MemoryQueue struct {
+	messages    chan memoryMessage
+	done        chan struct{}
+	closeOnce   sync.Once
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+}
+
+type memoryMessage struct {
+	id         string
+	body       []byte
+	retryCount int
+}
+
+var _ TransferQueue = (*MemoryQueue)(nil)
+
+// NewMemoryQueue creates an in-memory queue holding up to buffer undelivered messages
+func NewMemoryQueue(buffer int) *MemoryQueue {
+	return &MemoryQueue{
+		messages: make(chan memoryMessage, buffer),
+		done:     make(chan struct{}),
+	}
+}
+
+// IsReady returns true until the queue is closed
+func (q *MemoryQueue) IsReady() bool {
+	select {
+	case <-q.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close stops every consumer, undelivered messages are dropped
+func (q *MemoryQueue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.done)
+	})
+}
+
+// PublishTransfer enqueues a message, blocking while the buffer is full
+func (q *MemoryQueue) PublishTransfer(ctx context.Context, msg TransferMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return q.enqueue(ctx, memoryMessage{id: msg.TransferID, body: body})
+}
+
+func (q *MemoryQueue) enqueue(ctx context.Context, msg memoryMessage) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	case <-q.done:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requeue puts a message back without blocking the consumer that settles it
+func (q *MemoryQueue) requeue(msg memoryMessage, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		q.enqueue(context.Background(), msg)
+	})
+}
+
+// ConsumeTransfers delivers messages until ctx is done or the queue is closed
+func (q *MemoryQueue) ConsumeTransfers(ctx context.Context) (<-chan TransferDelivery, error) {
+	if !q.IsReady() {
+		return nil, ErrQueueClosed
+	}
+
+	out := make(chan TransferDelivery)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.done:
+				return
+			case msg := <-q.messages:
+				select {
+				case out <- &memoryDelivery{queue: q, msg: msg}:
+				case <-ctx.Done():
+					q.requeue(msg, 0)
+					return
+				case <-q.done:
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// DeadLetters returns the messages that were dead-lettered so far
+func (q *MemoryQueue) DeadLetters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter(nil), q.deadLetters...)
+}
+
+// memoryDelivery is a message handed out by MemoryQueue
+type memoryDelivery struct {
+	queue   *MemoryQueue
+	msg     memoryMessage
+	settled sync.Once
+}
+
+// settle runs fn only for the first settlement of the delivery
+func (d *memoryDelivery) settle(fn func()) error {
+	settled := false
+	d.settled.Do(func() {
+		fn()
+		settled = true
+	})
+	if !settled {
+		return errors.New("delivery already settled")
+	}
+	return nil
+}
+
+func (d *memoryDelivery) Body() []byte {
+	return d.msg.body
+}
+
+func (d *memoryDelivery) RetryCount() int {
+	return d.msg.retryCount
+}
+
+func (d *memoryDelivery) Ack() error {
+	return d.settle(func() {})
+}
+
+func (d *memoryDelivery) Nack(requeue bool) error {
+	return d.settle(func() {
+		if requeue {
+			d.queue.requeue(d.msg, 0)
+			return
+		}
+		d.queue.addDeadLetter(d.msg, "rejected")
+	})
+}
+
+func (d *memoryDelivery) Retry(ctx context.Context, reason string) (bool, error) {
+	attempt := d.msg.retryCount + 1
+	if attempt > len(TransferRetryDelays) {
+		return false, nil
+	}
+
+	next := d.msg
+	next.retryCount = attempt
+	return true, d.settle(func() {
+		d.queue.requeue(next, TransferRetryDelays[attempt-1])
+	})
+}
+
+func (d *memoryDelivery) DeadLetter(ctx context.Context, reason string) error {
+	return d.settle(func() {
+		d.queue.addDeadLetter(d.msg, reason)
+	})
+}
+
+func (q *MemoryQueue) addDeadLetter(msg memoryMessage, reason string) {
+	letter := DeadLetter{
+		MessageID:      msg.id,
+		Reason:         reason,
+		RetryCount:     msg.retryCount,
+		DeadLetteredAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	var transfer TransferMessage
+	if err := json.Unmarshal(msg.body, &transfer); err == nil && transfer.TransferID != "" {
+		letter.Transfer = &transfer
+	} else {
+		letter.Body = string(msg.body)
+	}
+
+	q.mu.Lock()
+	q.deadLetters = append(q.deadLetters, letter)
+	q.mu.Unlock()
+}
@@ -0,0 +1,167 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MoneyScale is the number of decimal places kept for every amount.
+// Amounts are stored as integer minor units (1 unit = 0.01).
+const MoneyScale = 2
+
+const moneyFactor = 100
+
+var (
+	ErrInvalidMoney   = errors.New("invalid money amount")
+	ErrMoneyPrecision = errors.New("money amount has more than 2 decimal places")
+	ErrMoneyOverflow  = errors.New("money amount out of range")
+)
+
+// Money is an exact monetary amount expressed in minor units.
+// It is encoded in JSON as a decimal number and stored in Postgres as NUMERIC(20,2).
+type Money int64
+
+// NewMoney builds a Money value from whole units and minor units, e.g. NewMoney(1500, 25) = 1500.25
+func NewMoney(units int64, minor int64) Money {
+	return Money(units*moneyFactor + minor)
+}
+
+// ParseMoney parses a decimal string such as "1500", "1500.5" or "-20.25" without going through float64.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidMoney
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+	if intPart == "" || (hasFrac && fracPart == "") {
+		return 0, ErrInvalidMoney
+	}
+	if len(fracPart) > MoneyScale {
+		// Allow trailing zeros such as 10.500 but reject real sub-cent precision
+		if strings.TrimRight(fracPart[MoneyScale:], "0") != "" {
+			return 0, ErrMoneyPrecision
+		}
+		fracPart = fracPart[:MoneyScale]
+	}
+	for _, r := range intPart + fracPart {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidMoney
+		}
+	}
+	fracPart += strings.Repeat("0", MoneyScale-len(fracPart))
+
+	units, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, ErrMoneyOverflow
+	}
+	minor, _ := strconv.ParseInt(fracPart, 10, 64)
+	if units > (math.MaxInt64-minor)/moneyFactor {
+		return 0, ErrMoneyOverflow
+	}
+
+	m := Money(units*moneyFactor + minor)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// MinorUnits returns the amount in minor units
+func (m Money) MinorUnits() int64 {
+	return int64(m)
+}
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool {
+	return m > 0
+}
+
+// String formats the amount with exactly two decimal places
+func (m Money) String() string {
+	v := int64(m)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/moneyFactor, v%moneyFactor)
+}
+
+// MarshalJSON encodes the amount as a JSON number, e.g. 1500.25
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if strings.ContainsAny(s, "eE") {
+		return ErrInvalidMoney
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner so Money can be scanned from NUMERIC columns
+func (m *Money) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*m = 0
+		return nil
+	}
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return ErrInvalidMoney
+	}
+
+	// Rescale the numeric value to minor units
+	value := new(big.Int).Set(v.Int)
+	exp := v.Exp + MoneyScale
+	ten := big.NewInt(10)
+	for ; exp > 0; exp-- {
+		value.Mul(value, ten)
+	}
+	for ; exp < 0; exp++ {
+		var rem big.Int
+		value.QuoRem(value, ten, &rem)
+		if rem.Sign() != 0 {
+			return ErrMoneyPrecision
+		}
+	}
+	if !value.IsInt64() {
+		return ErrMoneyOverflow
+	}
+
+	*m = Money(value.Int64())
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer so Money is sent to Postgres as an exact NUMERIC
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(m)), Exp: -MoneyScale, Valid: true}, nil
+}
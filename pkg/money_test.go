@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Money
+		err   error
+	}{
+		{name: "whole units", input: "1500", want: NewMoney(1500, 0)},
+		{name: "one decimal", input: "1500.5", want: NewMoney(1500, 50)},
+		{name: "two decimals", input: "0.01", want: 1},
+		{name: "surrounding spaces", input: " 20.25 ", want: NewMoney(20, 25)},
+		{name: "plus sign", input: "+20.25", want: NewMoney(20, 25)},
+		{name: "minus sign", input: "-20.25", want: -NewMoney(20, 25)},
+		{name: "trailing zeros past the scale", input: "10.500", want: NewMoney(10, 50)},
+		{name: "sub-cent precision", input: "10.505", err: ErrMoneyPrecision},
+		{name: "sub-cent precision after zeros", input: "10.0001", err: ErrMoneyPrecision},
+		{name: "largest amount", input: "92233720368547758.07", want: Money(math.MaxInt64)},
+		{name: "minor units overflow", input: "92233720368547758.08", err: ErrMoneyOverflow},
+		{name: "units overflow", input: "99999999999999999999", err: ErrMoneyOverflow},
+		{name: "empty", input: "", err: ErrInvalidMoney},
+		{name: "sign only", input: "-", err: ErrInvalidMoney},
+		{name: "missing units", input: ".50", err: ErrInvalidMoney},
+		{name: "missing decimals", input: "10.", err: ErrInvalidMoney},
+		{name: "double sign", input: "--10", err: ErrInvalidMoney},
+		{name: "letters", input: "10a", err: ErrInvalidMoney},
+		{name: "exponent", input: "1e3", err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseMoney(%q) error = %v, want %v", tt.input, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Money
+		err   error
+	}{
+		{name: "number", input: `1500.25`, want: NewMoney(1500, 25)},
+		{name: "negative number", input: `-0.5`, want: -50},
+		{name: "quoted number", input: `"1500.25"`, want: NewMoney(1500, 25)},
+		{name: "null keeps the value", input: `null`, want: 7},
+		{name: "exponent", input: `1e3`, err: ErrInvalidMoney},
+		{name: "upper case exponent", input: `1.5E2`, err: ErrInvalidMoney},
+		{name: "quoted exponent", input: `"1e3"`, err: ErrInvalidMoney},
+		{name: "sub-cent precision", input: `0.001`, err: ErrMoneyPrecision},
+		{name: "boolean", input: `true`, err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Money(7)
+			err := m.UnmarshalJSON([]byte(tt.input))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("UnmarshalJSON(%s) error = %v, want %v", tt.input, err, tt.err)
+			}
+			if err == nil && m != tt.want {
+				t.Errorf("UnmarshalJSON(%s) = %d, want %d", tt.input, m, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{amount: 0, want: "0.00"},
+		{amount: 5, want: "0.05"},
+		{amount: NewMoney(1500, 25), want: "1500.25"},
+		{amount: -5, want: "-0.05"},
+		{amount: -50, want: "-0.50"},
+		{amount: -NewMoney(20, 25), want: "-20.25"},
+		{amount: Money(math.MaxInt64), want: "92233720368547758.07"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyNumericRoundTrip(t *testing.T) {
+	amounts := []Money{0, 1, -1, NewMoney(1500, 25), -NewMoney(20, 5), Money(math.MaxInt64)}
+
+	for _, amount := range amounts {
+		numeric, err := amount.NumericValue()
+		if err != nil {
+			t.Fatalf("NumericValue(%s): %v", amount, err)
+		}
+
+		var got Money
+		if err := got.ScanNumeric(numeric); err != nil {
+			t.Fatalf("ScanNumeric(%s): %v", amount, err)
+		}
+		if got != amount {
+			t.Errorf("round trip of %s returned %s", amount, got)
+		}
+	}
+}
+
+func TestMoneyScanNumeric(t *testing.T) {
+	tests := []struct {
+		name  string
+		input pgtype.Numeric
+		want  Money
+		err   error
+	}{
+		{name: "null", input: pgtype.Numeric{}, want: 0},
+		{name: "whole units", input: pgtype.Numeric{Int: bigInt(15), Exp: 2, Valid: true}, want: NewMoney(1500, 0)},
+		{name: "extra trailing zeros", input: pgtype.Numeric{Int: bigInt(150025000), Exp: -5, Valid: true}, want: NewMoney(1500, 25)},
+		{name: "sub-cent precision", input: pgtype.Numeric{Int: bigInt(1001), Exp: -3, Valid: true}, err: ErrMoneyPrecision},
+		{name: "out of range", input: pgtype.Numeric{Int: bigInt(math.MaxInt64), Exp: 0, Valid: true}, err: ErrMoneyOverflow},
+		{name: "not a number", input: pgtype.Numeric{NaN: true, Valid: true}, err: ErrInvalidMoney},
+		{name: "infinity", input: pgtype.Numeric{InfinityModifier: pgtype.Infinity, Valid: true}, err: ErrInvalidMoney},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Money(7)
+			err := got.ScanNumeric(tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ScanNumeric error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ScanNumeric = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func bigInt(v int64) *big.Int {
+	return big.NewInt(v)
+}
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	NotifierDriverLog  = "log"
+	NotifierDriverFile = "file"
+	NotifierDriverHTTP = "http"
+)
+
+// Notifier delivers short messages to a user's phone
+type Notifier interface {
+	Send(ctx context.Context, phone, message string) error
+}
+
+// LogNotifier writes messages to the application log instead of sending them, for local
+// development
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Send(ctx context.Context, phone, message string) error {
+	log.Printf("Notification to %s: %s", MaskPhone(phone), message)
+	return nil
+}
+
+// FileNotifier appends messages to a file instead of sending them, so tests and local
+// setups can read the codes without going through the application log
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Send(ctx context.Context, phone, message string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), phone, message)
+	return err
+}
+
+// HTTPNotifier hands messages to an SMS gateway, POSTing {"to": phone, "message": message} as
+// JSON to its URL with the token as bearer credentials. Any 2xx answer counts as accepted.
+type HTTPNotifier struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPNotifier(url, token string, timeout time.Duration) *HTTPNotifier {
+	return &HTTPNotifier{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+type httpNotification struct {
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+func (n *HTTPNotifier) Send(ctx context.Context, phone, message string) error {
+	body, err := json.Marshal(httpNotification{To: phone, Message: message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification gateway answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPNotifierPostsTheMessage(t *testing.T) {
+	var got httpNotification
+	var auth string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode notification: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	notifier := NewHTTPNotifier(gateway.URL, "gateway-token", time.Second)
+	if err := notifier.Send(context.Background(), "08123456789", "Your code is 123456"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got.To != "08123456789" || got.Message != "Your code is 123456" {
+		t.Errorf("gateway received %+v", got)
+	}
+	if auth != "Bearer gateway-token" {
+		t.Errorf("Authorization = %q, want the bearer token", auth)
+	}
+}
+
+func TestHTTPNotifierReportsGatewayErrors(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer gateway.Close()
+
+	notifier := NewHTTPNotifier(gateway.URL, "", time.Second)
+	if err := notifier.Send(context.Background(), "08123456789", "Your code is 123456"); err == nil {
+		t.Error("send succeeded although the gateway failed")
+	}
+}
@@ -0,0 +1,29 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// GenerateCode returns a random numeric code of the given number of digits
+func GenerateCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// HashCode hashes a one-time code for storage, the owner's ID keeps equal codes of
+// different users apart. Codes are short, so the HMAC secret keeps a leaked table from
+// being brute-forced.
+func HashCode(secret, ownerID, code string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ownerID + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
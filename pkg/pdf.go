@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDF page layout, A4 in points with a monospaced font so columns line up
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 40
+	pdfFontSize   = 8
+	pdfLeading    = 11
+	// PDFLineWidth is the number of characters that fit on one line
+	PDFLineWidth = (pdfPageWidth - 2*pdfMargin) * 10 / (pdfFontSize * 6)
+)
+
+// Objects written at the end of the document get fixed IDs so pages can refer to them
+const (
+	pdfCatalogID = 1
+	pdfPagesID   = 2
+	pdfFontID    = 3
+	pdfFirstID   = 4
+)
+
+var pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+
+// PDFWriter writes a plain text PDF page by page, only the current page is kept in memory.
+// Text is set in the standard Courier font with WinAnsiEncoding, no font is embedded, so only
+// Latin-1 characters can be shown and every other character is printed as '?'.
+type PDFWriter struct {
+	w       io.Writer
+	written int64
+	offsets map[int]int64
+	nextID  int
+	pages   []int
+	page    bytes.Buffer
+	lines   int
+	err     error
+}
+
+// NewPDFWriter starts a PDF document on w
+func NewPDFWriter(w io.Writer) *PDFWriter {
+	p := &PDFWriter{w: w, offsets: make(map[int]int64), nextID: pdfFirstID}
+	p.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	return p
+}
+
+// WriteLine adds a line of text, starting a new page when the current one is full
+func (p *PDFWriter) WriteLine(text string) error {
+	if p.lines == pdfLinesPerPage {
+		p.flushPage()
+	}
+	if p.lines == 0 {
+		fmt.Fprintf(&p.page, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+	}
+	fmt.Fprintf(&p.page, "(%s) Tj T*\n", pdfEscape(text))
+	p.lines++
+	return p.err
+}
+
+// Close writes the remaining page, the document catalog and the cross-reference table
+func (p *PDFWriter) Close() error {
+	if p.lines > 0 || len(p.pages) == 0 {
+		p.flushPage()
+	}
+
+	p.object(pdfFontID, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	kids := make([]string, len(p.pages))
+	for i, id := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	p.object(pdfPagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	p.object(pdfCatalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesID))
+
+	xref := p.written
+	p.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", p.nextID))
+	for id := 1; id < p.nextID; id++ {
+		p.write(fmt.Sprintf("%010d 00000 n \n", p.offsets[id]))
+	}
+	p.write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.nextID, pdfCatalogID, xref))
+	return p.err
+}
+
+// flushPage writes the current page and its content stream
+func (p *PDFWriter) flushPage() {
+	if p.lines > 0 {
+		p.page.WriteString("ET\n")
+	}
+
+	contentID := p.nextID
+	pageID := p.nextID + 1
+	p.nextID += 2
+
+	p.object(contentID, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", p.page.Len(), p.page.Bytes()))
+	p.object(pageID, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R >> >> >>",
+		pdfPagesID, pdfPageWidth, pdfPageHeight, contentID, pdfFontID))
+	p.pages = append(p.pages, pageID)
+
+	p.page.Reset()
+	p.lines = 0
+}
+
+func (p *PDFWriter) object(id int, body string) {
+	p.offsets[id] = p.written
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", id, body))
+}
+
+func (p *PDFWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	n, err := io.WriteString(p.w, s)
+	p.written += int64(n)
+	p.err = err
+}
+
+// pdfEscape escapes a string literal, characters outside Latin-1 are replaced with '?'
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > 0xff:
+			b.WriteByte('?')
+		case r >= 0xa0:
+			// Latin-1 bytes match WinAnsiEncoding for these characters
+			b.WriteByte(byte(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
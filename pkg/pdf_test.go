@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "Opening balance: 10.00", want: "Opening balance: 10.00"},
+		{name: "parentheses and backslash", text: `a(b)\c`, want: `a\(b\)\\c`},
+		{name: "Latin-1", text: "café", want: "caf\xe9"},
+		{name: "control characters", text: "a\nb\x7f", want: "a?b?"},
+		{name: "outside Latin-1", text: "Rp 10 €🙂", want: "Rp 10 ??"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfEscape(tt.text); got != tt.want {
+				t.Errorf("pdfEscape(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFWriterDocument(t *testing.T) {
+	var out bytes.Buffer
+	pdf := NewPDFWriter(&out)
+
+	lines := pdfLinesPerPage*2 + 1
+	for i := 0; i < lines; i++ {
+		if err := pdf.WriteLine(fmt.Sprintf("line %d", i)); err != nil {
+			t.Fatalf("write line %d: %v", i, err)
+		}
+	}
+	if err := pdf.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	document := out.String()
+
+	if !strings.HasPrefix(document, "%PDF-1.4\n") || !strings.HasSuffix(document, "%%EOF\n") {
+		t.Fatalf("not a PDF document")
+	}
+	if !strings.Contains(document, "/Count 3 >>") {
+		t.Errorf("%d lines should fill 3 pages", lines)
+	}
+	if !strings.Contains(document, fmt.Sprintf("(line %d) Tj", lines-1)) {
+		t.Error("last line is missing")
+	}
+
+	// Every cross-reference entry points at the start of its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(document)
+	if startxref == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(startxref[1])
+	if !strings.HasPrefix(document[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllStringSubmatch(document[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(document[offset:], want) {
+			t.Errorf("xref entry %d points at %q, want %q", i+1, document[offset:offset+len(want)], want)
+		}
+	}
+}
+
+func TestPDFWriterEmptyDocument(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewPDFWriter(&out).Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !strings.Contains(out.String(), "/Count 1 >>") {
+		t.Error("an empty document should still have one page")
+	}
+}
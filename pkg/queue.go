@@ -0,0 +1,37 @@
+package pkg
+
+import "context"
+
+// Queue drivers selectable through QUEUE_DRIVER
+const (
+	QueueDriverRabbitMQ = "rabbitmq"
+	QueueDriverMemory   = "memory"
+)
+
+// TransferQueue publishes transfer messages and delivers them to consumers.
+// It is implemented by RabbitMQ and by the in-process MemoryQueue.
+type TransferQueue interface {
+	// PublishTransfer returns once the queue has durably accepted the message
+	PublishTransfer(ctx context.Context, msg TransferMessage) error
+	// ConsumeTransfers returns a channel of deliveries that is closed once ctx is done or the queue is closed
+	ConsumeTransfers(ctx context.Context) (<-chan TransferDelivery, error)
+	IsReady() bool
+	Close()
+}
+
+// TransferDelivery is a transfer message handed to a consumer. It must be settled exactly once
+// with Ack, Nack, Retry or DeadLetter.
+type TransferDelivery interface {
+	Body() []byte
+	// RetryCount is the number of times the message has already been retried with backoff
+	RetryCount() int
+	// Ack removes the message from the queue
+	Ack() error
+	// Nack returns the message to the queue immediately when requeue is true, otherwise drops it
+	Nack(requeue bool) error
+	// Retry redelivers the message after the backoff of the next attempt. It returns false
+	// without settling the message when every retry has been used.
+	Retry(ctx context.Context, reason string) (bool, error)
+	// DeadLetter parks the message for inspection together with the reason it failed
+	DeadLetter(ctx context.Context, reason string) error
+}
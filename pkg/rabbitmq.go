@@ -1,9 +1,13 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -11,14 +15,53 @@ import (
 
 // RabbitMQ connection constants
 const (
-	TransferQueueName      = "transfer_queue"
+	TransferQueueName      = "transfer_queue_v2"
 	TransferExchangeName   = "transfer_exchange"
 	TransferRoutingKey     = "transfer.request"
 	ReconnectDelay         = 5 * time.Second
+	MaxReconnectDelay      = time.Minute
 	ResendDelay            = 5 * time.Second
 	ReconnectRetryAttempts = 10
 )
 
+// Dead-letter and retry topology constants
+const (
+	TransferDeadLetterExchange = "transfer_dlx"
+	TransferDeadLetterQueue    = "transfer_dlq"
+	TransferDeadLetterKey      = "transfer.dead"
+	TransferRetryExchange      = "transfer_retry_exchange"
+
+	// Message headers used by the retry and dead-letter flow
+	HeaderRetryCount    = "x-retry-count"
+	HeaderFailureReason = "x-failure-reason"
+	HeaderDeadLettered  = "x-dead-lettered-at"
+)
+
+// LegacyTransferQueueName is the transfer queue declared before dead-lettering was added. RabbitMQ
+// refuses to redeclare it with the dead-letter arguments, so transfers moved to TransferQueueName.
+const LegacyTransferQueueName = "transfer_queue"
+
+// TransferRetryDelays is the exponential backoff applied before each redelivery of a failed transfer.
+// Once every delay has been used the message is dead-lettered.
+var TransferRetryDelays = []time.Duration{
+	2 * time.Second,
+	8 * time.Second,
+	32 * time.Second,
+	128 * time.Second,
+	512 * time.Second,
+}
+
+// transferRetryQueueName returns the delay queue used for the given retry attempt (1-based)
+func transferRetryQueueName(attempt int) string {
+	return fmt.Sprintf("transfer_retry_%d", attempt)
+}
+
+var (
+	ErrRabbitMQNotReady    = errors.New("rabbitmq is not ready")
+	ErrRabbitMQClosed      = errors.New("rabbitmq connection closed")
+	ErrPublishNotConfirmed = errors.New("rabbitmq did not confirm the message")
+)
+
 // getRabbitMQURL returns the RabbitMQ URL from environment or default
 func getRabbitMQURL() string {
 	if url := os.Getenv("RABBITMQ_URL"); url != "" {
@@ -29,119 +72,336 @@ func getRabbitMQURL() string {
 
 // TransferMessage represents a transfer task to be processed
 type TransferMessage struct {
-	TransferID  string  `json:"transfer_id"`
-	SenderID    string  `json:"sender_id"`
-	RecipientID string  `json:"recipient_id"`
-	Amount      float64 `json:"amount"`
-	Remarks     string  `json:"remarks"`
+	TransferID  string `json:"transfer_id"`
+	SenderID    string `json:"sender_id"`
+	RecipientID string `json:"recipient_id"`
+	Amount      Money  `json:"amount"`
+	Remarks     string `json:"remarks"`
 }
 
-// RabbitMQ holds the connection and channel
+// RabbitMQ supervises the connection to the broker. It reconnects with backoff when the
+// connection or channel is lost, redeclares the topology and resumes every consumer.
 type RabbitMQ struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	isReady bool
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel // publishing channel, in confirm mode
+	isReady   bool
+	connected chan struct{} // closed while the connection is ready
+	done      chan struct{} // closed by Close
+	closeOnce sync.Once
 }
 
 // IsReady returns true if the RabbitMQ connection is ready
 func (r *RabbitMQ) IsReady() bool {
-	return r != nil && r.isReady
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.isReady
 }
 
-var GlobalRabbitMQ *RabbitMQ
+func newRabbitMQ() *RabbitMQ {
+	return &RabbitMQ{
+		connected: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
 
-// NewRabbitMQ creates a new RabbitMQ connection
+// NewRabbitMQ connects to RabbitMQ and keeps the connection alive in the background.
+// It fails if the first connection attempt fails.
 func NewRabbitMQ() (*RabbitMQ, error) {
-	rmq := &RabbitMQ{isReady: false}
+	rmq := newRabbitMQ()
 	if err := rmq.Connect(); err != nil {
 		return nil, err
 	}
+	go rmq.handleReconnect()
 	return rmq, nil
 }
 
 // Connect establishes a connection to RabbitMQ
 func (r *RabbitMQ) Connect() error {
-	var err error
-
 	// Connect to RabbitMQ using environment URL
 	rabbitmqURL := getRabbitMQURL()
 	log.Printf("Connecting to RabbitMQ at: %s", rabbitmqURL)
-	r.conn, err = amqp.Dial(rabbitmqURL)
+	conn, err := amqp.Dial(rabbitmqURL)
 	if err != nil {
 		return err
 	}
 
 	// Create channel
-	r.channel, err = r.conn.Channel()
+	channel, err := conn.Channel()
 	if err != nil {
-		r.conn.Close()
+		conn.Close()
+		return err
+	}
+
+	// Put the channel in confirm mode so every publish is acknowledged by the broker
+	if err = channel.Confirm(false); err != nil {
+		conn.Close()
 		return err
 	}
 
 	// Setup our topology
-	err = r.setupTopology()
-	if err != nil {
-		r.Close()
+	if err = setupTopology(channel); err != nil {
+		conn.Close()
 		return err
 	}
+	detachLegacyQueue(conn)
 
-	r.isReady = true
+	r.mu.Lock()
+	r.conn = conn
+	r.channel = channel
+	if !r.isReady {
+		r.isReady = true
+		close(r.connected)
+	}
+	r.mu.Unlock()
 	return nil
 }
 
+// handleReconnect waits for the connection or channel to close and reconnects with
+// exponential backoff until Close is called
+func (r *RabbitMQ) handleReconnect() {
+	for {
+		if r.IsReady() {
+			r.mu.RLock()
+			connClosed := r.conn.NotifyClose(make(chan *amqp.Error, 1))
+			chanClosed := r.channel.NotifyClose(make(chan *amqp.Error, 1))
+			r.mu.RUnlock()
+
+			select {
+			case <-r.done:
+				return
+			case err := <-connClosed:
+				log.Printf("RabbitMQ connection closed: %v", err)
+			case err := <-chanClosed:
+				log.Printf("RabbitMQ channel closed: %v", err)
+			}
+			r.markDisconnected()
+		}
+
+		delay := ReconnectDelay
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-r.done:
+				return
+			case <-time.After(delay):
+			}
+
+			err := r.Connect()
+			if err == nil {
+				log.Println("RabbitMQ reconnected")
+				break
+			}
+
+			log.Printf("RabbitMQ reconnect attempt %d failed: %v", attempt, err)
+			if attempt == ReconnectRetryAttempts {
+				log.Printf("WARNING: RabbitMQ still unreachable after %d attempts, retrying every %s", attempt, MaxReconnectDelay)
+			}
+			delay = min(delay*2, MaxReconnectDelay)
+		}
+	}
+}
+
+// markDisconnected flags the connection as lost so publishers and consumers wait for the next one
+func (r *RabbitMQ) markDisconnected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isReady {
+		r.isReady = false
+		r.connected = make(chan struct{})
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+}
+
+// waitReady blocks until the connection is ready, ctx is done or Close is called
+func (r *RabbitMQ) waitReady(ctx context.Context) error {
+	r.mu.RLock()
+	connected := r.connected
+	r.mu.RUnlock()
+
+	select {
+	case <-connected:
+		return nil
+	case <-r.done:
+		return ErrRabbitMQClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // setupTopology sets up exchanges and queues
-func (r *RabbitMQ) setupTopology() error {
-	// Declare exchange
-	err := r.channel.ExchangeDeclare(
-		TransferExchangeName, // name
-		"direct",             // type
-		true,                 // durable
-		false,                // auto-deleted
-		false,                // internal
-		false,                // no-wait
-		nil,                  // arguments
-	)
-	if err != nil {
-		return err
+func setupTopology(ch *amqp.Channel) error {
+	// Declare exchanges
+	for _, exchange := range []string{TransferExchangeName, TransferDeadLetterExchange, TransferRetryExchange} {
+		err := ch.ExchangeDeclare(
+			exchange, // name
+			"direct", // type
+			true,     // durable
+			false,    // auto-deleted
+			false,    // internal
+			false,    // no-wait
+			nil,      // arguments
+		)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Declare quorum queue with appropriate arguments
 	args := make(amqp.Table)
 	args["x-queue-type"] = "quorum"
-	// Optional: set delivery limit to prevent infinite redelivery loops
+	// Set delivery limit to prevent infinite redelivery loops
 	args["x-delivery-limit"] = 5
 	// Optional: set additional quorum queue properties
 	args["x-max-in-memory-length"] = 1000
+	// Messages over the delivery limit or rejected without requeue go to the dead-letter queue
+	args["x-dead-letter-exchange"] = TransferDeadLetterExchange
+	args["x-dead-letter-routing-key"] = TransferDeadLetterKey
 
-	_, err = r.channel.QueueDeclare(
-		TransferQueueName, // name
-		true,              // durable (quorum queues are always durable)
-		false,             // delete when unused
-		false,             // exclusive
-		false,             // no-wait
-		args,              // arguments with queue type
-	)
-	if err != nil {
+	if err := declareAndBind(ch, TransferQueueName, TransferRoutingKey, TransferExchangeName, args); err != nil {
 		return err
 	}
 
-	// Bind queue to exchange
-	err = r.channel.QueueBind(
-		TransferQueueName,    // queue name
-		TransferRoutingKey,   // routing key
-		TransferExchangeName, // exchange
-		false,
-		nil,
+	// Dead-letter queue, inspected and replayed with cmd/dlq
+	dlqArgs := amqp.Table{"x-queue-type": "classic"}
+	if err := declareAndBind(ch, TransferDeadLetterQueue, TransferDeadLetterKey, TransferDeadLetterExchange, dlqArgs); err != nil {
+		return err
+	}
+
+	// One delay queue per retry attempt. Nobody consumes them: when the TTL expires
+	// the message is dead-lettered back to the transfer exchange.
+	for i, delay := range TransferRetryDelays {
+		name := transferRetryQueueName(i + 1)
+		retryArgs := amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    TransferExchangeName,
+			"x-dead-letter-routing-key": TransferRoutingKey,
+		}
+		if err := declareAndBind(ch, name, name, TransferRetryExchange, retryArgs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detachLegacyQueue unbinds the pre dead-letter transfer queue from the transfer exchange when it
+// still exists, so new messages only reach TransferQueueName, then moves the messages it still
+// holds there and deletes it once it is empty and unused. It runs on its own channel because the
+// broker closes the channel when the queue does not exist.
+func detachLegacyQueue(conn *amqp.Connection) {
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Printf("Failed to open channel to check %s: %v", LegacyTransferQueueName, err)
+		return
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueDeclarePassive(LegacyTransferQueueName, true, false, false, false, nil)
+	if err != nil {
+		// Not found, nothing to detach
+		return
+	}
+
+	if err := ch.QueueUnbind(LegacyTransferQueueName, TransferRoutingKey, TransferExchangeName, nil); err != nil {
+		log.Printf("Failed to unbind %s: %v", LegacyTransferQueueName, err)
+		return
+	}
+
+	if queue.Messages > 0 {
+		moved, err := drainLegacyQueue(ch)
+		log.Printf("Moved %d transfer messages from %s to %s", moved, LegacyTransferQueueName, TransferQueueName)
+		if err != nil {
+			log.Printf("WARNING: failed to drain %s, the rest is moved on the next connect: %v", LegacyTransferQueueName, err)
+			return
+		}
+	}
+
+	// Still consumed by an instance of the previous version, or refilled meanwhile: keep it for now
+	if _, err := ch.QueueDelete(LegacyTransferQueueName, true, true, false); err != nil {
+		log.Printf("Keeping %s: %v", LegacyTransferQueueName, err)
+	}
+}
+
+// drainLegacyQueue republishes every message of the legacy queue to the transfer exchange and
+// acks it once the broker confirmed the copy. A message moved twice is harmless, the worker
+// applies each transfer once.
+func drainLegacyQueue(ch *amqp.Channel) (int, error) {
+	if err := ch.Confirm(false); err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for {
+		d, ok, err := ch.Get(LegacyTransferQueueName, false)
+		if err != nil || !ok {
+			return moved, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ResendDelay)
+		confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, TransferExchangeName, TransferRoutingKey, false, false, amqp.Publishing{
+			Headers:      copyHeaders(d.Headers),
+			ContentType:  d.ContentType,
+			MessageId:    d.MessageId,
+			DeliveryMode: amqp.Persistent,
+			Body:         d.Body,
+		})
+		if err == nil {
+			var acked bool
+			acked, err = confirmation.WaitContext(ctx)
+			if err == nil && !acked {
+				err = ErrPublishNotConfirmed
+			}
+		}
+		cancel()
+		if err != nil {
+			d.Nack(false, true)
+			return moved, err
+		}
+
+		if err := d.Ack(false); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+}
+
+// declareAndBind declares a durable queue and binds it to an exchange
+func declareAndBind(ch *amqp.Channel, queue, routingKey, exchange string, args amqp.Table) error {
+	_, err := ch.QueueDeclare(
+		queue, // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		args,  // arguments
 	)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return ch.QueueBind(
+		queue,      // queue name
+		routingKey, // routing key
+		exchange,   // exchange
+		false,
+		nil,
+	)
 }
 
-// Close closes the channel and connection
+// Close stops reconnecting and closes the channel and connection
 func (r *RabbitMQ) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if r.channel != nil {
 		r.channel.Close()
 	}
@@ -151,47 +411,256 @@ func (r *RabbitMQ) Close() {
 	r.isReady = false
 }
 
-// PublishTransfer publishes a transfer message to the queue
-func (r *RabbitMQ) PublishTransfer(msg TransferMessage) error {
-	if !r.isReady {
-		return nil // Just skip if RabbitMQ is not ready
-	}
-
+// PublishTransfer publishes a transfer message to the queue and waits for the broker to confirm it
+func (r *RabbitMQ) PublishTransfer(ctx context.Context, msg TransferMessage) error {
 	body, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	return r.channel.Publish(
-		TransferExchangeName, // exchange
-		TransferRoutingKey,   // routing key
-		false,                // mandatory
-		false,                // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp.Persistent, // Make messages persistent
-		},
+	return r.publish(ctx, TransferExchangeName, TransferRoutingKey, amqp.Publishing{
+		ContentType: "application/json",
+		MessageId:   msg.TransferID,
+		Body:        body,
+	})
+}
+
+var _ TransferQueue = (*RabbitMQ)(nil)
+
+// rabbitDelivery adapts an AMQP delivery to TransferDelivery
+type rabbitDelivery struct {
+	rmq *RabbitMQ
+	d   amqp.Delivery
+}
+
+func (d *rabbitDelivery) Body() []byte {
+	return d.d.Body
+}
+
+func (d *rabbitDelivery) RetryCount() int {
+	return RetryCount(d.d)
+}
+
+func (d *rabbitDelivery) Ack() error {
+	return d.d.Ack(false)
+}
+
+func (d *rabbitDelivery) Nack(requeue bool) error {
+	// Without requeue the queue dead-letters the message through its x-dead-letter-exchange
+	return d.d.Nack(false, requeue)
+}
+
+// Retry republishes the message to the delay queue of the next attempt, then acks the original
+func (d *rabbitDelivery) Retry(ctx context.Context, reason string) (bool, error) {
+	attempt := RetryCount(d.d) + 1
+	if attempt > len(TransferRetryDelays) {
+		return false, nil
+	}
+
+	headers := copyHeaders(d.d.Headers)
+	headers[HeaderRetryCount] = int32(attempt)
+	headers[HeaderFailureReason] = reason
+
+	queue := transferRetryQueueName(attempt)
+	err := d.rmq.publish(ctx, TransferRetryExchange, queue, amqp.Publishing{
+		ContentType: d.d.ContentType,
+		MessageId:   d.d.MessageId,
+		Headers:     headers,
+		Body:        d.d.Body,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, d.Ack()
+}
+
+// DeadLetter republishes the message to the dead-letter queue with the failure reason, then acks
+// the original. If that publish fails the message is rejected so the queue dead-letters it anyway.
+func (d *rabbitDelivery) DeadLetter(ctx context.Context, reason string) error {
+	headers := copyHeaders(d.d.Headers)
+	headers[HeaderFailureReason] = reason
+	headers[HeaderDeadLettered] = time.Now().UTC().Format(time.RFC3339)
+
+	err := d.rmq.publish(ctx, TransferDeadLetterExchange, TransferDeadLetterKey, amqp.Publishing{
+		ContentType: d.d.ContentType,
+		MessageId:   d.d.MessageId,
+		Headers:     headers,
+		Body:        d.d.Body,
+	})
+	if err != nil {
+		log.Printf("Failed to publish to dead-letter queue: %v", err)
+		return d.Nack(false)
+	}
+	return d.Ack()
+}
+
+// publish sends a persistent message and waits for the broker to confirm it. A publish that is
+// lost to a dropped connection or nacked by the broker is resent after ResendDelay until ctx is done.
+func (r *RabbitMQ) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if !r.IsReady() {
+		return ErrRabbitMQNotReady
+	}
+
+	msg.DeliveryMode = amqp.Persistent // Make messages persistent
+	for {
+		err := r.publishOnce(ctx, exchange, routingKey, msg)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Publish to %s failed, resending in %s: %v", exchange, ResendDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(ResendDelay):
+		}
+		if err := r.waitReady(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *RabbitMQ) publishOnce(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	r.mu.RLock()
+	channel := r.channel
+	r.mu.RUnlock()
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		false,      // mandatory
+		false,      // immediate
+		msg,
 	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrPublishNotConfirmed
+	}
+	return nil
 }
 
-// ConsumeTransfers starts consuming transfer messages from the queue
-func (r *RabbitMQ) ConsumeTransfers() (<-chan amqp.Delivery, error) {
-	if !r.isReady {
-		return nil, nil // Return nil if RabbitMQ is not ready
+// RetryCount returns how many times a delivery has already been retried through the delay queues
+func RetryCount(d amqp.Delivery) int {
+	switch count := d.Headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	}
+	return 0
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := make(amqp.Table, len(headers)+2)
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+// ConsumeTransfers consumes transfer messages from the queue. The returned channel survives
+// reconnects: after the connection comes back the consumer is registered again. It is closed
+// once ctx is done or Close is called.
+func (r *RabbitMQ) ConsumeTransfers(ctx context.Context) (<-chan TransferDelivery, error) {
+	if r == nil {
+		return nil, ErrRabbitMQNotReady
+	}
+
+	out := make(chan TransferDelivery)
+	go func() {
+		defer close(out)
+		for {
+			if err := r.waitReady(ctx); err != nil {
+				return
+			}
+
+			channel, deliveries, err := r.consume()
+			if err != nil {
+				log.Printf("Failed to start transfer consumer, retrying in %s: %v", ReconnectDelay, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-r.done:
+					return
+				case <-time.After(ReconnectDelay):
+				}
+				continue
+			}
+
+			log.Println("Transfer consumer registered")
+			stopped := r.forward(ctx, deliveries, out)
+			// Unsettled deliveries go back to the queue with the channel
+			channel.Close()
+			if stopped {
+				return
+			}
+			// The delivery channel closes when the connection drops, wait for the next one
+			log.Println("Transfer consumer lost its channel, waiting for reconnect")
+		}
+	}()
+
+	return out, nil
+}
+
+// forward hands deliveries to out until the delivery channel closes. It returns true when ctx is
+// done or Close was called, even while no message arrives.
+func (r *RabbitMQ) forward(ctx context.Context, deliveries <-chan amqp.Delivery, out chan<- TransferDelivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-r.done:
+			return true
+		case d, ok := <-deliveries:
+			if !ok {
+				return false
+			}
+			select {
+			case out <- &rabbitDelivery{rmq: r, d: d}:
+			case <-ctx.Done():
+				d.Nack(false, true)
+				return true
+			case <-r.done:
+				return true
+			}
+		}
+	}
+}
+
+// consume opens a dedicated channel and starts consuming the transfer queue. The caller closes
+// the channel once it stops reading the deliveries.
+func (r *RabbitMQ) consume() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	r.mu.RLock()
+	conn := r.conn
+	r.mu.RUnlock()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Set prefetch count to limit the number of unacknowledged messages
 	// This is important for quorum queues to control memory usage
-	if err := r.channel.Qos(
+	if err := channel.Qos(
 		10,    // prefetch count
 		0,     // prefetch size
 		false, // global
 	); err != nil {
-		return nil, err
+		channel.Close()
+		return nil, nil, err
 	}
 
-	return r.channel.Consume(
+	deliveries, err := channel.Consume(
 		TransferQueueName, // queue
 		"",                // consumer
 		false,             // auto-ack (must be false for quorum queues to ensure proper acknowledgment)
@@ -200,16 +669,19 @@ func (r *RabbitMQ) ConsumeTransfers() (<-chan amqp.Delivery, error) {
 		false,             // no-wait
 		nil,               // args
 	)
-}
-
-// InitRabbitMQ initializes the global RabbitMQ instance
-func InitRabbitMQ() error {
-	var err error
-	GlobalRabbitMQ, err = NewRabbitMQ()
 	if err != nil {
-		log.Printf("WARNING: Failed to initialize RabbitMQ: %v", err)
-		GlobalRabbitMQ = &RabbitMQ{isReady: false}
-		return err
+		channel.Close()
+		return nil, nil, err
 	}
-	return nil
+	return channel, deliveries, nil
+}
+
+// StartRabbitMQ connects to RabbitMQ and keeps the connection alive in the background. Unlike
+// NewRabbitMQ it always returns an instance: if the broker is unreachable the error is returned
+// and the instance keeps reconnecting until it comes up.
+func StartRabbitMQ() (*RabbitMQ, error) {
+	rmq := newRabbitMQ()
+	err := rmq.Connect()
+	go rmq.handleReconnect()
+	return rmq, err
 }
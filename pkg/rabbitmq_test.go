@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// readyRabbitMQ returns an instance that believes it is connected, without a broker behind it
+func readyRabbitMQ() *RabbitMQ {
+	r := newRabbitMQ()
+	r.isReady = true
+	close(r.connected)
+	return r
+}
+
+func TestRabbitMQWaitReadyFollowsTheConnection(t *testing.T) {
+	r := readyRabbitMQ()
+	if err := r.waitReady(context.Background()); err != nil {
+		t.Fatalf("waitReady while connected: %v", err)
+	}
+
+	// After the connection drops publishers and consumers wait for the next one
+	r.markDisconnected()
+	if r.IsReady() {
+		t.Error("still ready after the connection dropped")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.waitReady(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waitReady while disconnected returned %v, want the context deadline", err)
+	}
+
+	// Close wakes every waiter
+	waited := make(chan error, 1)
+	go func() { waited <- r.waitReady(context.Background()) }()
+	r.Close()
+	select {
+	case err := <-waited:
+		if !errors.Is(err, ErrRabbitMQClosed) {
+			t.Errorf("waitReady after Close returned %v, want ErrRabbitMQClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitReady did not return after Close")
+	}
+}
+
+func TestRabbitMQPublishRefusedWhileDisconnected(t *testing.T) {
+	r := newRabbitMQ()
+	err := r.PublishTransfer(context.Background(), TransferMessage{TransferID: "transfer"})
+	if !errors.Is(err, ErrRabbitMQNotReady) {
+		t.Errorf("publish while disconnected returned %v, want ErrRabbitMQNotReady", err)
+	}
+}
+
+func TestRabbitMQForward(t *testing.T) {
+	t.Run("lost channel", func(t *testing.T) {
+		r := readyRabbitMQ()
+		deliveries := make(chan amqp.Delivery, 1)
+		out := make(chan TransferDelivery, 1)
+
+		deliveries <- amqp.Delivery{Body: []byte("transfer")}
+		close(deliveries)
+
+		// A closed delivery channel means the connection dropped, the consumer must register again
+		if stopped := r.forward(context.Background(), deliveries, out); stopped {
+			t.Error("forward stopped for good when the channel was lost")
+		}
+		select {
+		case d := <-out:
+			if string(d.Body()) != "transfer" {
+				t.Errorf("forwarded %q, want %q", d.Body(), "transfer")
+			}
+		default:
+			t.Error("delivery was not forwarded")
+		}
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		r := readyRabbitMQ()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if stopped := r.forward(ctx, make(chan amqp.Delivery), make(chan TransferDelivery)); !stopped {
+			t.Error("forward did not stop with its context")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		r := readyRabbitMQ()
+		r.Close()
+		if stopped := r.forward(context.Background(), make(chan amqp.Delivery), make(chan TransferDelivery)); !stopped {
+			t.Error("forward did not stop after Close")
+		}
+	})
+}
+
+func TestRabbitMQConsumerStopsWithItsContext(t *testing.T) {
+	// Never connected: the consumer waits for a connection until it is stopped
+	r := newRabbitMQ()
+	ctx, cancel := context.WithCancel(context.Background())
+	deliveries, err := r.ConsumeTransfers(ctx)
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-deliveries:
+		if ok {
+			t.Error("delivery received without a connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delivery channel was not closed after the context was cancelled")
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{name: "no headers", want: 0},
+		{name: "int32", headers: amqp.Table{HeaderRetryCount: int32(2)}, want: 2},
+		{name: "int64", headers: amqp.Table{HeaderRetryCount: int64(3)}, want: 3},
+		{name: "int", headers: amqp.Table{HeaderRetryCount: 4}, want: 4},
+		{name: "other type", headers: amqp.Table{HeaderRetryCount: "5"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RetryCount(amqp.Delivery{Headers: tt.headers}); got != tt.want {
+				t.Errorf("RetryCount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryStopsAfterTheLastDelay(t *testing.T) {
+	// Publishing would fail without a connection, the last attempt must not get that far
+	d := &rabbitDelivery{
+		rmq: newRabbitMQ(),
+		d:   amqp.Delivery{Headers: amqp.Table{HeaderRetryCount: int32(len(TransferRetryDelays))}},
+	}
+	retried, err := d.Retry(context.Background(), "still failing")
+	if err != nil || retried {
+		t.Errorf("Retry after every delay = %v, %v, want false without an error", retried, err)
+	}
+}